@@ -9,6 +9,9 @@ import (
 const (
 	authorizeAccountURL   = "b2api/v2/b2_authorize_account"
 	authorizationCacheKey = "authorization"
+
+	// authorizationTTL is how long an authorization token stays valid.
+	authorizationTTL = 24 * time.Hour
 )
 
 // AccountAuthorization is returned by the B2 API authorization call.
@@ -60,20 +63,6 @@ type TokenCapability struct {
 	NamePrefix string `json:"namePrefix"`
 }
 
-// accountAuthorizationWithExpiryTimestamp is used for keeping track of when
-// the authorization token expires.
-type accountAuthorizationWithExpiryTimestamp struct {
-	AccountAuthorization
-
-	// Timestamp of when the token will become invalid.
-	TokenExpiresAt time.Time `json:"tokenExpiresAt"`
-}
-
-// Expired returns whether the authorization token has expired.
-func (a *accountAuthorizationWithExpiryTimestamp) Expired() bool {
-	return timeNow().After(a.TokenExpiresAt)
-}
-
 type AccountAuthorizeRequest struct {
 	// KeyID is the ID of the key.
 	KeyID string
@@ -90,14 +79,15 @@ type AuthorizationService struct {
 
 // AuthorizeAccount is used to log in to the B2 API.
 func (s *AuthorizationService) AuthorizeAccount(ctx context.Context, authorizationRequest *AccountAuthorizeRequest) (*AccountAuthorization, error) {
-	// Have we already authorized the account?
-	cachedAuth := new(accountAuthorizationWithExpiryTimestamp)
+	// Have we already authorized the account? Cached authorizations
+	// expire along with their token.
+	cachedAuth := new(AccountAuthorization)
 	if err := s.client.cache.Get(authorizationCacheKey, cachedAuth); err != nil {
 		return nil, err
 	}
 
-	if !cachedAuth.Expired() {
-		return &cachedAuth.AccountAuthorization, nil
+	if cachedAuth.AuthorizationToken != "" {
+		return cachedAuth, nil
 	}
 
 	// Otherwise obtain new authorization data.
@@ -114,11 +104,7 @@ func (s *AuthorizationService) AuthorizeAccount(ctx context.Context, authorizati
 	}
 
 	// Cache the new authorization data.
-	cachedAuth = &accountAuthorizationWithExpiryTimestamp{
-		AccountAuthorization: *auth,
-		TokenExpiresAt:       timeNow().Add(time.Hour * 24),
-	}
-	if err := s.client.cache.Set(authorizationCacheKey, cachedAuth); err != nil {
+	if err := s.client.cache.Set(authorizationCacheKey, auth, authorizationTTL); err != nil {
 		return nil, err
 	}
 
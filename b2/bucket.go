@@ -2,12 +2,25 @@ package b2
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"time"
 )
 
 const (
 	createBucketURL = "b2api/v2/b2_create_bucket"
 	listBucketsURL  = "b2api/v2/b2_list_buckets"
+
+	// bucketsCacheKey holds the generation of the cached bucket name to ID
+	// mappings. Each mapping is cached under its own key, which starts with
+	// the generation, so that all of them are dropped by starting a new one.
+	bucketsCacheKey = "buckets"
+
+	// bucketCacheTTL is how long a bucket name to ID mapping is trusted
+	// before it is looked up again.
+	bucketCacheTTL = time.Hour
 )
 
 // Bucket is used to represent a B2 Bucket
@@ -85,6 +98,10 @@ func (s *BucketService) Create(ctx context.Context, createRequest *BucketCreateR
 		return nil, resp, err
 	}
 
+	// A bucket that was deleted and created again gets a new ID. The
+	// bucket exists either way, so failing to cache it is no error.
+	s.cache(*bucket)
+
 	return bucket, resp, err
 }
 
@@ -101,5 +118,87 @@ func (s *BucketService) List(ctx context.Context, listRequest *BucketListRequest
 		return nil, resp, err
 	}
 
+	// Refresh the cached name to ID mappings while we're at it.
+	s.cache(root.Buckets...)
+
 	return root.Buckets, resp, err
 }
+
+// Lookup returns the Bucket with the given name.
+//
+// Most API calls require the bucket ID rather than its name, so the name to
+// ID mappings are cached to avoid listing buckets on every call. The cached
+// mappings are dropped when the API reports a bad bucket ID, which happens
+// after a bucket is deleted or recreated.
+func (s *BucketService) Lookup(ctx context.Context, name string) (*Bucket, error) {
+	// An unreadable cache is as good as an empty one
+	var generation string
+	s.client.cache.Get(bucketsCacheKey, &generation)
+
+	if generation != "" {
+		cached := new(Bucket)
+		s.client.cache.Get(bucketCacheKey(generation, name), cached)
+		if cached.ID != "" {
+			return cached, nil
+		}
+	}
+
+	req := &BucketListRequest{
+		AccountID: s.client.AccountID,
+		Name:      name,
+	}
+	found, _, err := s.List(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("bucket with name %q was not found", name)
+	}
+
+	return &found[0], nil
+}
+
+// cache stores the name to ID mappings of buckets. The cache only saves
+// lookups, so callers may ignore errors.
+func (s *BucketService) cache(buckets ...Bucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	var generation string
+	if err := s.client.cache.Get(bucketsCacheKey, &generation); err != nil {
+		return err
+	}
+
+	if generation == "" {
+		bytes := make([]byte, 8)
+		if _, err := rand.Read(bytes); err != nil {
+			return err
+		}
+		generation = hex.EncodeToString(bytes)
+
+		if err := s.client.cache.Set(bucketsCacheKey, generation, 0); err != nil {
+			return err
+		}
+	}
+
+	for _, bucket := range buckets {
+		if err := s.client.cache.Set(bucketCacheKey(generation, bucket.Name), bucket, bucketCacheTTL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// invalidate drops all cached name to ID mappings. The mappings of the old
+// generation are left to expire.
+func (s *BucketService) invalidate() error {
+	return s.client.cache.Delete(bucketsCacheKey)
+}
+
+// bucketCacheKey returns the cache key of the name to ID mapping of a bucket.
+func bucketCacheKey(generation, name string) string {
+	return bucketsCacheKey + "/" + generation + "/" + name
+}
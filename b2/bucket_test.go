@@ -0,0 +1,128 @@
+package b2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/testutil"
+)
+
+func TestBucket_LookupIsCached(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	bucketID := "1"
+	lookups := 0
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		req := new(BucketListRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		if req.Name != "my-bucket" {
+			fmt.Fprintf(w, `{"buckets": [{"bucketId": "other", "bucketName": %q}]}`, req.Name)
+			return
+		}
+		fmt.Fprintf(w, `{"buckets": [{"bucketId": %q, "bucketName": "my-bucket"}]}`, bucketID)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"status": 400, "code": "bad_bucket_id", "message": "Invalid bucketId: 1"}`)
+	})
+
+	now := time.Date(2020, 10, 21, 22, 48, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	cache, err := NewInMemoryCache()
+	require.NoError(t, err)
+
+	client, err := NewClient("key-id", "key-secret", SetBaseURL(server.URL), SetCache(cache))
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+
+	bucket, err := client.Bucket.Lookup(ctx, "my-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "1", bucket.ID)
+
+	bucket, err = client.Bucket.Lookup(ctx, "my-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "1", bucket.ID)
+	assert.Equal(t, 1, lookups)
+
+	// The bucket is recreated and the API rejects the old ID
+	bucketID = "2"
+	_, _, err = client.File.List(ctx, &FileListRequest{BucketID: "1"})
+	assert.True(t, errors.Is(err, ErrBadBucketID))
+	assert.Contains(t, err.Error(), "Invalid bucketId: 1")
+
+	bucket, err = client.Bucket.Lookup(ctx, "my-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "2", bucket.ID)
+	assert.Equal(t, 2, lookups)
+
+	// Mappings expire on their own, even if other buckets are cached
+	// after them
+	now = now.Add(bucketCacheTTL / 2)
+	_, err = client.Bucket.Lookup(ctx, "other-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, 3, lookups)
+
+	now = now.Add(bucketCacheTTL/2 + time.Second)
+	_, err = client.Bucket.Lookup(ctx, "my-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, 4, lookups)
+}
+
+// failingCache is a cache that can't store anything but authorizations.
+type failingCache struct {
+	Cache
+}
+
+func (c failingCache) Set(key string, value interface{}, ttl time.Duration) error {
+	if !strings.HasSuffix(key, "/"+authorizationCacheKey) {
+		return errors.New("disk full")
+	}
+	return c.Cache.Set(key, value, ttl)
+}
+
+func TestBucket_CacheFailuresAreIgnored(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	mux.HandleFunc("/b2api/v2/b2_create_bucket", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"bucketId": "1", "bucketName": "my-bucket"}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "1", "bucketName": "my-bucket"}]}`)
+	})
+
+	cache, err := NewInMemoryCache()
+	require.NoError(t, err)
+
+	client, err := NewClient("key-id", "key-secret", SetBaseURL(server.URL), SetCache(failingCache{cache}))
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+
+	// The bucket was created, even though it couldn't be cached
+	bucket, _, err := client.Bucket.Create(ctx, &BucketCreateRequest{Name: "my-bucket"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", bucket.ID)
+
+	buckets, _, err := client.Bucket.List(ctx, &BucketListRequest{})
+	require.NoError(t, err)
+	assert.Len(t, buckets, 1)
+
+	bucket, err = client.Bucket.Lookup(ctx, "my-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "1", bucket.ID)
+}
@@ -1,14 +1,62 @@
 package b2
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
+const (
+	// lockTimeout is how long to wait for another process to release the
+	// cache lock.
+	lockTimeout = 10 * time.Second
+
+	// lockRetryInterval is how often to check whether the cache lock has
+	// been released.
+	lockRetryInterval = 10 * time.Millisecond
+)
+
+// cacheEntry is a single value stored in a cache.
+type cacheEntry struct {
+	Value json.RawMessage `json:"value"`
+
+	// ExpiresAt is the time after which the entry is ignored. A zero value
+	// means the entry never expires.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expired returns whether the entry should be ignored.
+func (e *cacheEntry) Expired() bool {
+	return !e.ExpiresAt.IsZero() && timeNow().After(e.ExpiresAt)
+}
+
+// newCacheEntry encodes value into a new cache entry that expires after ttl.
+func newCacheEntry(value interface{}, ttl time.Duration) (cacheEntry, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+
+	entry := cacheEntry{Value: bytes}
+	if ttl > 0 {
+		entry.ExpiresAt = timeNow().Add(ttl)
+	}
+
+	return entry, nil
+}
+
 // DiskCache implements the Cache interface.
+//
+// All entries are stored in a single JSON file. The file is always replaced
+// atomically, so readers never see a partially written file, and writers
+// lock a separate file, so that concurrent b2 processes don't overwrite each
+// other's entries.
 type DiskCache struct {
 	filename string
 	mu       sync.RWMutex
@@ -20,88 +68,243 @@ type DiskCache struct {
 // and is writeable.
 func NewDiskCache(path string) (*DiskCache, error) {
 	filename := filepath.Join(path, "cache.json")
-	return &DiskCache{filename, sync.RWMutex{}}, nil
+	return &DiskCache{filename: filename}, nil
 }
 
 func (c *DiskCache) Get(key string, value interface{}) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	cacheBytes, err := ioutil.ReadFile(c.filename)
+	entries, err := c.read()
 	if err != nil {
-		// ignore "file does not exists" error
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
 
-	m := make(map[string]interface{})
-	if err := json.Unmarshal(cacheBytes, &m); err != nil {
-		return err
+	entry, ok := entries[key]
+	if !ok || entry.Expired() {
+		return nil
 	}
 
-	// Admittedly, marshaling and unmarshaling the cache value to json is
-	// fairly strange, but that's because we first read the whole cache file
-	// from disk in order to get the data pointed to by key. Then to avoid
-	// reimplementing what json.Unmarshal does when decoding values, we just
-	// marshal the whole data to json and then unmarshal it again into the
-	// value pointed to by value.
-	bytes, err := json.Marshal(m[key])
+	return json.Unmarshal(entry.Value, value)
+}
+
+func (c *DiskCache) Set(key string, value interface{}, ttl time.Duration) error {
+	entry, err := newCacheEntry(value, ttl)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(bytes, value)
+	return c.update(func(entries map[string]cacheEntry) {
+		entries[key] = entry
+	})
+}
+
+func (c *DiskCache) Delete(key string) error {
+	return c.update(func(entries map[string]cacheEntry) {
+		delete(entries, key)
+	})
 }
 
-func (c *DiskCache) Set(key string, value interface{}) error {
+// update applies fn to the cache entries while holding the cache lock.
+func (c *DiskCache) update(fn func(entries map[string]cacheEntry)) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	m := make(map[string]interface{})
-	m[key] = value
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	for key, entry := range entries {
+		if entry.Expired() {
+			delete(entries, key)
+		}
+	}
+
+	fn(entries)
+
+	return c.write(entries)
+}
+
+// read returns all entries stored in the cache file.
+//
+// A missing or corrupt cache file is treated as an empty cache. The next
+// write will replace a corrupt file.
+func (c *DiskCache) read() (map[string]cacheEntry, error) {
+	entries := make(map[string]cacheEntry)
+
+	bytes, err := ioutil.ReadFile(c.filename)
+	if err != nil {
+		// ignore "file does not exists" error
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return make(map[string]cacheEntry), nil
+	}
+
+	return entries, nil
+}
+
+// write atomically replaces the cache file with entries.
+func (c *DiskCache) write(entries map[string]cacheEntry) error {
+	bytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
 
-	jsonBytes, err := json.MarshalIndent(m, "", "  ")
+	f, err := ioutil.TempFile(filepath.Dir(c.filename), filepath.Base(c.filename)+".tmp")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(bytes); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.filename)
+}
+
+// lock acquires the advisory lock that serializes writes between processes.
+//
+// The lock is taken on a lock file that is never removed, so that all
+// processes lock the same file. The operating system releases the lock when
+// the process holding it dies, so a crashed process can't leave it behind.
+func (c *DiskCache) lock() (func(), error) {
+	lockname := c.filename + ".lock"
+
+	f, err := os.OpenFile(lockname, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
 
-	return ioutil.WriteFile(c.filename, jsonBytes, 0600)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out waiting for cache lock %s", lockname)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
 }
 
 // InMemoryCache implements the Cache interface.
 type InMemoryCache struct {
-	m  map[string]interface{}
+	m  map[string]cacheEntry
 	mu sync.RWMutex
 }
 
 // NewInMemoryCache returns a new in-memory cache.
 func NewInMemoryCache() (*InMemoryCache, error) {
-	return &InMemoryCache{make(map[string]interface{}), sync.RWMutex{}}, nil
+	return &InMemoryCache{m: make(map[string]cacheEntry)}, nil
 }
 
 func (c *InMemoryCache) Get(key string, value interface{}) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	// Admittedly, marshaling and unmarshaling the cache value to json is
-	// fairly strange, but that's because we first read the whole cache file
-	// from disk in order to get the data pointed to by key. Then to avoid
-	// reimplementing what json.Unmarshal does when decoding values, we just
-	// marshal the whole data to json and then unmarshal it again into the
-	// value pointed to by value.
-	bytes, err := json.Marshal(c.m[key])
+	entry, ok := c.m[key]
+	if !ok || entry.Expired() {
+		return nil
+	}
+
+	// Values are stored encoded, same as in the disk cache, so that callers
+	// can't modify the cached value through the objects they passed in.
+	return json.Unmarshal(entry.Value, value)
+}
+
+func (c *InMemoryCache) Set(key string, value interface{}, ttl time.Duration) error {
+	entry, err := newCacheEntry(value, ttl)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(bytes, value)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = entry
+	return nil
 }
 
-func (c *InMemoryCache) Set(key string, value interface{}) error {
+func (c *InMemoryCache) Delete(key string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.m[key] = value
+	delete(c.m, key)
+	return nil
+}
+
+// namespacedCache is a Cache that prefixes all keys with a namespace, so that
+// several accounts and keys can share the same underlying cache.
+type namespacedCache struct {
+	cache     Cache
+	namespace string
+}
+
+// newKeyCache returns a cache that is private to the key with the given ID.
+//
+// The key ID is hashed, so that it isn't stored in plain text in the cache.
+func newKeyCache(cache Cache, keyID string) *namespacedCache {
+	sum := sha256.Sum256([]byte(keyID))
+	return &namespacedCache{cache, hex.EncodeToString(sum[:8])}
+}
+
+func (c *namespacedCache) key(key string) string {
+	return c.namespace + "/" + key
+}
+
+func (c *namespacedCache) Get(key string, value interface{}) error {
+	return c.cache.Get(c.key(key), value)
+}
+
+func (c *namespacedCache) Set(key string, value interface{}, ttl time.Duration) error {
+	return c.cache.Set(c.key(key), value, ttl)
+}
+
+func (c *namespacedCache) Delete(key string) error {
+	return c.cache.Delete(c.key(key))
+}
+
+// ClearCache removes everything cached on behalf of the key with the given
+// ID, such as its authorization token and bucket IDs.
+func ClearCache(cache Cache, keyID string) error {
+	keyCache := newKeyCache(cache, keyID)
+	for _, key := range []string{authorizationCacheKey, bucketsCacheKey} {
+		if err := keyCache.Delete(key); err != nil {
+			return err
+		}
+	}
 	return nil
 }
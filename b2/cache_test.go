@@ -0,0 +1,140 @@
+package b2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiskCache(t *testing.T) (*DiskCache, string) {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	cache, err := NewDiskCache(tmpDir)
+	require.NoError(t, err)
+
+	return cache, tmpDir
+}
+
+func TestDiskCache_KeepsAllKeys(t *testing.T) {
+	cache, _ := newTestDiskCache(t)
+
+	require.NoError(t, cache.Set("foo", "bar", 0))
+	require.NoError(t, cache.Set("hello", "world", 0))
+
+	var foo, hello string
+	require.NoError(t, cache.Get("foo", &foo))
+	require.NoError(t, cache.Get("hello", &hello))
+	assert.Equal(t, "bar", foo)
+	assert.Equal(t, "world", hello)
+
+	require.NoError(t, cache.Delete("foo"))
+
+	foo = ""
+	require.NoError(t, cache.Get("foo", &foo))
+	assert.Equal(t, "", foo)
+}
+
+func TestDiskCache_EntriesExpire(t *testing.T) {
+	cache, _ := newTestDiskCache(t)
+
+	now := time.Date(2020, 10, 21, 22, 48, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	require.NoError(t, cache.Set("short", "lived", time.Minute))
+	require.NoError(t, cache.Set("long", "lived", time.Hour))
+
+	now = now.Add(2 * time.Minute)
+
+	var short, long string
+	require.NoError(t, cache.Get("short", &short))
+	require.NoError(t, cache.Get("long", &long))
+	assert.Equal(t, "", short)
+	assert.Equal(t, "lived", long)
+}
+
+func TestDiskCache_RecoversFromCorruptFile(t *testing.T) {
+	cache, tmpDir := newTestDiskCache(t)
+
+	cacheFile := filepath.Join(tmpDir, "cache.json")
+	require.NoError(t, ioutil.WriteFile(cacheFile, []byte(`{"foo": {"val`), 0600))
+
+	var foo string
+	require.NoError(t, cache.Get("foo", &foo))
+	assert.Equal(t, "", foo)
+
+	require.NoError(t, cache.Set("foo", "bar", 0))
+	require.NoError(t, cache.Get("foo", &foo))
+	assert.Equal(t, "bar", foo)
+}
+
+func TestDiskCache_ConcurrentWriters(t *testing.T) {
+	_, tmpDir := newTestDiskCache(t)
+
+	// Every writer has its own DiskCache, like separate b2 processes would.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache, err := NewDiskCache(tmpDir)
+			require.NoError(t, err)
+			assert.NoError(t, cache.Set(fmt.Sprintf("key-%d", i), i, 0))
+		}(i)
+	}
+	wg.Wait()
+
+	cache, err := NewDiskCache(tmpDir)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		var value int
+		require.NoError(t, cache.Get(fmt.Sprintf("key-%d", i), &value))
+		assert.Equal(t, i, value)
+	}
+}
+
+func TestDiskCache_IgnoresLeftoverLockFile(t *testing.T) {
+	cache, tmpDir := newTestDiskCache(t)
+
+	lockFile := filepath.Join(tmpDir, "cache.json.lock")
+	require.NoError(t, ioutil.WriteFile(lockFile, nil, 0600))
+
+	require.NoError(t, cache.Set("foo", "bar", 0))
+
+	var value string
+	require.NoError(t, cache.Get("foo", &value))
+	assert.Equal(t, "bar", value)
+}
+
+func TestDiskCache_LockIsExclusive(t *testing.T) {
+	cache, tmpDir := newTestDiskCache(t)
+
+	unlock, err := cache.lock()
+	require.NoError(t, err)
+
+	// Another process would open the lock file on its own
+	f, err := os.Open(filepath.Join(tmpDir, "cache.json.lock"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	locked, err := tryLockFile(f)
+	require.NoError(t, err)
+	assert.False(t, locked)
+
+	unlock()
+
+	locked, err = tryLockFile(f)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	require.NoError(t, unlockFile(f))
+}
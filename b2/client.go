@@ -21,6 +21,8 @@ const (
 	defaultBaseURL = "https://api.backblazeb2.com/"
 )
 
+// The errors below are wrapped along with the message of the API, so that
+// it reaches the user. Check for them with errors.Is rather than ==.
 var (
 	// ErrExpiredToken is returned by the client when authorization token
 	// has expired. If returned, repeating the same request will acquire
@@ -31,6 +33,18 @@ var (
 	// applicationKey are wrong.
 	ErrUnauthorized = errors.New("invalid credentials")
 
+	// ErrBadBucketID is returned when the bucket ID used in a request does
+	// not exist, for example because the bucket has been deleted.
+	ErrBadBucketID = errors.New("bad bucket id")
+
+	// ErrRangeNotSatisfiable is returned when a byte range starts after
+	// the end of the file, for example because the file is empty.
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+	// ErrNotFound is returned when the requested file or resource does
+	// not exist.
+	ErrNotFound = errors.New("not found")
+
 	// timeNow is a mockable version of time.Now
 	timeNow = time.Now
 )
@@ -47,8 +61,12 @@ type Cache interface {
 	// Get reads the value at key into the object pointed to by value.
 	Get(key string, value interface{}) error
 
-	// Set writes the value at key from the object pointed to by value.
-	Set(key string, value interface{}) error
+	// Set writes the value at key from the object pointed to by value. The
+	// value expires after ttl, or never if ttl is zero.
+	Set(key string, value interface{}, ttl time.Duration) error
+
+	// Delete removes the value at key.
+	Delete(key string) error
 }
 
 // Client manages communication with Backblaze API.
@@ -72,12 +90,14 @@ type Client struct {
 
 	// Cache is used for caching authorization tokens for up to
 	// 24 hours as well as various other things such as bucket
-	// name to ID mappings required for many API calls.
+	// name to ID mappings required for many API calls. All keys
+	// are scoped to the key ID.
 	cache Cache
 
-	AccountID           string
-	DownloadURL         string
-	RecommendedPartSize int64
+	AccountID               string
+	DownloadURL             string
+	RecommendedPartSize     int64
+	AbsoluteMinimumPartSize int64
 
 	// Services used for communicating with the API.
 	Authorization *AuthorizationService
@@ -107,13 +127,17 @@ func NewClient(keyId, keySecret string, opts ...ClientOpt) (*Client, error) {
 	}
 
 	if c.cache == nil {
-		cache, err := newDiskCache()
+		cache, err := DefaultDiskCache()
 		if err != nil {
 			return nil, err
 		}
 		c.cache = cache
 	}
 
+	// Cached tokens and bucket IDs are only valid for the key that
+	// obtained them.
+	c.cache = newKeyCache(c.cache, keyId)
+
 	// Instantiate API services.
 	c.Authorization = &AuthorizationService{client: c}
 	c.Bucket = &BucketService{client: c}
@@ -142,6 +166,7 @@ func NewClient(keyId, keySecret string, opts ...ClientOpt) (*Client, error) {
 	c.AccountID = auth.AccountID
 	c.DownloadURL = auth.DownloadURL
 	c.RecommendedPartSize = int64(auth.RecommendedPartSize)
+	c.AbsoluteMinimumPartSize = int64(auth.AbsoluteMinimumPartSize)
 
 	return c, nil
 }
@@ -244,6 +269,11 @@ func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
 
 	err = checkResponse(resp)
 	if err != nil {
+		// The bucket was likely deleted or recreated, so none of the
+		// cached bucket IDs can be trusted anymore.
+		if errors.Is(err, ErrBadBucketID) && c.Bucket != nil {
+			c.Bucket.invalidate()
+		}
 		return nil, err
 	}
 
@@ -277,32 +307,49 @@ func checkResponse(r *http.Response) error {
 	if err != nil {
 		return err
 	}
-	if len(data) == 0 {
-		return fmt.Errorf("%v %v: empty error body", r.Request.Method, r.Request.URL)
-	}
 
 	errResp := new(errorResponse)
-	err = json.Unmarshal(data, errResp)
-	if err != nil {
-		errResp.Message = string(data)
+	switch {
+	case len(data) == 0 && r.Request.Method == http.MethodHead:
+		// Responses to HEAD requests have no body to explain the error
+		errResp.Message = http.StatusText(r.StatusCode)
+	case len(data) == 0:
+		return fmt.Errorf("%v %v: empty error body", r.Request.Method, r.Request.URL)
+	default:
+		if err := json.Unmarshal(data, errResp); err != nil {
+			errResp.Message = string(data)
+		}
 	}
 
 	if r.StatusCode == 401 {
 		switch errResp.Code {
 		case "expired_auth_token":
-			return ErrExpiredToken
+			return fmt.Errorf("%w: %v", ErrExpiredToken, errResp.Message)
 		case "unauthorized":
-			return ErrUnauthorized
+			return fmt.Errorf("%w: %v", ErrUnauthorized, errResp.Message)
 		}
 	}
 
+	if r.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return fmt.Errorf("%w: %v", ErrRangeNotSatisfiable, errResp.Message)
+	}
+
+	if r.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %v", ErrNotFound, errResp.Message)
+	}
+
+	if errResp.Code == "bad_bucket_id" {
+		return fmt.Errorf("%w: %v", ErrBadBucketID, errResp.Message)
+	}
+
 	return fmt.Errorf("%v %v %v %v: %v %v", r.Proto, r.StatusCode, r.Request.Method, r.Request.URL, errResp.Code, errResp.Message)
 }
 
-// newDiskCache creates and returns disk cache.
+// DefaultDiskCache creates and returns the disk cache used by clients
+// unless another cache is set.
 //
 // The directory used for caching is created if it doesn't exist already
-func newDiskCache() (*DiskCache, error) {
+func DefaultDiskCache() (*DiskCache, error) {
 	cacheDir, err := os.UserCacheDir()
 	if err != nil {
 		return nil, err
@@ -45,30 +45,55 @@ func TestClient_AuthorizationCache(t *testing.T) {
 	}
 
 	authJSON := `{
-		"authorization": {
-			"tokenExpiresAt": "2020-10-22T22:48:00Z",
-			"absoluteMinimumPartSize": 5000000,
-			"accountId": "abc123",
-			"allowed": {
-			"bucketId": "my-bucket",
-			"bucketName": "MY BUCKET",
-			"capabilities": ["listBuckets","listFiles","readFiles","shareFiles","writeFiles","deleteFiles"],
-			"namePrefix": ""
+		"%s": {
+			"value": {
+				"absoluteMinimumPartSize": 5000000,
+				"accountId": "abc123",
+				"allowed": {
+				"bucketId": "my-bucket",
+				"bucketName": "MY BUCKET",
+				"capabilities": ["listBuckets","listFiles","readFiles","shareFiles","writeFiles","deleteFiles"],
+				"namePrefix": ""
+				},
+				"apiUrl": "%s",
+				"authorizationToken": "4_0022623512fc8f80000000001_0186e431_d18d02_acct_tH7VW03boebOXayIc43-sxptpfA=",
+				"downloadUrl": "%s",
+				"recommendedPartSize": 100000000,
+				"s3ApiUrl": ""
 			},
-			"apiUrl": "%s",
-			"authorizationToken": "4_0022623512fc8f80000000001_0186e431_d18d02_acct_tH7VW03boebOXayIc43-sxptpfA=",
-			"downloadUrl": "%s",
-			"recommendedPartSize": 100000000
+			"expiresAt": "2020-10-22T22:48:00Z"
 		}
 	}`
 
 	_, err = NewClient("key-id", "key-secret", SetBaseURL(server.URL), SetCache(cache))
 	require.NoError(t, err)
 
-	cacheFile := filepath.Join(tmpDir, "cache")
+	cacheFile := filepath.Join(tmpDir, "cache.json")
 	authBytes, err := ioutil.ReadFile(cacheFile)
 	assert.NoError(t, err)
-	assert.JSONEq(t, fmt.Sprintf(authJSON, server.URL, server.URL), string(authBytes))
+	cacheKey := newKeyCache(cache, "key-id").key("authorization")
+	assert.JSONEq(t, fmt.Sprintf(authJSON, cacheKey, server.URL, server.URL), string(authBytes))
+}
+
+func TestClient_AuthorizationCacheIsScopedToKey(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		keyID, _, _ := r.BasicAuth()
+		fmt.Fprintf(w, `{"accountId": "account-of-%s", "authorizationToken": "token-of-%s"}`, keyID, keyID)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cache, err := NewInMemoryCache()
+	require.NoError(t, err)
+
+	first, err := NewClient("first-key", "secret", SetBaseURL(server.URL), SetCache(cache))
+	require.NoError(t, err)
+	assert.Equal(t, "account-of-first-key", first.AccountID)
+
+	second, err := NewClient("second-key", "secret", SetBaseURL(server.URL), SetCache(cache))
+	require.NoError(t, err)
+	assert.Equal(t, "account-of-second-key", second.AccountID)
 }
 
 func TestClient_NewRequestDefaults(t *testing.T) {
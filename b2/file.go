@@ -2,20 +2,47 @@ package b2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	listFilesURL           = "b2api/v2/b2_list_file_names"
+	listFileVersionsURL    = "b2api/v2/b2_list_file_versions"
+	fileHideURL            = "b2api/v2/b2_hide_file"
+	fileDeleteVersionURL   = "b2api/v2/b2_delete_file_version"
 	fileUploadURL          = "b2api/v2/b2_get_upload_url"
 	filePartUploadURL      = "b2api/v2/b2_get_upload_part_url"
 	fileStartLargeFileURL  = "b2api/v2/b2_start_large_file"
 	fileFinishLargeFileURL = "b2api/v2/b2_finish_large_file"
 	fileCancelLargeFileURL = "b2api/v2/b2_cancel_large_file"
+	listUnfinishedURL      = "b2api/v2/b2_list_unfinished_large_files"
+	listPartsURL           = "b2api/v2/b2_list_parts"
+	fileCopyURL            = "b2api/v2/b2_copy_file"
+	fileCopyPartURL        = "b2api/v2/b2_copy_part"
+	downloadAuthURL        = "b2api/v2/b2_get_download_authorization"
+
+	// defaultContentType tells B2 to pick the content type based on
+	// the file name extension.
+	defaultContentType = "b2/x-auto"
+
+	// maxFileInfoItems is the maximum number of file info key/value
+	// pairs that can be stored along with a file.
+	maxFileInfoItems = 10
+
+	// maxFileInfoKeyLength is the maximum length of a file info key.
+	maxFileInfoKeyLength = 50
+
+	// maxFileInfoHeaderBytes is the maximum combined size of the encoded
+	// file name and file info headers of an upload.
+	maxFileInfoHeaderBytes = 7000
 )
 
 // File describes a File or a Folder in a Bucket
@@ -51,6 +78,32 @@ type FileListRequest struct {
 type fileListRoot struct {
 	Files        []File `json:"files"`
 	NextFileName string `json:"nextFileName"`
+	NextFileID   string `json:"nextFileId"`
+}
+
+// FileVersionListRequest represents a request to list all versions of the
+// files in a Bucket
+type FileVersionListRequest struct {
+	BucketID      string `json:"bucketId"`
+	StartFileName string `json:"startFileName,omitempty"`
+	StartFileID   string `json:"startFileId,omitempty"`
+	MaxFileCount  int    `json:"maxFileCount,omitempty"`
+	Prefix        string `json:"prefix,omitempty"`
+	Delimiter     string `json:"delimiter,omitempty"`
+}
+
+// HideFileRequest represents a request to hide a file, so that it's no
+// longer listed or downloadable by name. Older versions are kept.
+type HideFileRequest struct {
+	BucketID string `json:"bucketId"`
+	FileName string `json:"fileName"`
+}
+
+// DeleteFileVersionRequest represents a request to delete a single version
+// of a file.
+type DeleteFileVersionRequest struct {
+	FileName string `json:"fileName"`
+	FileID   string `json:"fileId"`
 }
 
 // UploadAuthorizationRequest represents a request to obtain a URL for uploading files
@@ -80,6 +133,58 @@ type UploadRequest struct {
 	ChecksumSHA1  string
 	ContentLength int64
 	LastModified  time.Time
+
+	// ContentType is the MIME type of the file. If empty, B2 will
+	// determine it from the file name extension.
+	ContentType string
+
+	// FileInfo holds custom information to be stored along with the
+	// file. B2 allows up to 10 items, including src_last_modified_millis
+	// which is derived from LastModified unless set explicitly, and the
+	// response headers.
+	FileInfo map[string]string
+
+	// ResponseHeaders are sent back by B2 when the file is downloaded.
+	ResponseHeaders
+}
+
+// ResponseHeaders are the HTTP headers B2 includes in the response when
+// a file is downloaded. They are stored along with the file as b2-* file
+// info and count towards the limit of file info items.
+type ResponseHeaders struct {
+	// CacheControl is the value of the Cache-Control header.
+	CacheControl string
+
+	// ContentDisposition is the value of the Content-Disposition header,
+	// e.g. `attachment; filename="report.pdf"`.
+	ContentDisposition string
+
+	// ContentEncoding is the value of the Content-Encoding header.
+	ContentEncoding string
+
+	// ContentLanguage is the value of the Content-Language header.
+	ContentLanguage string
+
+	// Expires is the value of the Expires header. It must be an HTTP
+	// date, e.g. "Mon, 02 Jan 2006 15:04:05 GMT".
+	Expires string
+}
+
+// FileInfo returns the headers that are set as b2-* file info.
+func (h ResponseHeaders) FileInfo() map[string]string {
+	info := make(map[string]string)
+	for k, v := range map[string]string{
+		"b2-cache-control":       h.CacheControl,
+		"b2-content-disposition": h.ContentDisposition,
+		"b2-content-encoding":    h.ContentEncoding,
+		"b2-content-language":    h.ContentLanguage,
+		"b2-expires":             h.Expires,
+	} {
+		if v != "" {
+			info[k] = v
+		}
+	}
+	return info
 }
 
 type UploadPartRequest struct {
@@ -96,6 +201,10 @@ type StartLargeFileRequest struct {
 	Filename    string            `json:"fileName"`
 	ContentType string            `json:"contentType"`
 	FileInfo    map[string]string `json:"fileInfo"`
+
+	// ResponseHeaders are sent back by B2 when the file is downloaded.
+	// They are merged into FileInfo when the request is sent.
+	ResponseHeaders `json:"-"`
 }
 
 // FinishLargeFileRequest converts the parts that have been uploaded into a single B2 file.
@@ -114,6 +223,201 @@ type CancelLargeFileRequest struct {
 	FileID string `json:"fileId"`
 }
 
+// CopyFileRequest represents a request to copy a file on the server. The
+// file info and content type of the source are kept.
+type CopyFileRequest struct {
+	SourceFileID string `json:"sourceFileId"`
+
+	// The bucket to copy the file to. Empty means the bucket of the
+	// source file.
+	DestinationBucketID string `json:"destinationBucketId,omitempty"`
+
+	// Name of the copy.
+	FileName string `json:"fileName"`
+}
+
+// CopyPartRequest represents a request to copy a byte range of a file to a
+// part of a large file.
+type CopyPartRequest struct {
+	SourceFileID string `json:"sourceFileId"`
+
+	// The ID returned by StartLargeFileRequest.
+	LargeFileID string `json:"largeFileId"`
+
+	PartNumber int64 `json:"partNumber"`
+
+	// Byte range of the source file, e.g. "bytes=0-99".
+	Range string `json:"range"`
+}
+
+// DownloadAuthorizationRequest represents a request for a token that allows
+// anyone to download the files whose names start with the prefix from a
+// private bucket.
+type DownloadAuthorizationRequest struct {
+	BucketID       string `json:"bucketId"`
+	FileNamePrefix string `json:"fileNamePrefix"`
+
+	// How long the token is valid for, at most a week.
+	ValidDurationInSeconds int64 `json:"validDurationInSeconds"`
+}
+
+// DownloadAuthorization contains the token for downloading files, which is
+// passed in the Authorization header or query parameter.
+type DownloadAuthorization struct {
+	BucketID       string `json:"bucketId"`
+	FileNamePrefix string `json:"fileNamePrefix"`
+	Token          string `json:"authorizationToken"`
+}
+
+// UnfinishedLargeFileListRequest represents a request to list the large
+// files that were started, but neither finished nor canceled.
+type UnfinishedLargeFileListRequest struct {
+	BucketID     string `json:"bucketId"`
+	NamePrefix   string `json:"namePrefix,omitempty"`
+	StartFileID  string `json:"startFileId,omitempty"`
+	MaxFileCount int    `json:"maxFileCount,omitempty"`
+}
+
+// PartListRequest represents a request to list the parts that have been
+// uploaded for a large file.
+type PartListRequest struct {
+	FileID          string `json:"fileId"`
+	StartPartNumber int64  `json:"startPartNumber,omitempty"`
+	MaxPartCount    int    `json:"maxPartCount,omitempty"`
+}
+
+type partListRoot struct {
+	Parts          []FilePart `json:"parts"`
+	NextPartNumber *int64     `json:"nextPartNumber"`
+}
+
+// responseHeaderValidators are used for checking the values of the b2-*
+// file info, which B2 rejects unless they're valid HTTP header values.
+var responseHeaderValidators = map[string]func(string) error{
+	"b2-cache-control":       validateHeaderValue,
+	"b2-content-disposition": validateContentDisposition,
+	"b2-content-encoding":    validateHeaderTokens,
+	"b2-content-language":    validateHeaderTokens,
+	"b2-expires":             validateExpires,
+}
+
+// mergeFileInfo returns the file info merged with the response headers.
+func mergeFileInfo(info map[string]string, headers ResponseHeaders) map[string]string {
+	merged := make(map[string]string, len(info)+5)
+	for k, v := range info {
+		merged[k] = v
+	}
+	for k, v := range headers.FileInfo() {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ValidateFileInfo checks that the file info can be stored along with
+// a file of the given name without exceeding the B2 limits on the number
+// and size of file info items.
+func ValidateFileInfo(filename string, info map[string]string) error {
+	if len(info) > maxFileInfoItems {
+		return fmt.Errorf("too many file info items: %d, at most %d are allowed", len(info), maxFileInfoItems)
+	}
+
+	size := len("X-Bz-File-Name") + len(url.QueryEscape(filename))
+	for k, v := range info {
+		if err := validateFileInfoKey(k); err != nil {
+			return err
+		}
+		if validate, ok := responseHeaderValidators[strings.ToLower(k)]; ok {
+			if err := validate(v); err != nil {
+				return fmt.Errorf("invalid %s: %v", k, err)
+			}
+		}
+		size += len("X-Bz-Info-"+k) + len(url.QueryEscape(v))
+	}
+
+	if size > maxFileInfoHeaderBytes {
+		return fmt.Errorf("file name and file info exceed %d bytes", maxFileInfoHeaderBytes)
+	}
+
+	return nil
+}
+
+func validateFileInfoKey(key string) error {
+	if key == "" {
+		return errors.New("file info key cannot be empty")
+	}
+	if len(key) > maxFileInfoKeyLength {
+		return fmt.Errorf("file info key %q is longer than %d characters", key, maxFileInfoKeyLength)
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return fmt.Errorf("file info key %q may only contain letters, numbers, \"-\" and \"_\"", key)
+		}
+	}
+	if _, ok := responseHeaderValidators[strings.ToLower(key)]; ok {
+		return nil
+	}
+	if strings.HasPrefix(strings.ToLower(key), "b2-") {
+		return fmt.Errorf("file info key %q uses the reserved \"b2-\" prefix", key)
+	}
+	return nil
+}
+
+func validateHeaderValue(value string) error {
+	if value == "" {
+		return errors.New("value cannot be empty")
+	}
+	for _, r := range value {
+		if r < ' ' || r > '~' {
+			return fmt.Errorf("%q contains characters not allowed in HTTP headers", value)
+		}
+	}
+	return nil
+}
+
+func validateHeaderTokens(value string) error {
+	if err := validateHeaderValue(value); err != nil {
+		return err
+	}
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" || strings.ContainsAny(token, " \t\"();:<>@[]{}/?=\\") {
+			return fmt.Errorf("%q is not a comma separated list of tokens", value)
+		}
+	}
+	return nil
+}
+
+func validateContentDisposition(value string) error {
+	if err := validateHeaderValue(value); err != nil {
+		return err
+	}
+	if _, _, err := mime.ParseMediaType(value); err != nil {
+		return fmt.Errorf("%q: %v", value, err)
+	}
+	return nil
+}
+
+func validateExpires(value string) error {
+	if _, err := http.ParseTime(value); err != nil {
+		return fmt.Errorf("%q is not an HTTP date, use a date like %q", value, http.TimeFormat)
+	}
+	return nil
+}
+
+// ValidateContentType checks that the content type is either a valid
+// MIME type or the special "b2/x-auto" value.
+func ValidateContentType(contentType string) error {
+	if contentType == defaultContentType {
+		return nil
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return fmt.Errorf("invalid content type %q: %v", contentType, err)
+	}
+	return nil
+}
+
 // FileService handles communication with the File related methods of the
 // B2 API
 type FileService struct {
@@ -136,6 +440,184 @@ func (s *FileService) List(ctx context.Context, listRequest *FileListRequest) ([
 	return root.Files, resp, nil
 }
 
+// ListAll lists all files in a Bucket, requesting as many pages of results
+// as needed.
+func (s *FileService) ListAll(ctx context.Context, listRequest *FileListRequest) ([]File, error) {
+	pageRequest := *listRequest
+
+	var files []File
+	for {
+		req, err := s.client.NewRequest(ctx, http.MethodPost, listFilesURL, &pageRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		root := new(fileListRoot)
+		if _, err := s.client.Do(req, root); err != nil {
+			return nil, err
+		}
+
+		files = append(files, root.Files...)
+
+		if root.NextFileName == "" {
+			return files, nil
+		}
+		pageRequest.StartFileName = root.NextFileName
+	}
+}
+
+// ListAllVersions lists all versions of all files in a Bucket, requesting
+// as many pages of results as needed. Versions of the same file are listed
+// from the newest to the oldest.
+func (s *FileService) ListAllVersions(ctx context.Context, listRequest *FileVersionListRequest) ([]File, error) {
+	pageRequest := *listRequest
+
+	var files []File
+	for {
+		req, err := s.client.NewRequest(ctx, http.MethodPost, listFileVersionsURL, &pageRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		root := new(fileListRoot)
+		if _, err := s.client.Do(req, root); err != nil {
+			return nil, err
+		}
+
+		files = append(files, root.Files...)
+
+		if root.NextFileName == "" {
+			return files, nil
+		}
+		pageRequest.StartFileName = root.NextFileName
+		pageRequest.StartFileID = root.NextFileID
+	}
+}
+
+// ListAllUnfinished lists all unfinished large files in a Bucket,
+// requesting as many pages of results as needed.
+func (s *FileService) ListAllUnfinished(ctx context.Context, listRequest *UnfinishedLargeFileListRequest) ([]File, error) {
+	pageRequest := *listRequest
+
+	var files []File
+	for {
+		req, err := s.client.NewRequest(ctx, http.MethodPost, listUnfinishedURL, &pageRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		root := new(fileListRoot)
+		if _, err := s.client.Do(req, root); err != nil {
+			return nil, err
+		}
+
+		files = append(files, root.Files...)
+
+		if root.NextFileID == "" {
+			return files, nil
+		}
+		pageRequest.StartFileID = root.NextFileID
+	}
+}
+
+// ListAllParts lists all parts that have been uploaded for a large file,
+// requesting as many pages of results as needed.
+func (s *FileService) ListAllParts(ctx context.Context, listRequest *PartListRequest) ([]FilePart, error) {
+	pageRequest := *listRequest
+
+	var parts []FilePart
+	for {
+		req, err := s.client.NewRequest(ctx, http.MethodPost, listPartsURL, &pageRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		root := new(partListRoot)
+		if _, err := s.client.Do(req, root); err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, root.Parts...)
+
+		if root.NextPartNumber == nil {
+			return parts, nil
+		}
+		pageRequest.StartPartNumber = *root.NextPartNumber
+	}
+}
+
+// Hide a file
+func (s *FileService) Hide(ctx context.Context, hideRequest *HideFileRequest) (*File, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPost, fileHideURL, hideRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	file := new(File)
+	_, err = s.client.Do(req, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// DeleteVersion deletes a single version of a file
+func (s *FileService) DeleteVersion(ctx context.Context, deleteRequest *DeleteFileVersionRequest) (*File, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPost, fileDeleteVersionURL, deleteRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	file := new(File)
+	_, err = s.client.Do(req, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// FileFromHeader returns the file described by the headers of a response
+// to downloading the file.
+func FileFromHeader(h http.Header) *File {
+	file := &File{
+		Action:      "upload",
+		ContentSHA1: h.Get("X-Bz-Content-Sha1"),
+		ContentType: h.Get("Content-Type"),
+		FileID:      h.Get("X-Bz-File-Id"),
+		FileInfo:    make(map[string]string),
+	}
+
+	if name, err := url.QueryUnescape(h.Get("X-Bz-File-Name")); err == nil {
+		file.FileName = name
+	}
+
+	// The length of a partial download is the length of the part
+	if r := h.Get("Content-Range"); r != "" {
+		if i := strings.LastIndex(r, "/"); i >= 0 {
+			file.ContentLength, _ = strconv.Atoi(r[i+1:])
+		}
+	} else {
+		file.ContentLength, _ = strconv.Atoi(h.Get("Content-Length"))
+	}
+
+	file.UploadTimestamp, _ = strconv.ParseInt(h.Get("X-Bz-Upload-Timestamp"), 10, 64)
+
+	for k := range h {
+		if !strings.HasPrefix(k, "X-Bz-Info-") {
+			continue
+		}
+		v, err := url.QueryUnescape(h.Get(k))
+		if err != nil {
+			v = h.Get(k)
+		}
+		file.FileInfo[strings.ToLower(strings.TrimPrefix(k, "X-Bz-Info-"))] = v
+	}
+
+	return file
+}
+
 // Download a file
 func (s *FileService) Download(ctx context.Context, url string, w io.Writer) (*http.Response, error) {
 	req, err := s.client.NewRequest(ctx, http.MethodGet, url, nil)
@@ -151,6 +633,85 @@ func (s *FileService) Download(ctx context.Context, url string, w io.Writer) (*h
 	return resp, nil
 }
 
+// DownloadRange downloads part of a file. The byte range is given as an
+// HTTP range, e.g. "bytes=100-199", or "bytes=-100" for the last 100 bytes.
+func (s *FileService) DownloadRange(ctx context.Context, url, byteRange string, w io.Writer) (*http.Response, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Range", byteRange)
+
+	resp, err := s.client.Do(req, w)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Open starts downloading a file and returns the response with the contents
+// of the file left in its body, for streaming them elsewhere. The header is
+// added to the request, e.g. to download a byte range or to make the request
+// conditional. Responses of 304 Not Modified and 412 Precondition Failed are
+// returned without an error.
+//
+// It is callers responsibility to close the body of the response
+func (s *FileService) Open(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	return s.open(ctx, http.MethodGet, url, header)
+}
+
+// Head is like Open, but only requests the headers of the download.
+func (s *FileService) Head(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	return s.open(ctx, http.MethodHead, url, header)
+}
+
+func (s *FileService) open(ctx context.Context, method, url string, header http.Header) (*http.Response, error) {
+	req, err := s.client.NewRequest(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := s.client.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified, http.StatusPreconditionFailed:
+		return resp, nil
+	}
+
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// DownloadAuthorization returns a token for downloading files from a
+// private bucket without the account credentials.
+func (s *FileService) DownloadAuthorization(ctx context.Context, authorizationRequest *DownloadAuthorizationRequest) (*DownloadAuthorization, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPost, downloadAuthURL, authorizationRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := new(DownloadAuthorization)
+	_, err = s.client.Do(req, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
 // UploadAuthorization returns the information for uploading a file.
 func (s *FileService) UploadAuthorization(ctx context.Context, uploadAuthorizationRequest *UploadAuthorizationRequest) (*UploadAuthorization, *http.Response, error) {
 	req, err := s.client.NewRequest(ctx, http.MethodPost, fileUploadURL, uploadAuthorizationRequest)
@@ -185,6 +746,22 @@ func (s *FileService) UploadPartAuthorization(ctx context.Context, authorization
 
 // Upload a file.
 func (s *FileService) Upload(ctx context.Context, uploadRequest *UploadRequest) (*File, *http.Response, error) {
+	contentType := uploadRequest.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	if err := ValidateContentType(contentType); err != nil {
+		return nil, nil, err
+	}
+
+	fileInfo := mergeFileInfo(uploadRequest.FileInfo, uploadRequest.ResponseHeaders)
+	if _, ok := fileInfo["src_last_modified_millis"]; !ok {
+		fileInfo["src_last_modified_millis"] = fmt.Sprintf("%d", uploadRequest.LastModified.Unix()*1000)
+	}
+	if err := ValidateFileInfo(uploadRequest.Key, fileInfo); err != nil {
+		return nil, nil, err
+	}
+
 	req, err := s.client.NewRequest(ctx, http.MethodPost, uploadRequest.Authorization.UploadURL, uploadRequest.Body)
 	if err != nil {
 		return nil, nil, err
@@ -194,9 +771,11 @@ func (s *FileService) Upload(ctx context.Context, uploadRequest *UploadRequest)
 
 	req.Header.Set("Authorization", uploadRequest.Authorization.Token)
 	req.Header.Set("X-Bz-File-Name", url.QueryEscape(uploadRequest.Key))
-	req.Header.Set("Content-Type", "b2/x-auto")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("X-Bz-Content-Sha1", uploadRequest.ChecksumSHA1)
-	req.Header.Set("X-Bz-Info-src_last_modified_millis", fmt.Sprintf("%d", uploadRequest.LastModified.Unix()*1000))
+	for k, v := range fileInfo {
+		req.Header.Set("X-Bz-Info-"+k, url.QueryEscape(v))
+	}
 
 	file := new(File)
 	resp, err := s.client.Do(req, file)
@@ -230,7 +809,19 @@ func (s *FileService) UploadPart(ctx context.Context, uploadRequest *UploadPartR
 }
 
 func (s *FileService) StartLargeFile(ctx context.Context, uploadRequest *StartLargeFileRequest) (*File, error) {
-	req, err := s.client.NewRequest(ctx, http.MethodPost, fileStartLargeFileURL, uploadRequest)
+	startRequest := *uploadRequest
+	startRequest.FileInfo = mergeFileInfo(uploadRequest.FileInfo, uploadRequest.ResponseHeaders)
+	if startRequest.ContentType == "" {
+		startRequest.ContentType = defaultContentType
+	}
+	if err := ValidateContentType(startRequest.ContentType); err != nil {
+		return nil, err
+	}
+	if err := ValidateFileInfo(startRequest.Filename, startRequest.FileInfo); err != nil {
+		return nil, err
+	}
+
+	req, err := s.client.NewRequest(ctx, http.MethodPost, fileStartLargeFileURL, &startRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -259,6 +850,38 @@ func (s *FileService) FinishLargeFile(ctx context.Context, uploadRequest *Finish
 	return file, nil
 }
 
+// Copy a file of at most 5 GB on the server, without downloading it.
+func (s *FileService) Copy(ctx context.Context, copyRequest *CopyFileRequest) (*File, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPost, fileCopyURL, copyRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	file := new(File)
+	_, err = s.client.Do(req, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// CopyPart copies a byte range of a file to a part of a large file.
+func (s *FileService) CopyPart(ctx context.Context, copyRequest *CopyPartRequest) (*FilePart, error) {
+	req, err := s.client.NewRequest(ctx, http.MethodPost, fileCopyPartURL, copyRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	part := new(FilePart)
+	_, err = s.client.Do(req, part)
+	if err != nil {
+		return nil, err
+	}
+
+	return part, nil
+}
+
 func (s *FileService) CancelLargeFile(ctx context.Context, uploadRequest *CancelLargeFileRequest) (*File, error) {
 	req, err := s.client.NewRequest(ctx, http.MethodPost, fileCancelLargeFileURL, uploadRequest)
 	if err != nil {
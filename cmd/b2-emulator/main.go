@@ -0,0 +1,75 @@
+// Command b2-emulator runs an in-memory B2 API server for developing and
+// testing against B2 locally. Nothing is written to disk, so all buckets and
+// files are gone once it exits.
+//
+// Point the b2 command at it with the environment variables it prints, e.g.
+//
+//	B2_API_URL=http://127.0.0.1:8700 B2_KEY_ID=emulator-key-id \
+//	B2_KEY_SECRET=emulator-key-secret B2_NO_CACHE=1 b2 list
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/romantomjak/b2/testutil"
+)
+
+// bucketsFlag collects the names of the buckets to create on start.
+type bucketsFlag []string
+
+func (f *bucketsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *bucketsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	emulator := testutil.NewEmulator()
+
+	var buckets, publicBuckets bucketsFlag
+	listen := flag.String("listen", "127.0.0.1:8700", "Address to listen on.")
+	flag.StringVar(&emulator.KeyID, "key-id", emulator.KeyID, "ID of the application key to accept.")
+	flag.StringVar(&emulator.KeySecret, "key-secret", emulator.KeySecret, "Secret part of the application key to accept.")
+	flag.Int64Var(&emulator.AbsoluteMinimumPartSize, "min-part-size", emulator.AbsoluteMinimumPartSize, "Smallest size of the parts of large files, except for the last one.")
+	flag.Int64Var(&emulator.RecommendedPartSize, "part-size", emulator.RecommendedPartSize, "Recommended size of the parts of large files.")
+	flag.Var(&buckets, "bucket", "Create a private bucket on start. Can be specified multiple times.")
+	flag.Var(&publicBuckets, "public-bucket", "Create a public bucket on start. Can be specified multiple times.")
+	flag.Parse()
+
+	for _, name := range buckets {
+		if _, err := emulator.CreateBucket(name, "allPrivate"); err != nil {
+			fatal(err)
+		}
+	}
+	for _, name := range publicBuckets {
+		if _, err := emulator.CreateBucket(name, "allPublic"); err != nil {
+			fatal(err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("B2 emulator listening on http://%s\n\n", ln.Addr())
+	fmt.Printf("export B2_API_URL=http://%s\n", ln.Addr())
+	fmt.Printf("export B2_KEY_ID=%s\n", emulator.KeyID)
+	fmt.Printf("export B2_KEY_SECRET=%s\n", emulator.KeySecret)
+	fmt.Printf("export B2_NO_CACHE=1\n")
+
+	fatal(http.Serve(ln, emulator))
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
+}
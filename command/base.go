@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"strings"
+	"text/template"
 
 	"github.com/mitchellh/cli"
 	"github.com/romantomjak/b2/b2"
@@ -14,18 +15,53 @@ type baseCommand struct {
 	ui     cli.Ui
 	client *b2.Client
 
+	// Cache used by new clients instead of the disk cache.
+	cache b2.Cache
+
+	// Extra options for new clients, e.g. to talk to a test server.
+	clientOpts []b2.ClientOpt
+
 	// Whether to disable disk cache
 	noCache bool
 
 	keyId     string
 	keySecret string
+
+	// File to read the secret part of the key from.
+	keySecretFile string
+
+	// Command that prints the key as JSON.
+	credentialProcess string
+
+	// Name of the profile to read defaults from.
+	profile string
+
+	// Location of the configuration file. Empty means the default
+	// location is used.
+	configPath string
+
+	// Bucket used for paths starting with "/".
+	bucket string
+
+	// Shell the command is run from, if any. Paths are relative to its
+	// current folder.
+	shell *shellSession
+
+	// Output format and template for results.
+	format   string
+	template string
+	tmpl     *template.Template
 }
 
 func (c *baseCommand) flagSet() *flag.FlagSet {
 	fs := flag.NewFlagSet("Global Options", flag.ContinueOnError)
 	fs.StringVar(&c.keyId, "key-id", "", "")
 	fs.StringVar(&c.keySecret, "key-secret", "", "")
+	fs.StringVar(&c.keySecretFile, "key-secret-file", "", "")
 	fs.BoolVar(&c.noCache, "no-cache", false, "")
+	fs.StringVar(&c.profile, "profile", "", "")
+	fs.StringVar(&c.format, "format", formatText, "")
+	fs.StringVar(&c.template, "template", "", "")
 
 	// try to get credentials from environment
 	if c.keyId == "" {
@@ -34,6 +70,9 @@ func (c *baseCommand) flagSet() *flag.FlagSet {
 	if c.keySecret == "" {
 		c.keySecret = os.Getenv("B2_KEY_SECRET")
 	}
+	if c.keySecretFile == "" {
+		c.keySecretFile = os.Getenv("B2_KEY_SECRET_FILE")
+	}
 
 	// check if cache is disabled via environment
 	if c.noCache == false {
@@ -50,16 +89,41 @@ func (c *baseCommand) generalOptions() string {
 	helpText := `
   -key-id
     The ID of the application key. Overrides the
-    B2_KEY_ID environment variable if set.
+    B2_KEY_ID environment variable if set. The key of
+    the profile is only used if neither the ID nor the
+    secret of a key is given otherwise.
 
   -key-secret
     The secret part of the application key. Overrides
     the B2_KEY_SECRET environment variable if set.
 
+  -key-secret-file=<path>
+    Read the secret part of the application key from a file,
+    which keeps it out of the shell history. Overrides the
+    B2_KEY_SECRET_FILE environment variable if set.
+
   -no-cache
     Disable disk cache. This is highly not recommended, but
     might come handy when leaving a trace on disk is unwise.
     Alternatively, B2_NO_CACHE may be set.
+
+  -format=<format>
+    Output format of the results. Either "text" for humans,
+    "json" for a single JSON document, "jsonl" for a JSON
+    object per line or "template" for -template. Defaults
+    to "text".
+
+  -profile=<name>
+    The profile in the configuration file to read credentials
+    and default options from. Overrides the B2_PROFILE
+    environment variable if set. Options given on the command
+    line take precedence over environment variables, which take
+    precedence over the profile.
+
+  -template=<template>
+    Print each result through a Go text/template, e.g.
+    '{{.FileName}} {{.ContentLength}}'. Implies
+    -format=template.
 `
 	return strings.TrimSpace(helpText)
 }
@@ -69,6 +133,10 @@ func (c *baseCommand) Client() (*b2.Client, error) {
 		return c.client, nil
 	}
 
+	if err := c.resolveCredentials(); err != nil {
+		return nil, err
+	}
+
 	opts := []b2.ClientOpt{}
 
 	// disk cache is disabled, so we'll replace it with an
@@ -79,8 +147,17 @@ func (c *baseCommand) Client() (*b2.Client, error) {
 			return nil, err
 		}
 		opts = append(opts, b2.SetCache(cache))
+	} else if c.cache != nil {
+		opts = append(opts, b2.SetCache(c.cache))
 	}
 
+	// The API can be replaced with a compatible server, e.g. the emulator
+	if apiURL := os.Getenv("B2_API_URL"); apiURL != "" {
+		opts = append(opts, b2.SetBaseURL(apiURL))
+	}
+
+	opts = append(opts, c.clientOpts...)
+
 	client, err := b2.NewClient(c.keyId, c.keySecret, opts...)
 	if err != nil {
 		return nil, err
@@ -90,3 +167,18 @@ func (c *baseCommand) Client() (*b2.Client, error) {
 
 	return c.client, nil
 }
+
+// clearCache drops everything cached for the key, such as its authorization
+// and bucket IDs.
+func (c *baseCommand) clearCache(keyID string) error {
+	cache := c.cache
+	if cache == nil {
+		diskCache, err := b2.DefaultDiskCache()
+		if err != nil {
+			return err
+		}
+		cache = diskCache
+	}
+
+	return b2.ClearCache(cache, keyID)
+}
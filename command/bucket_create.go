@@ -46,7 +46,7 @@ func (c *CreateBucketCommand) Run(args []string) int {
 	flags.Usage = func() { c.ui.Output(c.Help()) }
 	flags.StringVar(&bucketType, "type", "private", "Change bucket type")
 
-	if err := flags.Parse(args); err != nil {
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
 		return 1
 	}
 
@@ -84,7 +84,12 @@ func (c *CreateBucketCommand) Run(args []string) int {
 		return 1
 	}
 
-	c.ui.Output(fmt.Sprintf("Bucket %q created with ID %q", bucket.Name, bucket.ID))
+	out := c.newPrinter(false)
+	out.print(fmt.Sprintf("Bucket %q created with ID %q", bucket.Name, bucket.ID), bucket)
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
 
 	return 0
 }
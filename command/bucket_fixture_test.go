@@ -0,0 +1,198 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+)
+
+// testBucket keeps the versions of the files in a bucket, so that commands
+// can be run against it more than once.
+type testBucket struct {
+	mu sync.Mutex
+
+	// Versions of all files sorted by name and from the newest to the
+	// oldest.
+	versions []b2.File
+
+	copied  []string
+	deleted []string
+
+	// Whether copies get a different checksum than their source.
+	corrupt bool
+
+	nextID int
+}
+
+func (b *testBucket) add(file b2.File) b2.File {
+	b.nextID++
+	if file.FileID == "" {
+		file.FileID = fmt.Sprintf("id-%d", b.nextID)
+	}
+	if file.Action == "" {
+		file.Action = "upload"
+	}
+
+	b.versions = append([]b2.File{file}, b.versions...)
+	sort.SliceStable(b.versions, func(i, j int) bool {
+		return b.versions[i].FileName < b.versions[j].FileName
+	})
+	return file
+}
+
+// list returns the versions under the prefix, or only the latest visible
+// versions if latest is set.
+func (b *testBucket) list(prefix, start string, max int, latest bool) []b2.File {
+	files := []b2.File{}
+	seen := make(map[string]bool)
+	for _, file := range b.versions {
+		if !strings.HasPrefix(file.FileName, prefix) || file.FileName < start {
+			continue
+		}
+		if latest {
+			if seen[file.FileName] {
+				continue
+			}
+			seen[file.FileName] = true
+			if file.Action != "upload" {
+				continue
+			}
+		}
+		files = append(files, file)
+		if max > 0 && len(files) == max {
+			break
+		}
+	}
+	return files
+}
+
+// foldFolders replaces the files in folders below the prefix with a single
+// "folder" version per folder, like listing with a delimiter does.
+func foldFolders(files []b2.File, prefix, delimiter string) []b2.File {
+	if delimiter == "" {
+		return files
+	}
+
+	folded := []b2.File{}
+	for _, file := range files {
+		i := strings.Index(strings.TrimPrefix(file.FileName, prefix), delimiter)
+		if i < 0 {
+			folded = append(folded, file)
+			continue
+		}
+		name := file.FileName[:len(prefix)+i+len(delimiter)]
+		if n := len(folded); n > 0 && folded[n-1].FileName == name {
+			continue
+		}
+		folded = append(folded, b2.File{Action: "folder", FileName: name})
+	}
+	return folded
+}
+
+func newTestBucketServer(t *testing.T, bucket *testBucket) *b2.Client {
+	server, mux := testutil.NewServer()
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.BucketListRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		if req.Name != "" && req.Name != "my-bucket" {
+			fmt.Fprint(w, `{"buckets": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "1", "bucketName": "my-bucket"}]}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.FileListRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		bucket.mu.Lock()
+		defer bucket.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": foldFolders(bucket.list(req.Prefix, req.StartFileName, req.MaxFileCount, true), req.Prefix, req.Delimiter),
+		})
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_list_file_versions", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.FileVersionListRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		bucket.mu.Lock()
+		defer bucket.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": bucket.list(req.Prefix, req.StartFileName, req.MaxFileCount, false),
+		})
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_copy_file", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.CopyFileRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		bucket.mu.Lock()
+		defer bucket.mu.Unlock()
+		for _, file := range bucket.versions {
+			if file.FileID != req.SourceFileID {
+				continue
+			}
+			copied := file
+			copied.FileID = ""
+			copied.FileName = req.FileName
+			if bucket.corrupt {
+				copied.ContentSHA1 = "0000000000000000000000000000000000000000"
+			}
+			bucket.copied = append(bucket.copied, req.FileName)
+			json.NewEncoder(w).Encode(bucket.add(copied))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"status": 404, "code": "not_found", "message": "source file not found"}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_delete_file_version", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.DeleteFileVersionRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		bucket.mu.Lock()
+		defer bucket.mu.Unlock()
+		for i, file := range bucket.versions {
+			if file.FileID == req.FileID {
+				bucket.versions = append(bucket.versions[:i], bucket.versions[i+1:]...)
+				break
+			}
+		}
+		bucket.deleted = append(bucket.deleted, req.FileID)
+		fmt.Fprintf(w, `{"fileId": %q, "fileName": %q}`, req.FileID, req.FileName)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_hide_file", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.HideFileRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		bucket.mu.Lock()
+		defer bucket.mu.Unlock()
+		json.NewEncoder(w).Encode(bucket.add(b2.File{Action: "hide", FileName: req.FileName}))
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_get_download_authorization", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.DownloadAuthorizationRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		fmt.Fprintf(w, `{"authorizationToken": "token-for-%s-%d"}`, req.FileNamePrefix, req.ValidDurationInSeconds)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	return client
+}
@@ -0,0 +1,206 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+type CatCommand struct {
+	*baseCommand
+
+	// Byte range of each file to print, e.g. "100-199".
+	byteRange string
+
+	// Number of bytes to print from the start or the end of each file.
+	head sizeValue
+	tail sizeValue
+
+	// Where the files are written to. Defaults to os.Stdout.
+	stdout io.Writer
+}
+
+func (c *CatCommand) Help() string {
+	helpText := `
+Usage: b2 cat [options] <path>...
+
+  Prints the contents of one or more files, e.g. "my-bucket/logs/app.log",
+  to standard output. Only the requested bytes are downloaded, so the end
+  of a large file can be printed without downloading all of it.
+
+General Options:
+
+  ` + c.generalOptions() + `
+
+Cat Options:
+
+  -head=<size>
+    Print the first bytes of each file, e.g. "1024" or "10K".
+
+  -range=<start>-[<end>]
+    Print the bytes from start to end of each file, where the first
+    byte is 0 and end is included, e.g. "100-199". Without end, the
+    rest of the file is printed.
+
+  -tail=<size>
+    Print the last bytes of each file, e.g. "1024" or "10K".
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *CatCommand) Synopsis() string {
+	return "Print the contents of files"
+}
+
+func (c *CatCommand) Name() string { return "cat" }
+
+func (c *CatCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.StringVar(&c.byteRange, "range", "", "")
+	flags.Var(&c.head, "head", "")
+	flags.Var(&c.tail, "tail", "")
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got at least one argument
+	args = flags.Args()
+	if len(args) == 0 {
+		c.ui.Error("This command takes one or more arguments: <path>...")
+		return 1
+	}
+
+	byteRange, err := c.httpRange()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	// Resolve the paths before downloading anything
+	paths := make([]string, len(args))
+	for i, arg := range args {
+		p, err := c.bucketPath(arg)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+		_, filename := splitBucketAndPrefix(p)
+		if filename == "" || strings.HasSuffix(filename, "/") {
+			c.ui.Error(fmt.Sprintf("Error: %s is not a file", arg))
+			return 1
+		}
+		paths[i] = p
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	stdout := c.stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+
+	ctx := context.TODO()
+
+	// Like cat, carry on with the remaining files if one of them fails
+	code := 0
+	for _, p := range paths {
+		bucketName, filename := splitBucketAndPrefix(p)
+		err := catFile(ctx, client, bucketName, filename, byteRange, stdout)
+
+		// The head or tail of an empty file can't be downloaded, but
+		// there's simply nothing to print
+		if errors.Is(err, b2.ErrRangeNotSatisfiable) && c.byteRange == "" {
+			err = nil
+		}
+
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %s: %v", p, err))
+			code = 1
+		}
+	}
+
+	return code
+}
+
+// httpRange returns the HTTP range selected by -range, -head or -tail,
+// or an empty string to print whole files.
+func (c *CatCommand) httpRange() (string, error) {
+	set := 0
+	for _, ok := range []bool{c.byteRange != "", c.head.set, c.tail.set} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return "", errors.New("only one of -range, -head and -tail can be used")
+	}
+
+	switch {
+	case c.byteRange != "":
+		return parseByteRange(c.byteRange)
+	case c.head.set:
+		if c.head.bytes < 1 {
+			return "", errors.New("-head must be at least 1 byte")
+		}
+		return fmt.Sprintf("bytes=0-%d", c.head.bytes-1), nil
+	case c.tail.set:
+		if c.tail.bytes < 1 {
+			return "", errors.New("-tail must be at least 1 byte")
+		}
+		return fmt.Sprintf("bytes=-%d", c.tail.bytes), nil
+	}
+
+	return "", nil
+}
+
+// parseByteRange converts ranges like "100-199" or "100-" into HTTP ranges.
+func parseByteRange(s string) (string, error) {
+	invalid := fmt.Errorf("invalid -range %q, must be <start>-[<end>]", s)
+
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return "", invalid
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return "", invalid
+	}
+
+	if parts[1] == "" {
+		return fmt.Sprintf("bytes=%d-", start), nil
+	}
+
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < start {
+		return "", invalid
+	}
+
+	return fmt.Sprintf("bytes=%d-%d", start, end), nil
+}
+
+// catFile writes the file, or the byte range of it, to w.
+func catFile(ctx context.Context, client *b2.Client, bucketName, filename, byteRange string, w io.Writer) error {
+	uri := downloadURL(client, bucketName, filename)
+
+	// See https://github.com/golang/go/issues/16474
+	if byteRange == "" {
+		_, err := client.File.Download(ctx, uri, struct{ io.Writer }{w})
+		return err
+	}
+
+	_, err := client.File.DownloadRange(ctx, uri, byteRange, struct{ io.Writer }{w})
+	return err
+}
@@ -0,0 +1,110 @@
+package command
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCatTestServer(t *testing.T) *b2.Client {
+	server, mux := testutil.NewServer()
+	t.Cleanup(server.Close)
+
+	files := map[string]string{
+		"/file/my-bucket/logs/app.log": "first line\nsecond line\nlast line\n",
+		"/file/my-bucket/empty.txt":    "",
+	}
+	mux.HandleFunc("/file/my-bucket/", func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status": 404, "code": "not_found", "message": "File with such name does not exist."}`))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestCatCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		out  string
+	}{
+		{"whole file", []string{"my-bucket/logs/app.log"}, "first line\nsecond line\nlast line\n"},
+		{"head", []string{"-head", "5", "my-bucket/logs/app.log"}, "first"},
+		{"tail", []string{"-tail", "10", "my-bucket/logs/app.log"}, "last line\n"},
+		{"range", []string{"-range", "6-9", "my-bucket/logs/app.log"}, "line"},
+		{"open range", []string{"-range", "23-", "my-bucket/logs/app.log"}, "last line\n"},
+		{"tail of empty file", []string{"-tail", "10", "my-bucket/empty.txt", "my-bucket/logs/app.log"}, "last line\n"},
+		{"multiple files", []string{"-head", "6", "my-bucket/logs/app.log", "my-bucket/logs/app.log"}, "first first "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			ui := cli.NewMockUi()
+			cmd := &CatCommand{
+				baseCommand: &baseCommand{ui: ui, client: newCatTestServer(t)},
+				stdout:      &stdout,
+			}
+
+			code := cmd.Run(tt.args)
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			assert.Equal(t, tt.out, stdout.String())
+		})
+	}
+}
+
+func TestCatCommand_ContinuesAfterErrors(t *testing.T) {
+	var stdout bytes.Buffer
+	ui := cli.NewMockUi()
+	cmd := &CatCommand{
+		baseCommand: &baseCommand{ui: ui, client: newCatTestServer(t)},
+		stdout:      &stdout,
+	}
+
+	code := cmd.Run([]string{"-range", "100-", "my-bucket/missing.txt", "my-bucket/logs/app.log"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "my-bucket/missing.txt: ")
+	assert.Contains(t, ui.ErrorWriter.String(), "my-bucket/logs/app.log: range not satisfiable")
+	assert.Empty(t, stdout.String())
+}
+
+func TestCatCommand_InvalidRange(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-range", "9-5", "my-bucket/a.txt"}, `invalid -range "9-5"`},
+		{[]string{"-range", "-5", "my-bucket/a.txt"}, `invalid -range "-5"`},
+		{[]string{"-head", "5", "-tail", "5", "my-bucket/a.txt"}, "only one of -range, -head and -tail can be used"},
+		{[]string{"-head", "0", "my-bucket/a.txt"}, "-head must be at least 1 byte"},
+		{[]string{"my-bucket/logs/"}, "my-bucket/logs/ is not a file"},
+	}
+
+	for _, tt := range tests {
+		ui := cli.NewMockUi()
+		cmd := &CatCommand{
+			baseCommand: &baseCommand{ui: ui},
+		}
+
+		code := cmd.Run(tt.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tt.err)
+	}
+}
@@ -11,12 +11,33 @@ func Commands(ui cli.Ui) map[string]cli.CommandFactory {
 		ui: ui,
 	}
 
+	return commandFactories(baseCommand)
+}
+
+// commandFactories returns the mapping of CLI commands sharing the base
+// command.
+func commandFactories(baseCommand *baseCommand) map[string]cli.CommandFactory {
 	commands := map[string]cli.CommandFactory{
+		"cat": func() (cli.Command, error) {
+			return &CatCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
 		"create": func() (cli.Command, error) {
 			return &CreateBucketCommand{
 				baseCommand: baseCommand,
 			}, nil
 		},
+		"du": func() (cli.Command, error) {
+			return &DiskUsageCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"find": func() (cli.Command, error) {
+			return &FindCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
 		"list": func() (cli.Command, error) {
 			return &ListCommand{
 				baseCommand: baseCommand,
@@ -27,11 +48,56 @@ func Commands(ui cli.Ui) map[string]cli.CommandFactory {
 				baseCommand: baseCommand,
 			}, nil
 		},
+		"login": func() (cli.Command, error) {
+			return &LoginCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"logout": func() (cli.Command, error) {
+			return &LogoutCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"mv": func() (cli.Command, error) {
+			return &MoveCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
 		"put": func() (cli.Command, error) {
 			return &PutCommand{
 				baseCommand: baseCommand,
 			}, nil
 		},
+		"serve": func() (cli.Command, error) {
+			return &ServeCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"serve http": func() (cli.Command, error) {
+			return &ServeHTTPCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"shell": func() (cli.Command, error) {
+			return &ShellCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"stat": func() (cli.Command, error) {
+			return &StatCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"sync": func() (cli.Command, error) {
+			return &SyncCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
+		"tree": func() (cli.Command, error) {
+			return &TreeCommand{
+				baseCommand: baseCommand,
+			}, nil
+		},
 		"version": func() (cli.Command, error) {
 			return &VersionCommand{
 				baseCommand: baseCommand,
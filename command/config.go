@@ -0,0 +1,321 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const defaultProfileName = "default"
+
+// config is the contents of the configuration file.
+type config struct {
+	// Profile is the name of the profile used when none is selected with
+	// -profile or B2_PROFILE. Defaults to "default".
+	Profile string `json:"profile,omitempty"`
+
+	// Profiles holds the named profiles.
+	Profiles map[string]*profile `json:"profiles,omitempty"`
+}
+
+// profile holds credentials and default options for the commands.
+type profile struct {
+	KeyID     string `json:"key_id,omitempty"`
+	KeySecret string `json:"key_secret,omitempty"`
+
+	// KeySecretFile is a file holding the secret part of the key.
+	KeySecretFile string `json:"key_secret_file,omitempty"`
+
+	// CredentialProcess is a command that prints the key as JSON, e.g.
+	// {"key_id": "...", "key_secret": "..."}.
+	CredentialProcess string `json:"credential_process,omitempty"`
+
+	// Bucket is used for paths starting with "/", e.g. "/photos/cat.jpg".
+	Bucket string `json:"bucket,omitempty"`
+
+	NoCache bool `json:"no_cache,omitempty"`
+
+	// Options are default values of flags for all commands, keyed by the
+	// flag name, e.g. "concurrency".
+	Options map[string]optionValue `json:"options,omitempty"`
+
+	// Commands are default values of flags for a single command, keyed by
+	// the command name. They take precedence over Options.
+	Commands map[string]map[string]optionValue `json:"commands,omitempty"`
+}
+
+// option returns the default value of the flag for the named command.
+func (p *profile) option(command, name string) (string, bool) {
+	if value, ok := p.Commands[command][name]; ok {
+		return string(value), true
+	}
+	value, ok := p.Options[name]
+	return string(value), ok
+}
+
+// optionValue is the value of a flag in the configuration file. It may be
+// written as a string, a number or a boolean, e.g. "100M", 8 or true.
+type optionValue string
+
+func (v *optionValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = optionValue(s)
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch value.(type) {
+	case float64, bool:
+		// Keep numbers exactly as they were written, e.g. 100000000
+		// instead of 1e+08.
+		*v = optionValue(data)
+		return nil
+	}
+
+	return fmt.Errorf("option value must be a string, number or boolean, got %s", data)
+}
+
+// defaultConfigPath returns the location of the configuration file, which
+// may be changed with B2_CONFIG.
+func defaultConfigPath() (string, error) {
+	if path := os.Getenv("B2_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "b2", "config.json"), nil
+}
+
+// loadConfig reads the configuration file. A missing file results in an
+// empty configuration.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// saveConfig atomically replaces the configuration file. The file is only
+// readable by the user, because it may contain secrets.
+func saveConfig(path string, cfg *config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// parseFlags parses the command line arguments and fills in everything that
+// was not set on the command line from the environment and the selected
+// profile, in this order.
+//
+// Errors are reported to the user, so callers only need to exit.
+func (c *baseCommand) parseFlags(fs *flag.FlagSet, command string, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := c.checkShellFlags(fs); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return err
+	}
+
+	if err := c.applyProfile(fs, command); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return err
+	}
+
+	if err := c.parseOutputFormat(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return err
+	}
+
+	return nil
+}
+
+// accountFlags select the account and credentials that commands use.
+var accountFlags = []string{"key-id", "key-secret", "key-secret-file", "no-cache", "profile"}
+
+// checkShellFlags rejects account flags in the shell, where all commands
+// share the client that the shell authorized.
+func (c *baseCommand) checkShellFlags(fs *flag.FlagSet) error {
+	if c.shell == nil {
+		return nil
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range accountFlags {
+			if err == nil && f.Name == name {
+				err = fmt.Errorf("-%s can't be used in the shell, start the shell with it instead", name)
+			}
+		}
+	})
+	return err
+}
+
+// applyProfile sets flags that were not given on the command line to the
+// defaults of the selected profile.
+func (c *baseCommand) applyProfile(fs *flag.FlagSet, command string) error {
+	path, cfg, err := c.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	name, selected := c.profileName(cfg)
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		// Running without a configuration file is fine, unless a profile
+		// was asked for explicitly.
+		if selected || cfg.Profile != "" {
+			return fmt.Errorf("profile %q not found in %s", name, path)
+		}
+		return nil
+	}
+
+	// Credentials from flags and the environment are already set. The key
+	// ID and the secret are taken from the same place, so that a key ID is
+	// never paired with the secret of another key.
+	if c.keyId == "" && c.keySecret == "" && c.keySecretFile == "" {
+		c.keyId = p.KeyID
+		c.keySecret = p.KeySecret
+		c.keySecretFile = p.KeySecretFile
+		c.credentialProcess = p.CredentialProcess
+	}
+	if p.NoCache {
+		c.noCache = true
+	}
+	c.bucket = p.Bucket
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	sort.Strings(names)
+
+	for _, flagName := range names {
+		if set[flagName] || globalFlags[flagName] {
+			continue
+		}
+		value, ok := p.option(command, flagName)
+		if !ok {
+			continue
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return fmt.Errorf("profile %q: invalid value %q for option %q: %v", name, value, flagName, err)
+		}
+	}
+
+	return nil
+}
+
+// loadConfig reads the configuration file and returns its location.
+func (c *baseCommand) loadConfig() (string, *config, error) {
+	path := c.configPath
+	if path == "" {
+		var err error
+		if path, err = defaultConfigPath(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return path, cfg, nil
+}
+
+// profileName returns the name of the profile to use and whether it was
+// selected explicitly with -profile or B2_PROFILE.
+func (c *baseCommand) profileName(cfg *config) (string, bool) {
+	if c.profile != "" {
+		return c.profile, true
+	}
+	if name := os.Getenv("B2_PROFILE"); name != "" {
+		return name, true
+	}
+	if cfg.Profile != "" {
+		return cfg.Profile, false
+	}
+	return defaultProfileName, false
+}
+
+// globalFlags are configured through dedicated profile fields rather than
+// options.
+var globalFlags = map[string]bool{
+	"key-id":          true,
+	"key-secret":      true,
+	"key-secret-file": true,
+	"no-cache":        true,
+	"profile":         true,
+}
+
+// bucketPath expands paths starting with "/" to paths in the default bucket
+// of the profile, e.g. "/photos/" to "my-bucket/photos/". Inside the shell,
+// paths are resolved against the current folder instead.
+func (c *baseCommand) bucketPath(path string) (string, error) {
+	if c.shell != nil {
+		return c.shell.resolve(path), nil
+	}
+	if len(path) == 0 || path[0] != '/' {
+		return path, nil
+	}
+	if c.bucket == "" {
+		return "", errors.New("no default bucket is configured for paths starting with \"/\"")
+	}
+	return c.bucket + path, nil
+}
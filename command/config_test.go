@@ -0,0 +1,200 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Make sure the configuration of whoever runs the tests is not used.
+	os.Setenv("B2_CONFIG", filepath.Join(os.TempDir(), "b2-cli-test-missing-config.json"))
+	os.Unsetenv("B2_PROFILE")
+	os.Unsetenv("B2_KEY_ID")
+	os.Unsetenv("B2_KEY_SECRET")
+
+	os.Exit(m.Run())
+}
+
+func writeTestConfig(t *testing.T, cfg string) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(cfg), 0600))
+
+	return path
+}
+
+const testConfig = `{
+	"profiles": {
+		"default": {
+			"key_id": "default-key-id",
+			"key_secret": "default-key-secret",
+			"options": {"concurrency": 8}
+		},
+		"work": {
+			"key_id": "work-key-id",
+			"key_secret": "work-key-secret",
+			"bucket": "work-bucket",
+			"options": {"concurrency": 8, "delete": "keep"},
+			"commands": {
+				"sync": {"concurrency": 16, "delete": "hide", "dry-run": true}
+			}
+		}
+	}
+}`
+
+func TestConfig_Precedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		keyID       string
+		concurrency int
+		deleteMode  string
+		dryRun      bool
+	}{
+		{
+			name:        "default profile",
+			keyID:       "default-key-id",
+			concurrency: 8,
+			deleteMode:  "keep",
+		},
+		{
+			name:        "command options override profile options",
+			args:        []string{"-profile", "work"},
+			keyID:       "work-key-id",
+			concurrency: 16,
+			deleteMode:  "hide",
+			dryRun:      true,
+		},
+		{
+			name:        "profile from environment",
+			env:         map[string]string{"B2_PROFILE": "work"},
+			keyID:       "work-key-id",
+			concurrency: 16,
+			deleteMode:  "hide",
+			dryRun:      true,
+		},
+		{
+			name:        "flags override profile",
+			args:        []string{"-profile", "work", "-concurrency", "2", "-dry-run=false", "-key-id", "flag-key-id"},
+			keyID:       "flag-key-id",
+			concurrency: 2,
+			deleteMode:  "hide",
+		},
+		{
+			name:        "environment overrides profile",
+			env:         map[string]string{"B2_KEY_ID": "env-key-id"},
+			keyID:       "env-key-id",
+			concurrency: 8,
+			deleteMode:  "keep",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			c := &SyncCommand{
+				baseCommand: &baseCommand{ui: cli.NewMockUi(), configPath: writeTestConfig(t, testConfig)},
+			}
+
+			flags := c.flagSet()
+			flags.IntVar(&c.concurrency, "concurrency", 4, "")
+			flags.StringVar(&c.deleteMode, "delete", deleteModeKeep, "")
+			flags.BoolVar(&c.dryRun, "dry-run", false, "")
+
+			require.NoError(t, c.parseFlags(flags, c.Name(), tt.args))
+			assert.Equal(t, tt.keyID, c.keyId)
+			assert.Equal(t, tt.concurrency, c.concurrency)
+			assert.Equal(t, tt.deleteMode, c.deleteMode)
+			assert.Equal(t, tt.dryRun, c.dryRun)
+		})
+	}
+}
+
+func TestConfig_MissingProfile(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := &baseCommand{ui: ui, configPath: writeTestConfig(t, testConfig)}
+
+	flags := c.flagSet()
+	err := c.parseFlags(flags, "list", []string{"-profile", "home"})
+	assert.Error(t, err)
+	assert.Contains(t, ui.ErrorWriter.String(), `profile "home" not found`)
+}
+
+func TestConfig_InvalidOption(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := &PutCommand{
+		baseCommand: &baseCommand{ui: ui, configPath: writeTestConfig(t, `{
+			"profiles": {"default": {"options": {"concurrency": "lots"}}}
+		}`)},
+	}
+
+	code := c.Run([]string{"a.txt", "my-bucket/"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), `invalid value "lots" for option "concurrency"`)
+}
+
+func TestConfig_OptionValues(t *testing.T) {
+	var values map[string]optionValue
+	err := json.Unmarshal([]byte(`{"a": "100M", "b": 100000000, "c": true}`), &values)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]optionValue{"a": "100M", "b": "100000000", "c": "true"}, values)
+
+	err = json.Unmarshal([]byte(`{"a": ["x"]}`), &values)
+	assert.Error(t, err)
+}
+
+func TestConfig_DefaultBucket(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "1", "bucketName": "work-bucket"}]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		var req b2.FileListRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "1", req.BucketID)
+		assert.Equal(t, "photos/", req.Prefix)
+		fmt.Fprint(w, `{"files": [{"action": "upload", "fileName": "photos/cat.jpg"}]}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &ListCommand{
+		baseCommand: &baseCommand{ui: ui, client: client, configPath: writeTestConfig(t, testConfig)},
+	}
+
+	code := cmd.Run([]string{"-profile", "work", "/photos/"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "photos/cat.jpg")
+
+	// Without a default bucket, the path can't be resolved
+	ui = cli.NewMockUi()
+	cmd = &ListCommand{
+		baseCommand: &baseCommand{ui: ui, client: client, configPath: writeTestConfig(t, testConfig)},
+	}
+
+	code = cmd.Run([]string{"/photos/"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "no default bucket is configured")
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// processCredentials is what a credential process prints to stdout.
+type processCredentials struct {
+	KeyID     string `json:"key_id"`
+	KeySecret string `json:"key_secret"`
+}
+
+// resolveCredentials obtains the secret part of the key from a file or a
+// credential process, unless it was given directly.
+func (c *baseCommand) resolveCredentials() error {
+	// Either half of a key from flags or the environment keeps the other
+	// half of the profile from being used, see applyProfile.
+	if c.keyId != "" && c.keySecret == "" && c.keySecretFile == "" && c.credentialProcess == "" {
+		return errors.New("a key ID was given without a key secret, set -key-secret, -key-secret-file or B2_KEY_SECRET")
+	}
+	if c.keyId == "" && (c.keySecret != "" || c.keySecretFile != "") {
+		return errors.New("a key secret was given without a key ID, set -key-id or B2_KEY_ID")
+	}
+
+	if c.keySecret != "" {
+		return nil
+	}
+
+	if c.keySecretFile != "" {
+		secret, err := readSecretFile(c.keySecretFile)
+		if err != nil {
+			return err
+		}
+		c.keySecret = secret
+		return nil
+	}
+
+	if c.credentialProcess != "" {
+		creds, err := runCredentialProcess(c.credentialProcess)
+		if err != nil {
+			return err
+		}
+		if c.keyId == "" {
+			c.keyId = creds.KeyID
+		}
+		c.keySecret = creds.KeySecret
+	}
+
+	return nil
+}
+
+// readSecretFile returns the contents of the file without the trailing
+// newline most editors add.
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read key secret: %v", err)
+	}
+
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("read key secret: %s is empty", path)
+	}
+
+	return secret, nil
+}
+
+// runCredentialProcess runs the command with the system shell and parses
+// the credentials it prints to stdout as JSON.
+//
+// The process inherits stdin and stderr, so it may prompt for a password,
+// e.g. to unlock a password manager.
+func runCredentialProcess(command string) (*processCredentials, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credential process: %v", err)
+	}
+
+	creds := new(processCredentials)
+	if err := json.Unmarshal(stdout.Bytes(), creds); err != nil {
+		// Don't include the output, it likely contains the secret.
+		return nil, errors.New("credential process: output is not valid JSON")
+	}
+
+	if creds.KeySecret == "" {
+		return nil, errors.New("credential process: key_secret is missing")
+	}
+
+	return creds, nil
+}
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentials_SecretFile(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("file-secret\n"), 0600))
+
+	c := &baseCommand{ui: cli.NewMockUi()}
+	flags := c.flagSet()
+	require.NoError(t, c.parseFlags(flags, "list", []string{"-key-id", "key-id", "-key-secret-file", secretFile}))
+
+	require.NoError(t, c.resolveCredentials())
+	assert.Equal(t, "key-id", c.keyId)
+	assert.Equal(t, "file-secret", c.keySecret)
+
+	c = &baseCommand{ui: cli.NewMockUi(), keyId: "key-id", keySecretFile: filepath.Join(dir, "missing")}
+	assert.Error(t, c.resolveCredentials())
+}
+
+func TestCredentials_CredentialProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands require a POSIX shell")
+	}
+
+	tests := []struct {
+		name         string
+		command      string
+		profileKeyID string
+		keyID        string
+		keySecret    string
+		err          string
+	}{
+		{
+			name:      "key id and secret",
+			command:   `echo '{"key_id": "process-key-id", "key_secret": "process-secret"}'`,
+			keyID:     "process-key-id",
+			keySecret: "process-secret",
+		},
+		{
+			name:         "key id from profile",
+			command:      `echo '{"key_secret": "process-secret"}'`,
+			profileKeyID: "profile-key-id",
+			keyID:        "profile-key-id",
+			keySecret:    "process-secret",
+		},
+		{
+			name:    "failing process",
+			command: `exit 3`,
+			err:     "exit status 3",
+		},
+		{
+			name:    "invalid output",
+			command: `echo process-secret`,
+			err:     "output is not valid JSON",
+		},
+		{
+			name:    "missing secret",
+			command: `echo '{}'`,
+			err:     "key_secret is missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := json.Marshal(config{
+				Profiles: map[string]*profile{
+					"default": {KeyID: tt.profileKeyID, CredentialProcess: tt.command},
+				},
+			})
+			require.NoError(t, err)
+
+			c := &baseCommand{ui: cli.NewMockUi(), configPath: writeTestConfig(t, string(cfg))}
+			flags := c.flagSet()
+			require.NoError(t, c.parseFlags(flags, "list", nil))
+
+			err = c.resolveCredentials()
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				assert.NotContains(t, err.Error(), "process-secret")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.keyID, c.keyId)
+			assert.Equal(t, tt.keySecret, c.keySecret)
+		})
+	}
+}
+
+func TestCredentials_SecretTakesPrecedence(t *testing.T) {
+	cfg := `{"profiles": {"default": {"key_secret_file": "/nonexistent", "credential_process": "exit 1"}}}`
+
+	t.Setenv("B2_KEY_ID", "env-key-id")
+	t.Setenv("B2_KEY_SECRET", "env-secret")
+
+	c := &baseCommand{ui: cli.NewMockUi(), configPath: writeTestConfig(t, cfg)}
+	flags := c.flagSet()
+	require.NoError(t, c.parseFlags(flags, "list", nil))
+
+	require.NoError(t, c.resolveCredentials())
+	assert.Equal(t, "env-secret", c.keySecret)
+}
+
+func TestCredentials_AreNotMixedWithProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		keyID     string
+		keySecret string
+		err       string
+	}{
+		{
+			name:      "profile",
+			keyID:     "default-key-id",
+			keySecret: "default-key-secret",
+		},
+		{
+			name:      "environment",
+			env:       map[string]string{"B2_KEY_ID": "env-key-id", "B2_KEY_SECRET": "env-secret"},
+			keyID:     "env-key-id",
+			keySecret: "env-secret",
+		},
+		{
+			name: "key ID without secret",
+			env:  map[string]string{"B2_KEY_ID": "env-key-id"},
+			err:  "a key ID was given without a key secret",
+		},
+		{
+			name: "secret without key ID",
+			env:  map[string]string{"B2_KEY_SECRET": "env-secret"},
+			err:  "a key secret was given without a key ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			c := &baseCommand{ui: cli.NewMockUi(), configPath: writeTestConfig(t, testConfig)}
+			flags := c.flagSet()
+			require.NoError(t, c.parseFlags(flags, "list", nil))
+
+			err := c.resolveCredentials()
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.keyID, c.keyId)
+			assert.Equal(t, tt.keySecret, c.keySecret)
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+type DiskUsageCommand struct {
+	*baseCommand
+
+	// How many levels of folders below the path are totaled separately.
+	depth int
+
+	// Whether to print sizes in K, M, G, etc. rather than bytes.
+	human bool
+
+	// Whether to count hidden files and previous versions of files.
+	versions bool
+
+	// Whether to count the parts of unfinished large files.
+	unfinished bool
+}
+
+func (c *DiskUsageCommand) Help() string {
+	helpText := `
+Usage: b2 du [options] <path>
+
+  Shows the number of files and the bytes stored in a bucket or a
+  folder, e.g. "my-bucket" or "my-bucket/photos", and in each of its
+  folders down to the given depth. The total of the path is printed
+  last.
+
+  Only the latest versions of files are counted unless -versions is
+  set, in which case hidden files and previous versions are counted
+  separately. The parts of large files that were started, but neither
+  finished nor canceled, are counted separately with -unfinished. All
+  of them are billed as stored data.
+
+General Options:
+
+  ` + c.generalOptions() + `
+
+Disk Usage Options:
+
+  -depth=<n>
+    Number of folder levels below the path that are totaled
+    separately. Use 0 to only print the total. Defaults to 1.
+
+  -human
+    Print sizes in K, M, G, T or P rather than bytes.
+
+  -unfinished
+    Count the uploaded parts of unfinished large files.
+
+  -versions
+    Count hidden files and previous versions of files.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *DiskUsageCommand) Synopsis() string {
+	return "Show the storage used by files in a bucket or folder"
+}
+
+func (c *DiskUsageCommand) Name() string { return "du" }
+
+func (c *DiskUsageCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.IntVar(&c.depth, "depth", 1, "")
+	flags.BoolVar(&c.human, "human", false, "")
+	flags.BoolVar(&c.versions, "versions", false, "")
+	flags.BoolVar(&c.unfinished, "unfinished", false, "")
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got exactly one argument
+	args = flags.Args()
+	if len(args) != 1 {
+		c.ui.Error("This command takes one argument: <path>")
+		return 1
+	}
+
+	if c.depth < 0 {
+		c.ui.Error("-depth can't be negative")
+		return 1
+	}
+
+	p, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	bucketName, prefix := splitBucketAndPrefix(p)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ctx := context.TODO()
+
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	usage, err := c.diskUsage(ctx, client, bucket.ID, prefix)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	results := usage.results(bucketName + "/" + prefix)
+
+	rows := make([][]string, 0, len(results)+1)
+	rows = append(rows, c.row("SIZE", "FILES", "OLD SIZE", "OLD VERSIONS", "UNFINISHED SIZE", "UNFINISHED", "PATH"))
+	for _, u := range results {
+		rows = append(rows, c.row(
+			formatSize(u.Size, c.human), fmt.Sprint(u.Files),
+			formatSize(u.OldVersionsSize, c.human), fmt.Sprint(u.OldVersions),
+			formatSize(u.UnfinishedSize, c.human), fmt.Sprint(u.Unfinished),
+			u.Path,
+		))
+	}
+
+	// All columns but the path are right aligned
+	right := make([]int, len(rows[0])-1)
+	for i := range right {
+		right[i] = i
+	}
+	lines := formatColumns(rows, right...)
+
+	if c.textOutput() {
+		c.ui.Output(lines[0])
+	}
+
+	out := c.newPrinter(true)
+	for i, u := range results {
+		out.print(lines[i+1], u)
+	}
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// row returns the columns that are printed given the options.
+func (c *DiskUsageCommand) row(size, files, oldSize, oldVersions, unfinishedSize, unfinished, path string) []string {
+	row := []string{size, files}
+	if c.versions {
+		row = append(row, oldSize, oldVersions)
+	}
+	if c.unfinished {
+		row = append(row, unfinishedSize, unfinished)
+	}
+	return append(row, path)
+}
+
+// diskUsage lists the files under the prefix and totals them by folder.
+func (c *DiskUsageCommand) diskUsage(ctx context.Context, client *b2.Client, bucketID, prefix string) (*usageTree, error) {
+	usage := newUsageTree(c.depth)
+
+	if c.versions {
+		files, err := client.File.ListAllVersions(ctx, &b2.FileVersionListRequest{
+			BucketID: bucketID,
+			Prefix:   prefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Versions are listed from the newest to the oldest, so only the
+		// first version of a file is current, unless the file is hidden.
+		seen := make(map[string]bool)
+		for _, file := range files {
+			switch file.Action {
+			case "upload":
+				name := strings.TrimPrefix(file.FileName, prefix)
+				size := int64(file.ContentLength)
+				if seen[file.FileName] {
+					usage.add(name, func(u *diskUsage) { u.OldVersions++; u.OldVersionsSize += size })
+				} else {
+					usage.add(name, func(u *diskUsage) { u.Files++; u.Size += size })
+				}
+				seen[file.FileName] = true
+			case "hide":
+				seen[file.FileName] = true
+			}
+		}
+	} else {
+		files, err := client.File.ListAll(ctx, &b2.FileListRequest{
+			BucketID: bucketID,
+			Prefix:   prefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if file.Action != "upload" {
+				continue
+			}
+			size := int64(file.ContentLength)
+			usage.add(strings.TrimPrefix(file.FileName, prefix), func(u *diskUsage) { u.Files++; u.Size += size })
+		}
+	}
+
+	if c.unfinished {
+		files, err := client.File.ListAllUnfinished(ctx, &b2.UnfinishedLargeFileListRequest{
+			BucketID:   bucketID,
+			NamePrefix: prefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			parts, err := client.File.ListAllParts(ctx, &b2.PartListRequest{FileID: file.FileID})
+			if err != nil {
+				return nil, err
+			}
+
+			var size int64
+			for _, part := range parts {
+				size += part.ContentLength
+			}
+			usage.add(strings.TrimPrefix(file.FileName, prefix), func(u *diskUsage) { u.Unfinished++; u.UnfinishedSize += size })
+		}
+	}
+
+	return usage, nil
+}
+
+// diskUsage is the storage used by the files under a path.
+type diskUsage struct {
+	Path string `json:"path"`
+
+	// Latest versions of files.
+	Size  int64 `json:"size"`
+	Files int   `json:"files"`
+
+	// Hidden files and previous versions of files.
+	OldVersionsSize int64 `json:"oldVersionsSize,omitempty"`
+	OldVersions     int   `json:"oldVersions,omitempty"`
+
+	// Uploaded parts of unfinished large files.
+	UnfinishedSize int64 `json:"unfinishedSize,omitempty"`
+	Unfinished     int   `json:"unfinished,omitempty"`
+}
+
+// usageTree totals the disk usage of files and of their folders down to
+// a maximum depth.
+type usageTree struct {
+	depth   int
+	total   diskUsage
+	folders map[string]*diskUsage
+}
+
+func newUsageTree(depth int) *usageTree {
+	return &usageTree{depth: depth, folders: make(map[string]*diskUsage)}
+}
+
+// add applies fn to the total and to every folder of the file with the
+// given relative name.
+func (t *usageTree) add(name string, fn func(u *diskUsage)) {
+	folders, ok := fileFolders(name, t.depth)
+	if !ok {
+		return
+	}
+
+	fn(&t.total)
+
+	for _, folder := range folders {
+		u, ok := t.folders[folder]
+		if !ok {
+			u = &diskUsage{}
+			t.folders[folder] = u
+		}
+		fn(u)
+	}
+}
+
+// fileFolders returns the folders of the file with the slash separated
+// relative name, from the outermost to the innermost and at most depth
+// deep, e.g. "a/" and "a/b/" for "a/b/c.txt". Folder markers, such as
+// "a/b/", are not files, so ok is false for them.
+func fileFolders(name string, depth int) (folders []string, ok bool) {
+	if name == "" || strings.HasSuffix(name, "/") {
+		return nil, false
+	}
+
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts) && i <= depth; i++ {
+		folders = append(folders, strings.Join(parts[:i], "/")+"/")
+	}
+	return folders, true
+}
+
+// results returns the usage of the folders sorted by name, followed by
+// the total. Paths are prefixed with path.
+func (t *usageTree) results(path string) []diskUsage {
+	folders := make([]string, 0, len(t.folders))
+	for folder := range t.folders {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+
+	results := make([]diskUsage, 0, len(folders)+1)
+	for _, folder := range folders {
+		u := *t.folders[folder]
+		u.Path = path + folder
+		results = append(results, u)
+	}
+
+	total := t.total
+	total.Path = path
+	return append(results, total)
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDiskUsageTestServer(t *testing.T) *b2.Client {
+	server, mux := testutil.NewServer()
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "1", "bucketName": "my-bucket"}]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files": [
+			{"action": "upload", "fileName": "data/", "contentLength": 0},
+			{"action": "upload", "fileName": "data/a.txt", "contentLength": 100},
+			{"action": "upload", "fileName": "data/photos/", "contentLength": 0},
+			{"action": "upload", "fileName": "data/photos/2020/cat.jpg", "contentLength": 2000},
+			{"action": "upload", "fileName": "data/photos/dog.jpg", "contentLength": 3000},
+			{"action": "upload", "fileName": "data/videos/cat.mp4", "contentLength": 40000}
+		]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_versions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files": [
+			{"action": "upload", "fileName": "data/a.txt", "contentLength": 100},
+			{"action": "upload", "fileName": "data/a.txt", "contentLength": 90},
+			{"action": "hide", "fileName": "data/photos/old.jpg"},
+			{"action": "upload", "fileName": "data/photos/old.jpg", "contentLength": 500},
+			{"action": "start", "fileName": "data/videos/big.mp4"},
+			{"action": "upload", "fileName": "data/videos/cat.mp4", "contentLength": 40000}
+		]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_unfinished_large_files", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files": [{"action": "start", "fileId": "big", "fileName": "data/videos/big.mp4"}], "nextFileId": null}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_parts", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.PartListRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		if req.StartPartNumber == 0 {
+			fmt.Fprint(w, `{"parts": [{"partNumber": 1, "contentLength": 5000000}], "nextPartNumber": 2}`)
+			return
+		}
+		fmt.Fprint(w, `{"parts": [{"partNumber": 2, "contentLength": 6000000}], "nextPartNumber": null}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestDiskUsageCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		out  string
+	}{
+		{
+			"depth 1",
+			[]string{"my-bucket/data"},
+			" SIZE  FILES  PATH\n" +
+				" 5000      2  my-bucket/data/photos/\n" +
+				"40000      1  my-bucket/data/videos/\n" +
+				"45100      4  my-bucket/data/\n",
+		},
+		{
+			"depth 2",
+			[]string{"-depth", "2", "-human", "my-bucket/data/"},
+			"SIZE  FILES  PATH\n" +
+				"4.9K      2  my-bucket/data/photos/\n" +
+				"2.0K      1  my-bucket/data/photos/2020/\n" +
+				" 39K      1  my-bucket/data/videos/\n" +
+				" 44K      4  my-bucket/data/\n",
+		},
+		{
+			"versions and unfinished",
+			[]string{"-depth", "0", "-versions", "-unfinished", "my-bucket/data"},
+			" SIZE  FILES  OLD SIZE  OLD VERSIONS  UNFINISHED SIZE  UNFINISHED  PATH\n" +
+				"40100      2       590             2         11000000           1  my-bucket/data/\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &DiskUsageCommand{
+				baseCommand: &baseCommand{ui: ui, client: newDiskUsageTestServer(t)},
+			}
+
+			code := cmd.Run(tt.args)
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			assert.Equal(t, tt.out, ui.OutputWriter.String())
+		})
+	}
+}
+
+func TestDiskUsageCommand_JSON(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &DiskUsageCommand{
+		baseCommand: &baseCommand{ui: ui, client: newDiskUsageTestServer(t)},
+	}
+
+	code := cmd.Run([]string{"-format", "json", "-unfinished", "my-bucket/data"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var results []diskUsage
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &results))
+	require.Len(t, results, 3)
+	assert.Equal(t, diskUsage{Path: "my-bucket/data/videos/", Size: 40000, Files: 1, UnfinishedSize: 11000000, Unfinished: 1}, results[1])
+	assert.Equal(t, diskUsage{Path: "my-bucket/data/", Size: 45100, Files: 4, UnfinishedSize: 11000000, Unfinished: 1}, results[2])
+}
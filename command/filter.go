@@ -0,0 +1,526 @@
+package command
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+// ignoreFilename is the name of the gitignore-style files read from local
+// source directories.
+const ignoreFilename = ".b2ignore"
+
+// fileFilter decides which files are transferred or listed based on their
+// name, size and modification time.
+//
+// Names are always slash separated paths relative to the source directory
+// or prefix.
+type fileFilter struct {
+	include      globList
+	exclude      globList
+	includeRegex regexList
+	excludeRegex regexList
+
+	minSize sizeValue
+	maxSize sizeValue
+
+	modifiedAfter  timeValue
+	modifiedBefore timeValue
+
+	// Patterns read from .b2ignore files keyed by the directory they
+	// were found in.
+	ignore map[string][]ignorePattern
+}
+
+// addFlags registers the filter flags with the flag set.
+func (f *fileFilter) addFlags(fs *flag.FlagSet) {
+	fs.Var(&f.include, "include", "")
+	fs.Var(&f.exclude, "exclude", "")
+	fs.Var(&f.includeRegex, "include-regex", "")
+	fs.Var(&f.excludeRegex, "exclude-regex", "")
+	fs.Var(&f.minSize, "min-size", "")
+	fs.Var(&f.maxSize, "max-size", "")
+	fs.Var(&f.modifiedAfter, "modified-after", "")
+	fs.Var(&f.modifiedBefore, "modified-before", "")
+}
+
+// filterOptions returns the help text for the filter flags.
+func filterOptions() string {
+	helpText := `
+  -exclude=<glob>
+    Skip files matching the glob. A glob without a slash is matched
+    against every part of the path, so "node_modules" skips the whole
+    folder and "*.tmp" skips files anywhere in the tree, whereas globs
+    with a slash are matched against the path relative to the source.
+    "**" matches any number of folders. Can be specified multiple times.
+
+  -exclude-regex=<regex>
+    Skip files whose relative path matches the regular expression. Can
+    be specified multiple times.
+
+  -include=<glob>
+    Only include files matching the glob. Can be specified multiple
+    times, in which case files matching any of the globs are included.
+
+  -include-regex=<regex>
+    Only include files whose relative path matches the regular
+    expression. Can be specified multiple times.
+
+  -max-size=<size>
+    Skip files larger than size, e.g. "500M". Sizes are in bytes unless
+    followed by one of the K, M, G or T suffixes.
+
+  -min-size=<size>
+    Skip files smaller than size.
+
+  -modified-after=<time>
+    Skip files modified before the time. The time is either a date like
+    "2020-10-21", an RFC 3339 timestamp or an age like "36h" or "7d".
+
+  -modified-before=<time>
+    Skip files modified after the time.
+
+  Files and folders listed in ` + ignoreFilename + ` files are skipped when
+  reading local directories. The files use the same format as .gitignore
+  files, and are not transferred themselves.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// match reports whether the file passes the filter.
+func (f *fileFilter) match(name string, size int64, modTime time.Time) bool {
+	return f.matchName(name, false) && f.matchAttrs(size, modTime)
+}
+
+// matchAttrs reports whether the size and modification time pass the size
+// and time filters.
+func (f *fileFilter) matchAttrs(size int64, modTime time.Time) bool {
+	if f.minSize.set && size < f.minSize.bytes {
+		return false
+	}
+	if f.maxSize.set && size > f.maxSize.bytes {
+		return false
+	}
+	if f.modifiedAfter.set && modTime.Before(f.modifiedAfter.time) {
+		return false
+	}
+	if f.modifiedBefore.set && modTime.After(f.modifiedBefore.time) {
+		return false
+	}
+	return true
+}
+
+// matchRemote reports whether the remote file passes the filter.
+func (f *fileFilter) matchRemote(name string, file b2.File) bool {
+	return f.match(name, int64(file.ContentLength), fileModTime(file))
+}
+
+// matchRemoteAttrs reports whether the remote file passes the size and time
+// filters.
+func (f *fileFilter) matchRemoteAttrs(file b2.File) bool {
+	return f.matchAttrs(int64(file.ContentLength), fileModTime(file))
+}
+
+// matchName reports whether the name passes the glob, regex and ignore
+// file filters.
+func (f *fileFilter) matchName(name string, isDir bool) bool {
+	if f.ignored(name, isDir) {
+		return false
+	}
+
+	for _, pattern := range f.exclude {
+		if matchGlob(pattern, name) {
+			return false
+		}
+	}
+	for _, re := range f.excludeRegex {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+
+	// Folders are only skipped when excluded, because files inside them
+	// may still be included.
+	if isDir || (len(f.include) == 0 && len(f.includeRegex) == 0) {
+		return true
+	}
+
+	for _, pattern := range f.include {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	for _, re := range f.includeRegex {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkDir calls fn for every regular file in the directory tree that passes
+// the filter. Ignore files are read along the way, and excluded folders are
+// not descended into.
+func (f *fileFilter) walkDir(dir string, fn func(p, name string, info fs.FileInfo) error) error {
+	return f.walkNames(dir, func(p, name string, info fs.FileInfo) error {
+		if !f.matchAttrs(info.Size(), info.ModTime()) {
+			return nil
+		}
+		return fn(p, name, info)
+	})
+}
+
+// walkNames is like walkDir, but leaves out the size and time filters.
+// Ignore files themselves are skipped.
+func (f *fileFilter) walkNames(dir string, fn func(p, name string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if name == "." {
+				return f.readIgnoreFile(p, "")
+			}
+			if !f.matchName(name, true) {
+				return filepath.SkipDir
+			}
+			return f.readIgnoreFile(p, name)
+		}
+
+		if !d.Type().IsRegular() || d.Name() == ignoreFilename {
+			return nil
+		}
+
+		if !f.matchName(name, false) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return fn(p, name, info)
+	})
+}
+
+// ignorePattern is a single pattern of an ignore file.
+type ignorePattern struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// readIgnoreFile reads the ignore file in dir, if there is one. name is the
+// slash separated path of dir relative to the root of the walk.
+func (f *fileFilter) readIgnoreFile(dir, name string) error {
+	file, err := os.Open(filepath.Join(dir, ignoreFilename))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.pattern = line
+
+		patterns = append(patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %v", filepath.Join(dir, ignoreFilename), err)
+	}
+
+	if len(patterns) > 0 {
+		if f.ignore == nil {
+			f.ignore = make(map[string][]ignorePattern)
+		}
+		f.ignore[name] = patterns
+	}
+	return nil
+}
+
+// ignored reports whether the ignore files exclude the name. Patterns from
+// deeper folders take precedence, and later patterns override earlier ones.
+func (f *fileFilter) ignored(name string, isDir bool) bool {
+	if len(f.ignore) == 0 {
+		return false
+	}
+
+	segments := strings.Split(name, "/")
+
+	ignored := false
+	for i := 0; i < len(segments); i++ {
+		base := strings.Join(segments[:i], "/")
+		for _, p := range f.ignore[base] {
+			if p.matches(segments[i:], isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the pattern matches the path segments or any of
+// the folders containing it.
+func (p ignorePattern) matches(segments []string, isDir bool) bool {
+	for n := len(segments); n > 0; n-- {
+		// Only the last segment may be a file
+		if p.dirOnly && n == len(segments) && !isDir {
+			continue
+		}
+
+		if p.anchored {
+			if matchSegments(strings.Split(p.pattern, "/"), segments[:n]) {
+				return true
+			}
+		} else if ok, _ := path.Match(p.pattern, segments[n-1]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether the slash separated name matches the glob.
+//
+// A glob without a slash matches if any part of the name matches it. Other
+// globs are matched against the beginning of the name, so that a glob
+// matching a folder also matches everything inside it. "**" matches any
+// number of folders.
+func matchGlob(pattern, name string) bool {
+	segments := strings.Split(name, "/")
+
+	if !strings.Contains(pattern, "/") {
+		for _, segment := range segments {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	patternSegments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	for i := len(segments); i > 0; i-- {
+		if matchSegments(patternSegments, segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches the path segments against glob segments, where "**"
+// matches zero or more segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// fileModTime returns the modification time of the original file, or the
+// upload time if the client that uploaded it did not record one.
+func fileModTime(f b2.File) time.Time {
+	millis, ok := fileLastModified(f)
+	if !ok {
+		millis = f.UploadTimestamp
+	}
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// globList is a flag.Value collecting repeated glob patterns.
+type globList []string
+
+func (l *globList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *globList) Set(value string) error {
+	if _, err := path.Match(value, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %v", value, err)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// regexList is a flag.Value collecting repeated regular expressions.
+type regexList []*regexp.Regexp
+
+func (l *regexList) String() string {
+	exprs := make([]string, len(*l))
+	for i, re := range *l {
+		exprs[i] = re.String()
+	}
+	return strings.Join(exprs, ",")
+}
+
+func (l *regexList) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, re)
+	return nil
+}
+
+// sizeValue is a flag.Value for sizes in bytes with an optional K, M, G
+// or T suffix.
+type sizeValue struct {
+	bytes int64
+	set   bool
+}
+
+func (v *sizeValue) String() string {
+	if !v.set {
+		return ""
+	}
+	return strconv.FormatInt(v.bytes, 10)
+}
+
+func (v *sizeValue) Set(value string) error {
+	bytes, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+	v.bytes = bytes
+	v.set = true
+	return nil
+}
+
+// parseSize parses sizes like "1024", "10K" or "1.5G".
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	if number != "" {
+		switch number[len(number)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			number = number[:len(number)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// timeValue is a flag.Value for points in time given either as a date, an
+// RFC 3339 timestamp or an age relative to now.
+type timeValue struct {
+	time time.Time
+	set  bool
+}
+
+func (v *timeValue) String() string {
+	if !v.set {
+		return ""
+	}
+	return v.time.Format(time.RFC3339)
+}
+
+func (v *timeValue) Set(value string) error {
+	t, err := parseTime(value, time.Now())
+	if err != nil {
+		return err
+	}
+	v.time = t
+	v.set = true
+	return nil
+}
+
+// parseTime parses dates like "2020-10-21", RFC 3339 timestamps and ages
+// like "36h" or "7d", which are subtracted from now.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if age, err := parseAge(s); err == nil {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use a date like 2020-10-21 or an age like 7d", s)
+}
+
+// parseAge parses durations, additionally accepting days like "7d".
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,149 @@
+package command
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_MatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		matches bool
+	}{
+		{"*.tmp", "a.tmp", true},
+		{"*.tmp", "dir/a.tmp", true},
+		{"*.tmp", "a.tmp.txt", false},
+		{"node_modules", "node_modules/a/index.js", true},
+		{"node_modules", "web/node_modules/index.js", true},
+		{"node_modules", "node_modules.txt", false},
+		{"docs/*.md", "docs/readme.md", true},
+		{"docs/*.md", "web/docs/readme.md", false},
+		{"docs", "docs/readme.md", true},
+		{"/docs/**/*.png", "docs/a/b/c.png", true},
+		{"docs/**/*.png", "docs/c.png", true},
+		{"docs/**/*.png", "docs/a/c.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.matches, matchGlob(tt.pattern, tt.name))
+		})
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	now := time.Now()
+
+	f := &fileFilter{}
+	require.NoError(t, f.include.Set("*.log"))
+	require.NoError(t, f.exclude.Set("debug*"))
+	require.NoError(t, f.excludeRegex.Set(`^archive/`))
+	require.NoError(t, f.maxSize.Set("1K"))
+	require.NoError(t, f.modifiedAfter.Set("7d"))
+
+	assert.True(t, f.match("app.log", 100, now))
+	assert.False(t, f.match("app.txt", 100, now), "not included")
+	assert.False(t, f.match("debug.log", 100, now), "excluded by glob")
+	assert.False(t, f.match("archive/app.log", 100, now), "excluded by regex")
+	assert.False(t, f.match("app.log", 2048, now), "too big")
+	assert.False(t, f.match("app.log", 100, now.Add(-8*24*time.Hour)), "too old")
+
+	assert.True(t, f.matchName("archived", true), "folders are not subject to includes")
+}
+
+func TestFilter_WalkDirReadsIgnoreFiles(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		".b2ignore":                "# build output\n*.tmp\nnode_modules/\n/build\n!keep.tmp\n",
+		"a.txt":                    "",
+		"a.tmp":                    "",
+		"keep.tmp":                 "",
+		"build/out.bin":            "",
+		"src/build/main.go":        "",
+		"src/node_modules/x.js":    "",
+		"src/.b2ignore":            "*.go\n",
+		"src/lib/util.go":          "",
+		"src/README":               "",
+		"other/lib/util.go":        "",
+		"other/lib/cache/data.tmp": "",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	}
+
+	f := &fileFilter{}
+
+	var names []string
+	err = f.walkDir(dir, func(p, name string, info fs.FileInfo) error {
+		names = append(names, name)
+		return nil
+	})
+	require.NoError(t, err)
+
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		"a.txt",
+		"keep.tmp",
+		"other/lib/util.go",
+		"src/README",
+	}, names)
+
+	// Patterns also apply to names that weren't walked
+	assert.True(t, f.ignored("src/node_modules/y.js", false))
+	assert.False(t, f.ignored("other/main.go", false))
+}
+
+func TestFilter_ParseSize(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+	}{
+		{"100", 100},
+		{"1K", 1024},
+		{"1.5M", 1572864},
+		{"2GB", 2 << 30},
+		{"1t", 1 << 40},
+	}
+	for _, tt := range tests {
+		size, err := parseSize(tt.in)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.out, size, tt.in)
+	}
+
+	_, err := parseSize("-1")
+	assert.Error(t, err)
+	_, err = parseSize("lots")
+	assert.Error(t, err)
+}
+
+func TestFilter_ParseTime(t *testing.T) {
+	now := time.Date(2020, 10, 21, 22, 48, 0, 0, time.UTC)
+
+	tm, err := parseTime("7d", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-7*24*time.Hour), tm)
+
+	tm, err = parseTime("36h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-36*time.Hour), tm)
+
+	tm, err = parseTime("2015-10-21T07:28:00Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC), tm.UTC())
+
+	_, err = parseTime("yesterday", now)
+	assert.Error(t, err)
+}
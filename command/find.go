@@ -0,0 +1,329 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+const (
+	findActionPrint  = "print"
+	findActionDelete = "delete"
+	findActionHide   = "hide"
+	findActionURL    = "url"
+
+	// maxShareDuration is the longest time a download authorization can
+	// be valid for.
+	maxShareDuration = 7 * 24 * time.Hour
+)
+
+type FindCommand struct {
+	*baseCommand
+
+	// What to do with the files that are found.
+	action string
+
+	// Whether to only print the files that would be deleted or hidden.
+	dryRun bool
+
+	// How long share URLs are valid for, e.g. "24h" or "7d".
+	expires string
+
+	uploadedAfter  timeValue
+	uploadedBefore timeValue
+
+	// Glob the content type has to match, e.g. "image/*".
+	contentType string
+
+	// File info the files must have. Values are globs.
+	fileInfo map[string]string
+
+	// Decides which files are found by name, size and modification time.
+	filter fileFilter
+}
+
+func (c *FindCommand) Help() string {
+	helpText := `
+Usage: b2 find [options] <path>
+
+  Finds the files under a bucket or a folder, e.g. "my-bucket" or
+  "my-bucket/logs", that match all of the given options, and prints,
+  deletes or hides them or prints URLs to share them.
+
+  Use -format=json or -format=jsonl to print the files as JSON.
+
+General Options:
+
+  ` + c.generalOptions() + `
+
+Find Options:
+
+  -action=<action>
+    What to do with the files. Either "print" to print their names,
+    "delete" to delete all of their versions, "hide" to hide them, or
+    "url" to print URLs that allow anyone to download them until they
+    expire. Defaults to "print".
+
+  -content-type=<glob>
+    Only find files whose content type matches the glob, e.g. "image/*".
+
+  -dry-run
+    Print the files that would be deleted or hidden without deleting
+    or hiding them.
+
+  -expires=<duration>
+    How long the URLs printed by -action=url are valid for, e.g. "12h"
+    or "7d". Defaults to "24h", and can be at most "7d".
+
+  -info=<key>=<glob>
+    Only find files that have the file info key with a value matching
+    the glob. Can be specified multiple times, in which case all of
+    them have to match.
+
+  -uploaded-after=<time>
+    Only find files uploaded after the time. The time is either a date
+    like "2020-10-21", an RFC 3339 timestamp or an age like "36h" or
+    "7d".
+
+  -uploaded-before=<time>
+    Only find files uploaded before the time.
+
+Filter Options:
+
+  Names are matched relative to the path. The modification time is the
+  time recorded by the client that uploaded the file, or the upload time
+  if it wasn't recorded.
+
+  ` + filterOptions() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *FindCommand) Synopsis() string {
+	return "Find files and print, delete or share them"
+}
+
+func (c *FindCommand) Name() string { return "find" }
+
+func (c *FindCommand) Run(args []string) int {
+	c.fileInfo = make(map[string]string)
+
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.StringVar(&c.action, "action", findActionPrint, "")
+	flags.StringVar(&c.contentType, "content-type", "", "")
+	flags.BoolVar(&c.dryRun, "dry-run", false, "")
+	flags.StringVar(&c.expires, "expires", "24h", "")
+	flags.Var(keyValueFlag(c.fileInfo), "info", "")
+	flags.Var(&c.uploadedAfter, "uploaded-after", "")
+	flags.Var(&c.uploadedBefore, "uploaded-before", "")
+	c.filter.addFlags(flags)
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got exactly one argument
+	args = flags.Args()
+	if len(args) != 1 {
+		c.ui.Error("This command takes one argument: <path>")
+		return 1
+	}
+
+	switch c.action {
+	case findActionPrint, findActionDelete, findActionHide, findActionURL:
+	default:
+		c.ui.Error(fmt.Sprintf("-action must be one of %q, %q, %q or %q", findActionPrint, findActionDelete, findActionHide, findActionURL))
+		return 1
+	}
+
+	expires, err := parseAge(c.expires)
+	if err != nil || expires < time.Second || expires > maxShareDuration {
+		c.ui.Error(fmt.Sprintf("Error: invalid -expires %q, must be between 1s and 7d", c.expires))
+		return 1
+	}
+
+	// Check the globs up front rather than silently finding nothing
+	patterns := []string{c.contentType}
+	for _, pattern := range c.fileInfo {
+		patterns = append(patterns, pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: invalid glob %q: %v", pattern, err))
+			return 1
+		}
+	}
+
+	p, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	bucketName, prefix := splitBucketAndPrefix(p)
+	prefix = syncPrefix(prefix)
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ctx := context.TODO()
+
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	files, err := listRemoteFiles(ctx, client, bucket.ID, prefix, &c.filter)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	var found []b2.File
+	for _, name := range remoteNames(files) {
+		if c.filter.matchRemoteAttrs(files[name]) && c.match(files[name]) {
+			found = append(found, files[name])
+		}
+	}
+
+	var versions map[string][]b2.File
+	if c.action == findActionDelete && !c.dryRun {
+		versions, err = listRemoteVersions(ctx, client, bucket.ID, prefix)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	}
+
+	out := c.newPrinter(true)
+
+	code := 0
+	for _, file := range found {
+		file := file
+		name := bucket.Name + "/" + file.FileName
+
+		var err error
+		switch c.action {
+		case findActionPrint:
+			out.print(name, file)
+		case findActionDelete, findActionHide:
+			err = c.remove(ctx, client, bucket, file, versions[file.FileName])
+			if err == nil {
+				text := fmt.Sprintf("%s: %s", c.action, name)
+				if c.dryRun {
+					text = "(dry run) " + text
+				}
+				out.print(text, transferResult{Action: c.action, Source: name, DryRun: c.dryRun, File: &file})
+			}
+		case findActionURL:
+			var share *shareResult
+			share, err = shareURL(ctx, client, bucket, file, expires)
+			if err == nil {
+				out.print(share.URL, share)
+			}
+		}
+
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %s: %v", name, err))
+			code = 1
+		}
+	}
+
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return code
+}
+
+// match reports whether the file matches the options that aren't covered
+// by the filter.
+func (c *FindCommand) match(file b2.File) bool {
+	uploaded := time.Unix(0, file.UploadTimestamp*int64(time.Millisecond))
+	if c.uploadedAfter.set && uploaded.Before(c.uploadedAfter.time) {
+		return false
+	}
+	if c.uploadedBefore.set && uploaded.After(c.uploadedBefore.time) {
+		return false
+	}
+
+	if c.contentType != "" {
+		if ok, _ := path.Match(c.contentType, file.ContentType); !ok {
+			return false
+		}
+	}
+
+	for key, pattern := range c.fileInfo {
+		value, found := file.FileInfo[key]
+		if !found {
+			return false
+		}
+		if ok, _ := path.Match(pattern, value); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// remove deletes all versions of the file or hides it, unless it's a dry
+// run.
+func (c *FindCommand) remove(ctx context.Context, client *b2.Client, bucket *b2.Bucket, file b2.File, versions []b2.File) error {
+	if c.dryRun {
+		return nil
+	}
+
+	if c.action == findActionHide {
+		_, err := client.File.Hide(ctx, &b2.HideFileRequest{BucketID: bucket.ID, FileName: file.FileName})
+		return err
+	}
+
+	for _, version := range versions {
+		req := &b2.DeleteFileVersionRequest{FileName: version.FileName, FileID: version.FileID}
+		if _, err := client.File.DeleteVersion(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shareResult is a URL anyone can download a file from until it expires.
+type shareResult struct {
+	Source    string    `json:"source"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// shareURL returns a URL for downloading the file that is valid for the
+// given duration. The token only grants access to files whose names start
+// with the name of the file.
+func shareURL(ctx context.Context, client *b2.Client, bucket *b2.Bucket, file b2.File, expires time.Duration) (*shareResult, error) {
+	req := &b2.DownloadAuthorizationRequest{
+		BucketID:               bucket.ID,
+		FileNamePrefix:         file.FileName,
+		ValidDurationInSeconds: int64(expires / time.Second),
+	}
+
+	expiresAt := time.Now().Add(expires).UTC().Truncate(time.Second)
+
+	auth, err := client.File.DownloadAuthorization(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &shareResult{
+		Source:    bucket.Name + "/" + file.FileName,
+		URL:       downloadURL(client, bucket.Name, file.FileName) + "?Authorization=" + url.QueryEscape(auth.Token),
+		ExpiresAt: expiresAt,
+	}, nil
+}
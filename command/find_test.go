@@ -0,0 +1,117 @@
+package command
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+func newFindTestBucket() *testBucket {
+	bucket := &testBucket{}
+	bucket.add(b2.File{FileID: "cat-1", FileName: "photos/cat.jpg", ContentLength: 2000, ContentType: "image/jpeg", UploadTimestamp: 1536964279000})
+	bucket.add(b2.File{FileID: "cat-2", FileName: "photos/cat.jpg", ContentLength: 3000, ContentType: "image/jpeg", UploadTimestamp: 1600000000000, FileInfo: map[string]string{"camera": "Nikon D750"}})
+	bucket.add(b2.File{FileID: "dog", FileName: "photos/2020/dog.png", ContentLength: 500, ContentType: "image/png", UploadTimestamp: 1600000000000, FileInfo: map[string]string{"camera": "Canon EOS R"}})
+	bucket.add(b2.File{FileID: "notes", FileName: "photos/notes.txt", ContentLength: 10, ContentType: "text/plain", UploadTimestamp: 1536964279000})
+	bucket.add(b2.File{FileID: "other", FileName: "photos-old/cat.jpg", ContentLength: 2000, ContentType: "image/jpeg", UploadTimestamp: 1536964279000})
+	return bucket
+}
+
+func TestFindCommand_Predicates(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		out  string
+	}{
+		{"everything", nil, "my-bucket/photos/2020/dog.png\nmy-bucket/photos/cat.jpg\nmy-bucket/photos/notes.txt\n"},
+		{"glob", []string{"-include", "*.jpg"}, "my-bucket/photos/cat.jpg\n"},
+		{"regex", []string{"-include-regex", "^2020/"}, "my-bucket/photos/2020/dog.png\n"},
+		{"size", []string{"-min-size", "100", "-max-size", "1K"}, "my-bucket/photos/2020/dog.png\n"},
+		{"uploaded", []string{"-uploaded-before", "2019-01-01"}, "my-bucket/photos/notes.txt\n"},
+		{"content type", []string{"-content-type", "image/*"}, "my-bucket/photos/2020/dog.png\nmy-bucket/photos/cat.jpg\n"},
+		{"file info", []string{"-info", "camera=Nikon*"}, "my-bucket/photos/cat.jpg\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &FindCommand{
+				baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, newFindTestBucket())},
+			}
+
+			code := cmd.Run(append(tt.args, "my-bucket/photos"))
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			assert.Equal(t, tt.out, ui.OutputWriter.String())
+		})
+	}
+}
+
+func TestFindCommand_Delete(t *testing.T) {
+	bucket := newFindTestBucket()
+
+	ui := cli.NewMockUi()
+	cmd := &FindCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"-action", "delete", "-dry-run", "-include", "*.jpg", "my-bucket/photos"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, "(dry run) delete: my-bucket/photos/cat.jpg\n", ui.OutputWriter.String())
+	assert.Empty(t, bucket.deleted)
+
+	ui = cli.NewMockUi()
+	cmd = &FindCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code = cmd.Run([]string{"-action", "delete", "-include", "*.jpg", "my-bucket/photos"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, "delete: my-bucket/photos/cat.jpg\n", ui.OutputWriter.String())
+	assert.Equal(t, []string{"cat-2", "cat-1"}, bucket.deleted)
+}
+
+func TestFindCommand_ShareURL(t *testing.T) {
+	bucket := newFindTestBucket()
+	client := newTestBucketServer(t, bucket)
+
+	ui := cli.NewMockUi()
+	cmd := &FindCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"-action", "url", "-expires", "2d", "-format", "jsonl", "-include", "*.txt", "my-bucket/photos"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var share shareResult
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &share))
+	assert.Equal(t, "my-bucket/photos/notes.txt", share.Source)
+	assert.True(t, strings.HasSuffix(share.URL, "/file/my-bucket/photos/notes.txt?Authorization=token-for-photos%2Fnotes.txt-172800"), share.URL)
+	assert.False(t, share.ExpiresAt.IsZero())
+}
+
+func TestFindCommand_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-action", "copy"}, "-action must be one of"},
+		{[]string{"-expires", "8d"}, `invalid -expires "8d"`},
+		{[]string{"-content-type", "image/["}, `invalid glob "image/["`},
+	}
+
+	for _, tt := range tests {
+		ui := cli.NewMockUi()
+		cmd := &FindCommand{
+			baseCommand: &baseCommand{ui: ui},
+		}
+
+		code := cmd.Run(append(tt.args, "my-bucket"))
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tt.err)
+	}
+}
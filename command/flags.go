@@ -0,0 +1,28 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keyValueFlag is a flag.Value that collects repeated key=value pairs.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/romantomjak/b2/b2"
 	"github.com/vbauerster/mpb/v8"
@@ -18,17 +21,48 @@ import (
 
 type GetCommand struct {
 	*baseCommand
+
+	// Whether to download all files under the prefix.
+	recursive bool
+
+	// Maximum number of files downloaded in parallel.
+	concurrency int
+
+	// Decides which files are downloaded from folders.
+	filter fileFilter
 }
 
 func (c *GetCommand) Help() string {
 	helpText := `
-Usage: b2 get <source> <destination>
+Usage: b2 get [options] <source> <destination>
+
+  Downloads the given file to the destination. If source ends with a
+  slash, all files in that folder are downloaded to the destination
+  directory.
 
-  Downloads the given file to the destination.
+  With -R, all files under the source prefix are downloaded and the
+  folder structure below the prefix is recreated in the destination
+  directory.
 
 General Options:
 
-  ` + c.generalOptions()
+  ` + c.generalOptions() + `
+
+Get Options:
+
+  -concurrency=<n>
+    Number of files to download in parallel. Defaults to 4.
+
+  -R
+    Download all files under the prefix recursively.
+
+Filter Options:
+
+  These options apply when downloading folders. Names are matched
+  relative to the source prefix.
+
+  ` + filterOptions() + `
+`
 	return strings.TrimSpace(helpText)
 }
 
@@ -41,8 +75,11 @@ func (c *GetCommand) Name() string { return "get" }
 func (c *GetCommand) Run(args []string) int {
 	flags := c.flagSet()
 	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.BoolVar(&c.recursive, "R", false, "")
+	flags.IntVar(&c.concurrency, "concurrency", 4, "")
+	c.filter.addFlags(flags)
 
-	if err := flags.Parse(args); err != nil {
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
 		return 1
 	}
 
@@ -54,11 +91,40 @@ func (c *GetCommand) Run(args []string) int {
 		return 1
 	}
 
+	if c.concurrency < 1 {
+		c.ui.Error("-concurrency must be at least 1")
+		return 1
+	}
+
 	// Resolve sources
-	bucketName, filePrefix := splitBucketAndPrefix(args[0])
+	source, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	bucketName, filePrefix := splitBucketAndPrefix(source)
+
+	// Resolve destination
+	destination := args[1]
+	if destination == "." {
+		dir, err := os.Getwd()
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+		destination = dir
+	}
+
+	// TODO: resolve ~/ paths
 
 	ctx := context.TODO()
 
+	// A single file can be downloaded by name without looking up the
+	// bucket and listing files.
+	if !c.recursive && filePrefix != "" && !strings.HasSuffix(filePrefix, "/") {
+		return c.getFile(bucketName, filePrefix, destination)
+	}
+
 	// Create a client
 	client, err := c.Client()
 	if err != nil {
@@ -66,77 +132,158 @@ func (c *GetCommand) Run(args []string) int {
 		return 1
 	}
 
-	bucket, err := findBucketByName(ctx, client, bucketName)
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
 	if err != nil {
 		c.ui.Error(fmt.Sprintf("Error: %v", err))
 		return 1
 	}
 
+	if c.recursive {
+		return c.getRecursive(ctx, bucket, filePrefix, destination)
+	}
+
 	req := &b2.FileListRequest{
 		BucketID:  bucket.ID,
 		Prefix:    filePrefix,
 		Delimiter: "/",
 	}
 
-	files, _, err := client.File.List(ctx, req)
+	files, err := client.File.ListAll(ctx, req)
 	if err != nil {
 		c.ui.Error(fmt.Sprintf("Error: %v", err))
 		return 1
 	}
 
-	// Resolve destination
-	destination := args[1]
-	if destination == "." {
-		dir, err := os.Getwd()
-		if err != nil {
-			c.ui.Error(fmt.Sprintf("Error: %v", err))
-			return 1
+	var downloads []download
+	for _, file := range files {
+		if file.Action == "folder" {
+			c.ui.Warn(fmt.Sprintf("Skipping folder %s, use -R to download folders", path.Join(bucketName, file.FileName)))
+			continue
 		}
-		destination = dir
+		if !c.filter.matchRemote(strings.TrimPrefix(file.FileName, filePrefix), file) {
+			continue
+		}
+		downloads = append(downloads, download{file, filepath.Join(destination, path.Base(file.FileName))})
 	}
 
-	// TODO: resolve ~/ paths
+	if len(downloads) == 0 {
+		c.ui.Error("Error: source is not a file or directory")
+		return 1
+	}
 
-	return c.copy(bucketName, files, destination)
+	if err := checkDestinationDir(destination); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return c.copy(bucketName, downloads, true)
 }
 
-func (c *GetCommand) copy(bucketName string, sources []b2.File, destination string) int {
-	if len(sources) == 0 {
-		c.ui.Error("Error: source is not a file or directory")
+// getFile downloads a single file by its name.
+func (c *GetCommand) getFile(bucketName, filename, destination string) int {
+	info, err := os.Stat(destination)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
 		return 1
 	}
+	if err == nil && info.IsDir() {
+		destination = filepath.Join(destination, path.Base(filename))
+	}
 
-	if len(sources) == 1 {
-		_, err := os.Stat(destination)
-		if err != nil && !errors.Is(err, fs.ErrNotExist) {
-			c.ui.Error(fmt.Sprintf("Error: %v", err))
-			return 1
-		}
+	file := b2.File{FileName: filename}
+
+	return c.copy(bucketName, []download{{file, destination}}, false)
+}
+
+// getRecursive downloads all files under the prefix, recreating the folder
+// structure below the prefix in the destination directory.
+func (c *GetCommand) getRecursive(ctx context.Context, bucket *b2.Bucket, prefix, destination string) int {
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	prefix = syncPrefix(prefix)
+
+	req := &b2.FileListRequest{
+		BucketID: bucket.ID,
+		Prefix:   prefix,
+	}
+
+	files, err := client.File.ListAll(ctx, req)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
 	}
 
-	// Multiple sources require the destination to be a folder.
-	if len(sources) > 1 {
-		info, err := os.Stat(destination)
+	var downloads []download
+	for _, file := range files {
+		if file.Action != "upload" {
+			continue
+		}
+		name := strings.TrimPrefix(file.FileName, prefix)
+
+		// Folder markers, such as "photos/", have nothing to download
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if !c.filter.matchRemote(name, file) {
+			continue
+		}
+		filename, err := localPath(destination, name)
 		if err != nil {
-			if !errors.Is(err, fs.ErrNotExist) {
-				c.ui.Error(fmt.Sprintf("Error: %v", err))
-				return 1
-			}
-			c.ui.Error("Error: destination directory does not exist")
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
 			return 1
 		}
-		if !info.IsDir() {
-			c.ui.Error(fmt.Sprintf("Error: %s is not a directory", destination))
-			return 1
+		downloads = append(downloads, download{file, filename})
+	}
+
+	if len(downloads) == 0 {
+		c.ui.Error("Error: source is not a file or directory")
+		return 1
+	}
+
+	return c.copy(bucket.Name, downloads, true)
+}
+
+// download is a remote file and the path it is downloaded to.
+type download struct {
+	file     b2.File
+	filename string
+}
+
+// checkDestinationDir checks that multiple files can be downloaded into
+// the destination.
+func checkDestinationDir(destination string) error {
+	info, err := os.Stat(destination)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
 		}
+		return errors.New("destination directory does not exist")
 	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", destination)
+	}
+	return nil
+}
 
-	maxWorkers := len(sources)
-	if maxWorkers > 4 {
-		maxWorkers = 4
+// copy downloads the files. Results are printed as a list, unless a single
+// file was asked for.
+func (c *GetCommand) copy(bucketName string, downloads []download, list bool) int {
+	maxWorkers := len(downloads)
+	if maxWorkers > c.concurrency {
+		maxWorkers = c.concurrency
 	}
 
-	p := mpb.New()
+	// Progress would get mixed up with the results
+	var p *mpb.Progress
+	if c.textOutput() {
+		p = mpb.New()
+	} else {
+		p = mpb.New(mpb.WithOutput(nil))
+	}
 
 	sem := semaphore.NewWeighted(int64(maxWorkers))
 
@@ -149,16 +296,18 @@ func (c *GetCommand) copy(bucketName string, sources []b2.File, destination stri
 		return 1
 	}
 
-	for _, source := range sources {
-		// TODO: ignore folders when copying without -R, write an error to stderr
+	var mu sync.Mutex
+	failed := 0
+	downloaded := make([]*b2.File, len(downloads))
 
+	for i, d := range downloads {
 		// Blocks until a worker becomes available
 		if err := sem.Acquire(ctx, 1); err != nil {
 			c.ui.Error(fmt.Sprintf("Error: failed to acquire semaphore: %v", err))
 			break
 		}
 
-		go func(source b2.File) {
+		go func(i int, source b2.File, filename string) {
 			defer sem.Release(1)
 
 			bar := p.AddBar(int64(source.ContentLength),
@@ -174,28 +323,23 @@ func (c *GetCommand) copy(bucketName string, sources []b2.File, destination stri
 				mpb.BarFillerClearOnComplete(),
 			)
 
-			filename := path.Join(destination, path.Base(source.FileName))
-
-			// Create the destination file
-			out, err := os.Create(filename)
+			file, err := c.downloadFile(ctx, client, bucketName, source, filename, bar)
 			if err != nil {
-				c.ui.Error(err.Error())
+				bar.Abort(false)
+				c.ui.Error(fmt.Sprintf("Error: %s: %v", path.Join(bucketName, source.FileName), err))
+				mu.Lock()
+				failed++
+				mu.Unlock()
 				return
 			}
-			defer out.Close()
-
-			proxyWriter := bar.ProxyWriter(out)
-			defer proxyWriter.Close()
 
-			uri := fmt.Sprintf("%s/file/%s", client.DownloadURL, path.Join(bucketName, source.FileName))
+			// The size of files downloaded by name is not known upfront
+			bar.SetTotal(-1, true)
 
-			// See https://github.com/golang/go/issues/16474
-			_, err = client.File.Download(ctx, uri, struct{ io.Writer }{proxyWriter})
-			if err != nil {
-				c.ui.Error(err.Error())
-				return
-			}
-		}(source)
+			mu.Lock()
+			downloaded[i] = file
+			mu.Unlock()
+		}(i, d.file, d.filename)
 	}
 
 	// Acquire all of the tokens to wait for any remaining workers to finish.
@@ -207,5 +351,72 @@ func (c *GetCommand) copy(bucketName string, sources []b2.File, destination stri
 	// Wait to flush the output
 	p.Wait()
 
+	out := c.newPrinter(list)
+	for i, d := range downloads {
+		if downloaded[i] == nil {
+			continue
+		}
+		source := path.Join(bucketName, d.file.FileName)
+		out.print(fmt.Sprintf("Downloaded %s to %s", source, d.filename), transferResult{
+			Action:      "download",
+			Source:      source,
+			Destination: d.filename,
+			File:        downloaded[i],
+		})
+	}
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
 	return 0
 }
+
+// downloadFile downloads the source file to filename, creating any missing
+// parent directories.
+func (c *GetCommand) downloadFile(ctx context.Context, client *b2.Client, bucketName string, source b2.File, filename string, bar *mpb.Bar) (*b2.File, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+
+	// Create the destination file
+	out, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	proxyWriter := bar.ProxyWriter(out)
+	defer proxyWriter.Close()
+
+	uri := downloadURL(client, bucketName, source.FileName)
+
+	// See https://github.com/golang/go/issues/16474
+	resp, err := client.File.Download(ctx, uri, struct{ io.Writer }{proxyWriter})
+	if err != nil {
+		// Don't leave an empty or partial file behind
+		out.Close()
+		os.Remove(filename)
+		return nil, err
+	}
+
+	// Files downloaded by name are only known by their name until now
+	if source.FileID == "" {
+		return b2.FileFromHeader(resp.Header), nil
+	}
+
+	return &source, nil
+}
+
+// downloadURL returns the URL for downloading the file by its name.
+func downloadURL(client *b2.Client, bucketName, filename string) string {
+	segments := strings.Split(filename, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/file/%s/%s", client.DownloadURL, url.PathEscape(bucketName), strings.Join(segments, "/"))
+}
@@ -1,11 +1,13 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/mitchellh/cli"
@@ -49,3 +51,68 @@ func TestGetCommand_CanDownloadFile(t *testing.T) {
 	out := ui.OutputWriter.String()
 	assert.Contains(t, out, fmt.Sprintf("Downloaded %s to %s", src, dst))
 }
+
+func TestGetCommand_DownloadsRecursively(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "4a48fe8875c6214145260818", "bucketName": "my-bucket"}]}`)
+	})
+
+	// Return one file per page to check that all pages are downloaded,
+	// along with the folder markers some tools create
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.FileListRequest)
+		json.NewDecoder(r.Body).Decode(req)
+
+		assert.Equal(t, "photos/", req.Prefix)
+		assert.Empty(t, req.Delimiter)
+
+		switch req.StartFileName {
+		case "":
+			fmt.Fprint(w, `{
+				"files": [
+					{"action": "upload", "contentLength": 0, "fileName": "photos/"},
+					{"action": "upload", "contentLength": 5, "fileName": "photos/a.jpg"}
+				],
+				"nextFileName": "photos/b.jpg"
+			}`)
+		case "photos/b.jpg":
+			fmt.Fprint(w, `{
+				"files": [
+					{"action": "upload", "contentLength": 0, "fileName": "photos/2020/"},
+					{"action": "upload", "contentLength": 5, "fileName": "photos/2020/a.jpg"}
+				],
+				"nextFileName": null
+			}`)
+		}
+	})
+
+	mux.HandleFunc("/file/my-bucket/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.TrimPrefix(r.URL.Path, "/file/my-bucket/"))
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &GetCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	dir, _ := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	defer os.RemoveAll(dir)
+
+	code := cmd.Run([]string{"-R", "my-bucket/photos", dir})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	for _, name := range []string{"a.jpg", "2020/a.jpg"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		assert.NoError(t, err)
+		assert.Equal(t, "photos/"+name, string(content))
+	}
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Downloaded my-bucket/photos/2020/a.jpg to %s", filepath.Join(dir, "2020", "a.jpg")))
+}
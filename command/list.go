@@ -1,22 +1,79 @@
 package command
 
 import (
+	"fmt"
 	"strings"
 )
 
+const (
+	sortName = "name"
+	sortSize = "size"
+	sortTime = "time"
+)
+
 type ListCommand struct {
 	*baseCommand
+
+	// Whether to print details about each file or bucket.
+	long bool
+
+	// Whether to print sizes in K, M, G, etc. rather than bytes.
+	human bool
+
+	// Order in which files are listed.
+	sort string
+
+	// Whether to reverse the order.
+	reverse bool
+
+	// Whether to list all versions of the files instead of the latest.
+	versions bool
+
+	// Decides which files are listed.
+	filter fileFilter
 }
 
 func (c *ListCommand) Help() string {
 	helpText := `
-Usage: b2 list [<path>]
+Usage: b2 list [options] [<path>]
 
-  Lists files and buckets associated with an account.
+  Lists files and buckets associated with an account. Without a path,
+  buckets are listed, or the current folder when run from the shell.
+
+  In the long format, files are listed with the action of the version
+  ("upload", "hide" for hidden files, "start" for unfinished large files
+  or "folder"), size, upload time, content type and name. Buckets are
+  listed with their type, ID, revision and name.
 
 General Options:
 
-  ` + c.generalOptions()
+  ` + c.generalOptions() + `
+
+List Options:
+
+  -human
+    Print sizes in K, M, G, T or P rather than bytes.
+
+  -l
+    Use the long listing format.
+
+  -reverse
+    Reverse the order of the listing.
+
+  -sort=<field>
+    Sort files by "name", "size" (largest first) or "time" (newest
+    first). Defaults to "name". Buckets can only be sorted by name.
+
+  -versions
+    List all versions of the files, including hidden files, from the
+    newest to the oldest.
+
+Filter Options:
+
+  These options apply when listing files. Names are matched relative
+  to the listed path, and folders are only hidden by exclude filters.
+
+  ` + filterOptions()
 	return strings.TrimSpace(helpText)
 }
 
@@ -29,8 +86,21 @@ func (c *ListCommand) Name() string { return "list" }
 func (c *ListCommand) Run(args []string) int {
 	flags := c.flagSet()
 	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.BoolVar(&c.long, "l", false, "")
+	flags.BoolVar(&c.human, "human", false, "")
+	flags.StringVar(&c.sort, "sort", sortName, "")
+	flags.BoolVar(&c.reverse, "reverse", false, "")
+	flags.BoolVar(&c.versions, "versions", false, "")
+	c.filter.addFlags(flags)
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
 
-	if err := flags.Parse(args); err != nil {
+	switch c.sort {
+	case sortName, sortSize, sortTime:
+	default:
+		c.ui.Error(fmt.Sprintf("-sort must be one of %q, %q or %q", sortName, sortSize, sortTime))
 		return 1
 	}
 
@@ -42,11 +112,87 @@ func (c *ListCommand) Run(args []string) int {
 		return 1
 	}
 
-	// No path argument - list buckets
+	// No path argument - list the current folder of the shell, or buckets
 	if numArgs == 0 {
+		if c.shell == nil {
+			return c.listBuckets()
+		}
+		args = []string{"."}
+	}
+
+	path, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	// The root of the shell holds the buckets
+	if path == "" {
 		return c.listBuckets()
 	}
 
 	// User specified a path, so list files in path
-	return c.listFiles(args[0])
+	return c.listFiles(path)
+}
+
+// formatSize returns the size in bytes, or rounded to K, M, G, T or P with
+// at most one decimal if human is set.
+func formatSize(size int64, human bool) string {
+	if !human || size < 1024 {
+		return fmt.Sprint(size)
+	}
+
+	value := float64(size)
+	unit := ""
+	for _, u := range []string{"K", "M", "G", "T", "P"} {
+		value /= 1024
+		unit = u
+		if value < 1024 {
+			break
+		}
+	}
+
+	if value < 10 {
+		return fmt.Sprintf("%.1f%s", value, unit)
+	}
+	return fmt.Sprintf("%.0f%s", value, unit)
+}
+
+// formatColumns aligns the rows into columns separated by two spaces. The
+// columns listed in right are right aligned, and the last column is never
+// padded.
+func formatColumns(rows [][]string, right ...int) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	alignRight := make(map[int]bool, len(right))
+	for _, i := range right {
+		alignRight[i] = true
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			switch {
+			case alignRight[i]:
+				cells[i] = fmt.Sprintf("%*s", widths[i], cell)
+			case i == len(row)-1:
+				cells[i] = cell
+			default:
+				cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+			}
+		}
+		lines = append(lines, strings.Join(cells, "  "))
+	}
+	return lines
 }
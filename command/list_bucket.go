@@ -3,11 +3,18 @@ package command
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/romantomjak/b2/b2"
 )
 
 func (c *ListCommand) listBuckets() int {
+	// Buckets have neither a size nor an upload time
+	if c.sort != sortName {
+		c.ui.Error(fmt.Sprintf("Error: buckets can only be sorted by %q", sortName))
+		return 1
+	}
+
 	client, err := c.Client()
 	if err != nil {
 		c.ui.Error(fmt.Sprintf("Error: %v", err))
@@ -26,8 +33,36 @@ func (c *ListCommand) listBuckets() int {
 		return 1
 	}
 
-	for _, bucket := range buckets {
-		c.ui.Output(bucket.Name + "/")
+	sort.SliceStable(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+
+	if c.reverse {
+		for i, j := 0, len(buckets)-1; i < j; i, j = i+1, j-1 {
+			buckets[i], buckets[j] = buckets[j], buckets[i]
+		}
+	}
+
+	lines := make([]string, len(buckets))
+	if c.long {
+		rows := make([][]string, len(buckets))
+		for i, bucket := range buckets {
+			rows[i] = []string{bucket.Type, bucket.ID, fmt.Sprint(bucket.Revision), bucket.Name + "/"}
+		}
+		lines = formatColumns(rows, 2)
+	} else {
+		for i, bucket := range buckets {
+			lines[i] = bucket.Name + "/"
+		}
+	}
+
+	out := c.newPrinter(true)
+	for i, bucket := range buckets {
+		out.print(lines[i], bucket)
+	}
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
 	}
 
 	return 0
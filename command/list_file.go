@@ -3,7 +3,9 @@ package command
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/romantomjak/b2/b2"
 )
@@ -19,47 +21,108 @@ func (c *ListCommand) listFiles(path string) int {
 
 	ctx := context.TODO()
 
-	bucket, err := findBucketByName(ctx, client, bucketName)
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
 	if err != nil {
 		c.ui.Error(fmt.Sprintf("Error: %v", err))
 		return 1
 	}
 
-	req := &b2.FileListRequest{
-		BucketID:  bucket.ID,
-		Prefix:    filePrefix,
-		Delimiter: "/",
+	var files []b2.File
+	if c.versions {
+		files, err = client.File.ListAllVersions(ctx, &b2.FileVersionListRequest{
+			BucketID:  bucket.ID,
+			Prefix:    filePrefix,
+			Delimiter: "/",
+		})
+	} else {
+		files, err = client.File.ListAll(ctx, &b2.FileListRequest{
+			BucketID:  bucket.ID,
+			Prefix:    filePrefix,
+			Delimiter: "/",
+		})
 	}
-
-	files, _, err := client.File.List(ctx, req)
 	if err != nil {
 		c.ui.Error(fmt.Sprintf("Error: %v", err))
 		return 1
 	}
 
+	matched := files[:0]
 	for _, file := range files {
-		c.ui.Output(file.FileName)
+		name := strings.TrimPrefix(file.FileName, filePrefix)
+		if file.Action == "folder" {
+			if !c.filter.matchName(strings.TrimSuffix(name, "/"), true) {
+				continue
+			}
+		} else if !c.filter.matchRemote(name, file) {
+			continue
+		}
+		matched = append(matched, file)
+	}
+	files = matched
+
+	sortFiles(files, c.sort, c.reverse)
+
+	lines := make([]string, len(files))
+	if c.long {
+		rows := make([][]string, len(files))
+		for i, file := range files {
+			rows[i] = longFileRow(file, c.human)
+		}
+		lines = formatColumns(rows, 1)
+	} else {
+		for i, file := range files {
+			lines[i] = file.FileName
+		}
+	}
+
+	out := c.newPrinter(true)
+	for i, file := range files {
+		out.print(lines[i], file)
+	}
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
 	}
 
 	return 0
 }
 
-func findBucketByName(ctx context.Context, client *b2.Client, name string) (*b2.Bucket, error) {
-	req := &b2.BucketListRequest{
-		AccountID: client.AccountID,
-		Name:      name,
+// sortFiles sorts the files by name, size or upload time. Files of the
+// same size or upload time are kept in the order they were listed in.
+func sortFiles(files []b2.File, by string, reverse bool) {
+	switch by {
+	case sortSize:
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].ContentLength > files[j].ContentLength
+		})
+	case sortTime:
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].UploadTimestamp > files[j].UploadTimestamp
+		})
 	}
 
-	buckets, _, err := client.Bucket.List(ctx, req)
-	if err != nil {
-		return nil, err
+	if reverse {
+		for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+			files[i], files[j] = files[j], files[i]
+		}
+	}
+}
+
+// longFileRow returns the columns of the file in the long listing format.
+// Folders only have a name, so the other columns are left blank.
+func longFileRow(file b2.File, human bool) []string {
+	if file.Action == "folder" {
+		return []string{file.Action, "-", "-", "-", file.FileName}
 	}
 
-	if len(buckets) == 0 {
-		return nil, fmt.Errorf("bucket with name %q was not found", name)
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "-"
 	}
 
-	return &buckets[0], nil
+	uploaded := time.Unix(0, file.UploadTimestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+
+	return []string{file.Action, formatSize(int64(file.ContentLength), human), uploaded, contentType, file.FileName}
 }
 
 func splitBucketAndPrefix(path string) (string, string) {
@@ -1,12 +1,15 @@
 package command
 
 import (
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/mitchellh/cli"
 	"github.com/romantomjak/b2/b2"
 	"github.com/romantomjak/b2/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestListCommand_AcceptsPathArgument(t *testing.T) {
@@ -26,3 +29,131 @@ func TestListCommand_AcceptsPathArgument(t *testing.T) {
 	out := ui.ErrorWriter.String()
 	assert.Contains(t, out, "This command takes one argument: <path>")
 }
+
+func newListTestServer(t *testing.T) *b2.Client {
+	server, mux := testutil.NewServer()
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [
+			{"bucketId": "1", "bucketName": "my-bucket", "bucketType": "allPrivate", "revision": 2},
+			{"bucketId": "22", "bucketName": "other-bucket", "bucketType": "allPublic", "revision": 14}
+		]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files": [
+			{"action": "upload", "fileId": "a", "fileName": "a.txt", "contentLength": 2048, "contentType": "text/plain", "uploadTimestamp": 1536964279000},
+			{"action": "upload", "fileId": "b", "fileName": "b.jpg", "contentLength": 12, "contentType": "image/jpeg", "uploadTimestamp": 1536964380000},
+			{"action": "folder", "fileName": "photos/"}
+		]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_versions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files": [
+			{"action": "hide", "fileId": "a2", "fileName": "a.txt", "uploadTimestamp": 1536964400000},
+			{"action": "upload", "fileId": "a1", "fileName": "a.txt", "contentLength": 2048, "contentType": "text/plain", "uploadTimestamp": 1536964279000}
+		]}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestListCommand_LongFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		out  string
+	}{
+		{
+			"files",
+			[]string{"-l", "my-bucket/"},
+			"upload  2048  2018-09-14T22:31:19Z  text/plain  a.txt\n" +
+				"upload    12  2018-09-14T22:33:00Z  image/jpeg  b.jpg\n" +
+				"folder     -  -                     -           photos/\n",
+		},
+		{
+			"human sizes sorted by size",
+			[]string{"-l", "-human", "-sort", "size", "-reverse", "my-bucket/"},
+			"folder     -  -                     -           photos/\n" +
+				"upload    12  2018-09-14T22:33:00Z  image/jpeg  b.jpg\n" +
+				"upload  2.0K  2018-09-14T22:31:19Z  text/plain  a.txt\n",
+		},
+		{
+			"versions",
+			[]string{"-l", "-versions", "my-bucket/"},
+			"hide       0  2018-09-14T22:33:20Z  -           a.txt\n" +
+				"upload  2048  2018-09-14T22:31:19Z  text/plain  a.txt\n",
+		},
+		{
+			"buckets",
+			[]string{"-l"},
+			"allPrivate  1    2  my-bucket/\n" +
+				"allPublic   22  14  other-bucket/\n",
+		},
+		{
+			"buckets reversed",
+			[]string{"-reverse"},
+			"other-bucket/\nmy-bucket/\n",
+		},
+		{
+			"sorted by time",
+			[]string{"-sort", "time", "my-bucket/"},
+			"b.jpg\na.txt\nphotos/\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &ListCommand{
+				baseCommand: &baseCommand{ui: ui, client: newListTestServer(t)},
+			}
+
+			code := cmd.Run(tt.args)
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			assert.Equal(t, tt.out, ui.OutputWriter.String())
+		})
+	}
+}
+
+func TestListCommand_InvalidSort(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &ListCommand{
+		baseCommand: &baseCommand{ui: ui},
+	}
+
+	code := cmd.Run([]string{"-sort", "date", "my-bucket/"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "-sort must be one of")
+
+	ui = cli.NewMockUi()
+	cmd = &ListCommand{
+		baseCommand: &baseCommand{ui: ui},
+	}
+
+	code = cmd.Run([]string{"-sort", "size"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), `Error: buckets can only be sorted by "name"`)
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size  int64
+		human bool
+		want  string
+	}{
+		{1536, false, "1536"},
+		{1023, true, "1023"},
+		{1536, true, "1.5K"},
+		{10 * 1024 * 1024, true, "10M"},
+		{5000000000, true, "4.7G"},
+		{1 << 50, true, "1.0P"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, formatSize(tt.size, tt.human), "size %d", tt.size)
+	}
+}
@@ -0,0 +1,125 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type LoginCommand struct {
+	*baseCommand
+}
+
+func (c *LoginCommand) Help() string {
+	helpText := `
+Usage: b2 login [options]
+
+  Asks for an application key, checks that it works and saves it to the
+  profile in the configuration file, so that other commands can use it
+  without setting B2_KEY_ID and B2_KEY_SECRET.
+
+  The key is saved to the profile selected with -profile or B2_PROFILE,
+  which is created if it doesn't exist yet. The key ID and secret are
+  only asked for if they are not set already, e.g. with -key-id.
+
+General Options:
+
+  ` + c.generalOptions() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *LoginCommand) Synopsis() string {
+	return "Save an application key to a profile"
+}
+
+func (c *LoginCommand) Name() string { return "login" }
+
+func (c *LoginCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+
+	// The profile is not applied, because it's going to be replaced.
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		c.ui.Error("This command takes no arguments")
+		return 1
+	}
+
+	path, cfg, err := c.loadConfig()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	name, _ := c.profileName(cfg)
+
+	if c.keyId == "" {
+		if c.keyId, err = c.ui.Ask("Application key ID:"); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	}
+	c.keyId = strings.TrimSpace(c.keyId)
+
+	// A key secret file is saved instead of the secret it holds.
+	secretFile := ""
+	if c.keySecret == "" && c.keySecretFile != "" {
+		if secretFile, err = filepath.Abs(c.keySecretFile); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	} else if c.keySecret == "" {
+		if c.keySecret, err = c.ui.AskSecret("Application key:"); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	}
+	c.keySecret = strings.TrimSpace(c.keySecret)
+
+	// Creating a client authorizes the account, which checks the key. An
+	// authorization cached for the key ID would be used without sending the
+	// secret, so it is dropped first.
+	if !c.noCache {
+		if err := c.clearCache(c.keyId); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	}
+	c.client = nil
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]*profile)
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		p = &profile{}
+		cfg.Profiles[name] = p
+	}
+
+	// The key replaces any other way of getting credentials.
+	p.KeyID = c.keyId
+	p.KeySecret = c.keySecret
+	p.KeySecretFile = ""
+	p.CredentialProcess = ""
+	if secretFile != "" {
+		p.KeySecret = ""
+		p.KeySecretFile = secretFile
+	}
+
+	if err := saveConfig(path, cfg); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	c.ui.Output(fmt.Sprintf("Logged in to account %q, key saved to profile %q in %s", client.AccountID, name, path))
+
+	return 0
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginCommand_SavesKeyToProfile(t *testing.T) {
+	server, _ := testutil.NewServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "b2", "config.json")
+	cache, _ := b2.NewInMemoryCache()
+
+	ui := cli.NewMockUi()
+	ui.InputReader = strings.NewReader("key-id\nkey-secret\n")
+	cmd := &LoginCommand{
+		baseCommand: &baseCommand{
+			ui:         ui,
+			cache:      cache,
+			clientOpts: []b2.ClientOpt{b2.SetBaseURL(server.URL)},
+			configPath: configPath,
+		},
+	}
+
+	code := cmd.Run([]string{"-profile", "work"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), `Logged in to account "abc123", key saved to profile "work"`)
+
+	fi, err := os.Stat(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	cfg, err := loadConfig(configPath)
+	require.NoError(t, err)
+	require.Contains(t, cfg.Profiles, "work")
+	assert.Equal(t, "key-id", cfg.Profiles["work"].KeyID)
+	assert.Equal(t, "key-secret", cfg.Profiles["work"].KeySecret)
+}
+
+func TestLoginCommand_RejectsInvalidKey(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"status": 401, "code": "unauthorized", "message": "The applicationKeyId and/or the applicationKey are wrong."}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	cache, _ := b2.NewInMemoryCache()
+
+	ui := cli.NewMockUi()
+	ui.InputReader = strings.NewReader("key-id\nwrong-secret\n")
+	cmd := &LoginCommand{
+		baseCommand: &baseCommand{
+			ui:         ui,
+			cache:      cache,
+			clientOpts: []b2.ClientOpt{b2.SetBaseURL(server.URL)},
+			configPath: configPath,
+		},
+	}
+
+	code := cmd.Run(nil)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "The applicationKeyId and/or the applicationKey are wrong.")
+
+	_, err = os.Stat(configPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoginCommand_ChecksSecretOfCachedKey(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		if _, secret, _ := r.BasicAuth(); secret != "key-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"status": 401, "code": "unauthorized", "message": "The applicationKeyId and/or the applicationKey are wrong."}`)
+			return
+		}
+		fmt.Fprint(w, `{"accountId": "abc123", "authorizationToken": "token"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+
+	// Authorize the key, so that the cache holds its authorization
+	cache, _ := b2.NewInMemoryCache()
+	_, err = b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	ui := cli.NewMockUi()
+	ui.InputReader = strings.NewReader("key-id\nwrong-secret\n")
+	cmd := &LoginCommand{
+		baseCommand: &baseCommand{
+			ui:         ui,
+			cache:      cache,
+			clientOpts: []b2.ClientOpt{b2.SetBaseURL(server.URL)},
+			configPath: configPath,
+		},
+	}
+
+	code := cmd.Run(nil)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "The applicationKeyId and/or the applicationKey are wrong.")
+
+	_, err = os.Stat(configPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLogoutCommand_RemovesKeyAndClearsCache(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	lookups := 0
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "1", "bucketName": "my-bucket"}]}`)
+	})
+
+	configPath := writeTestConfig(t, `{
+		"profiles": {
+			"default": {"key_id": "key-id", "key_secret": "key-secret", "bucket": "my-bucket"}
+		}
+	}`)
+
+	// Fill the cache with a bucket ID
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+	_, err = client.Bucket.Lookup(context.TODO(), "my-bucket")
+	require.NoError(t, err)
+
+	ui := cli.NewMockUi()
+	cmd := &LogoutCommand{
+		baseCommand: &baseCommand{ui: ui, cache: cache, configPath: configPath},
+	}
+
+	code := cmd.Run(nil)
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), `Removed key from profile "default"`)
+
+	cfg, err := loadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, &profile{Bucket: "my-bucket"}, cfg.Profiles["default"])
+
+	// The bucket has to be looked up again
+	client, err = b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+	_, err = client.Bucket.Lookup(context.TODO(), "my-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, 2, lookups)
+
+	// Logging out again is fine
+	ui = cli.NewMockUi()
+	cmd = &LogoutCommand{
+		baseCommand: &baseCommand{ui: ui, cache: cache, configPath: configPath},
+	}
+
+	code = cmd.Run(nil)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, ui.OutputWriter.String(), `No key is saved in profile "default"`)
+}
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+type LogoutCommand struct {
+	*baseCommand
+}
+
+func (c *LogoutCommand) Help() string {
+	helpText := `
+Usage: b2 logout [options]
+
+  Removes the application key from the profile in the configuration file
+  and clears the cached authorization and bucket IDs of the key.
+
+  Other settings of the profile, such as the default bucket, are kept.
+
+General Options:
+
+  ` + c.generalOptions() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *LogoutCommand) Synopsis() string {
+	return "Remove an application key from a profile"
+}
+
+func (c *LogoutCommand) Name() string { return "logout" }
+
+func (c *LogoutCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		c.ui.Error("This command takes no arguments")
+		return 1
+	}
+
+	path, cfg, err := c.loadConfig()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	name, _ := c.profileName(cfg)
+
+	// Clear the cache of the key given on the command line or in the
+	// environment, if any, as well as the key stored in the profile.
+	keyIDs := []string{}
+	if c.keyId != "" {
+		keyIDs = append(keyIDs, c.keyId)
+	}
+
+	p, ok := cfg.Profiles[name]
+	if ok && p.KeyID != "" && p.KeyID != c.keyId {
+		keyIDs = append(keyIDs, p.KeyID)
+	}
+
+	for _, keyID := range keyIDs {
+		if err := c.clearCache(keyID); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	}
+
+	if !ok || (p.KeyID == "" && p.KeySecret == "" && p.KeySecretFile == "" && p.CredentialProcess == "") {
+		c.ui.Output(fmt.Sprintf("No key is saved in profile %q", name))
+		return 0
+	}
+
+	p.KeyID = ""
+	p.KeySecret = ""
+	p.KeySecretFile = ""
+	p.CredentialProcess = ""
+
+	if err := saveConfig(path, cfg); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	c.ui.Output(fmt.Sprintf("Removed key from profile %q in %s", name, path))
+
+	return 0
+}
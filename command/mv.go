@@ -0,0 +1,457 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/cli"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+// maxCopySize is the size of the largest file that can be copied at once.
+// Larger files are copied in parts.
+const maxCopySize = 5000000000
+
+// maxLargeFileParts is the maximum number of parts of a large file.
+const maxLargeFileParts = 10000
+
+// errUnverifiedCopy is returned for copies without a SHA1 checksum computed
+// by B2, i.e. of files that were uploaded or copied in parts. Their
+// large_file_sha1 is copied from the source, so it proves nothing.
+var errUnverifiedCopy = errors.New("the copy can't be verified without a SHA1 checksum computed by B2, the source was kept")
+
+type MoveCommand struct {
+	*baseCommand
+
+	// Whether to move all files under the prefix.
+	recursive bool
+
+	// Whether to hide the source files rather than deleting them.
+	hide bool
+
+	// Maximum number of files moved in parallel.
+	concurrency int
+}
+
+func (c *MoveCommand) Help() string {
+	helpText := `
+Usage: b2 mv [options] <source> <destination>
+
+  Moves or renames a file, e.g. "my-bucket/old.txt" to "my-bucket/new.txt".
+  If the destination ends with a slash, the file keeps its name and is
+  moved into that folder. The destination may be in another bucket.
+
+  With -R, all files under the source prefix are moved to the destination
+  prefix, keeping their paths relative to the prefix.
+
+  B2 can't rename files, so each file is copied on the server and the
+  source file is deleted once the SHA1 checksum of the copy matches the
+  source. Only the latest version of a file is copied, and that version
+  and all older versions of the source file are deleted. B2 computes no
+  checksum of files that were uploaded in parts, nor of files larger than
+  5 GB, which are copied in parts, so those are copied but their source
+  files are kept.
+
+  A move that was interrupted can be run again. Files that were already
+  copied are not copied again.
+
+General Options:
+
+  ` + c.generalOptions() + `
+
+Move Options:
+
+  -concurrency=<n>
+    Number of files to move in parallel. Defaults to 4.
+
+  -hide
+    Hide the source files instead of deleting them, keeping all of
+    their versions.
+
+  -R
+    Move all files under the prefix recursively.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *MoveCommand) Synopsis() string {
+	return "Move or rename files"
+}
+
+func (c *MoveCommand) Name() string { return "mv" }
+
+// move is a file that is moved to a new name.
+type move struct {
+	source      b2.File
+	destination string
+
+	// The latest version of the destination file, if it exists.
+	existing *b2.File
+}
+
+func (c *MoveCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.BoolVar(&c.recursive, "R", false, "")
+	flags.BoolVar(&c.hide, "hide", false, "")
+	flags.IntVar(&c.concurrency, "concurrency", 4, "")
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got both arguments
+	args = flags.Args()
+	if len(args) != 2 {
+		c.ui.Error("This command takes two arguments: <source> and <destination>")
+		return 1
+	}
+
+	if c.concurrency < 1 {
+		c.ui.Error("-concurrency must be at least 1")
+		return 1
+	}
+
+	source, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	srcBucketName, srcName := splitBucketAndPrefix(source)
+
+	destination, err := c.bucketPath(args[1])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	dstBucketName, dstName := splitBucketAndPrefix(destination)
+
+	if !c.recursive && (srcName == "" || strings.HasSuffix(srcName, "/")) {
+		c.ui.Error(fmt.Sprintf("Error: %s is a folder, use -R to move it", args[0]))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ctx := context.TODO()
+
+	srcBucket, err := client.Bucket.Lookup(ctx, srcBucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	dstBucket, err := client.Bucket.Lookup(ctx, dstBucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	var moves []move
+	if c.recursive {
+		moves, err = c.listMoves(ctx, client, srcBucket, syncPrefix(srcName), dstBucket, syncPrefix(dstName))
+	} else {
+		moves, err = c.fileMove(ctx, client, srcBucket, srcName, dstBucket, dstName)
+	}
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return c.execute(ctx, client, srcBucket, dstBucket, moves)
+}
+
+// fileMove returns the move of a single file. A destination ending with a
+// slash is a folder the file is moved into.
+func (c *MoveCommand) fileMove(ctx context.Context, client *b2.Client, srcBucket *b2.Bucket, srcName string, dstBucket *b2.Bucket, dstName string) ([]move, error) {
+	if dstName == "" || strings.HasSuffix(dstName, "/") {
+		dstName += path.Base(srcName)
+	}
+
+	if srcBucket.ID == dstBucket.ID && srcName == dstName {
+		return nil, errors.New("source and destination are the same file")
+	}
+
+	source, err := statFile(ctx, client, srcBucket.ID, srcName)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := findFile(ctx, client, dstBucket.ID, dstName)
+	if err != nil {
+		return nil, err
+	}
+
+	return []move{{source: *source, destination: dstName, existing: existing}}, nil
+}
+
+// listMoves returns the moves of all files under the source prefix.
+func (c *MoveCommand) listMoves(ctx context.Context, client *b2.Client, srcBucket *b2.Bucket, srcPrefix string, dstBucket *b2.Bucket, dstPrefix string) ([]move, error) {
+	// Moving a folder into itself would move the moved files again when
+	// an interrupted move is resumed.
+	if srcBucket.ID == dstBucket.ID && strings.HasPrefix(dstPrefix, srcPrefix) {
+		return nil, errors.New("source and destination folders overlap")
+	}
+
+	sources, err := listRemoteFiles(ctx, client, srcBucket.ID, srcPrefix, &fileFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := listRemoteFiles(ctx, client, dstBucket.ID, dstPrefix, &fileFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make([]move, 0, len(sources))
+	for _, name := range remoteNames(sources) {
+		m := move{source: sources[name], destination: dstPrefix + name}
+		if file, ok := existing[name]; ok {
+			m.existing = &file
+		}
+		moves = append(moves, m)
+	}
+	return moves, nil
+}
+
+// execute performs every move using a pool of workers.
+func (c *MoveCommand) execute(ctx context.Context, client *b2.Client, srcBucket, dstBucket *b2.Bucket, moves []move) int {
+	ui := &cli.ConcurrentUi{Ui: c.ui}
+	out := c.newPrinter(c.recursive)
+
+	sem := semaphore.NewWeighted(int64(c.concurrency))
+
+	var mu sync.Mutex
+	failed := 0
+
+	for _, m := range moves {
+		// Blocks until a worker becomes available
+		if err := sem.Acquire(ctx, 1); err != nil {
+			ui.Error(fmt.Sprintf("Error: failed to acquire semaphore: %v", err))
+			return 1
+		}
+
+		go func(m move) {
+			defer sem.Release(1)
+
+			src := srcBucket.Name + "/" + m.source.FileName
+			dst := dstBucket.Name + "/" + m.destination
+
+			file, err := c.moveFile(ctx, client, srcBucket, dstBucket, m)
+			if err != nil {
+				ui.Error(fmt.Sprintf("Error: move %s: %v", src, err))
+				mu.Lock()
+				failed++
+				mu.Unlock()
+				return
+			}
+
+			out.print(fmt.Sprintf("move: %s -> %s", src, dst), transferResult{
+				Action:      "move",
+				Source:      src,
+				Destination: dst,
+				File:        file,
+			})
+		}(m)
+	}
+
+	// Acquire all of the tokens to wait for any remaining workers to finish.
+	if err := sem.Acquire(ctx, int64(c.concurrency)); err != nil {
+		ui.Error(fmt.Sprintf("Error: failed to acquire semaphore: %v", err))
+		return 1
+	}
+
+	code := 0
+	if failed > 0 {
+		ui.Error(fmt.Sprintf("Error: %d of %d files could not be moved", failed, len(moves)))
+		code = 1
+	}
+
+	if err := out.flush(); err != nil {
+		ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return code
+}
+
+// moveFile copies the file unless an identical copy already exists, and
+// then deletes or hides the source file.
+func (c *MoveCommand) moveFile(ctx context.Context, client *b2.Client, srcBucket, dstBucket *b2.Bucket, m move) (*b2.File, error) {
+	// A copy made by a move that was interrupted before deleting the
+	// source can be used as it is. A copy that can't be verified isn't
+	// made again, because the next copy couldn't be verified either.
+	copied := m.existing
+	reuse := copied != nil
+
+	var err error
+	if reuse {
+		err = verifyCopy(m.source, *copied)
+		reuse = err == nil || err == errUnverifiedCopy
+	}
+
+	if !reuse {
+		copied, err = copyFile(ctx, client, m.source, dstBucket.ID, m.destination)
+		if err != nil {
+			return nil, err
+		}
+		err = verifyCopy(m.source, *copied)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.hide {
+		_, err := client.File.Hide(ctx, &b2.HideFileRequest{BucketID: srcBucket.ID, FileName: m.source.FileName})
+		if err != nil {
+			return nil, err
+		}
+		return copied, nil
+	}
+
+	if err := deleteOlderVersions(ctx, client, srcBucket.ID, m.source); err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
+
+// verifyCopy checks that the copy has the same size and SHA1 checksum as
+// the source. Only the checksums B2 computed of the contents count, so
+// copies of files that were uploaded or copied in parts can't be verified.
+func verifyCopy(source, copied b2.File) error {
+	if source.ContentLength != copied.ContentLength {
+		return fmt.Errorf("size of the copy %d doesn't match the size of the source %d", copied.ContentLength, source.ContentLength)
+	}
+
+	if !hasContentSHA1(source) || !hasContentSHA1(copied) {
+		return errUnverifiedCopy
+	}
+
+	if copied.ContentSHA1 != source.ContentSHA1 {
+		return fmt.Errorf("SHA1 of the copy %q doesn't match the SHA1 of the source %q", copied.ContentSHA1, source.ContentSHA1)
+	}
+
+	return nil
+}
+
+// hasContentSHA1 reports whether B2 computed the SHA1 checksum of the file.
+// Files that were uploaded in parts have "none" instead.
+func hasContentSHA1(file b2.File) bool {
+	return file.ContentSHA1 != "" && file.ContentSHA1 != "none"
+}
+
+// copyFile copies the file on the server, in parts if it's too large to be
+// copied at once.
+func copyFile(ctx context.Context, client *b2.Client, source b2.File, bucketID, filename string) (*b2.File, error) {
+	if source.ContentLength <= maxCopySize {
+		return client.File.Copy(ctx, &b2.CopyFileRequest{
+			SourceFileID:        source.FileID,
+			DestinationBucketID: bucketID,
+			FileName:            filename,
+		})
+	}
+
+	file, err := client.File.StartLargeFile(ctx, &b2.StartLargeFileRequest{
+		BucketID:    bucketID,
+		Filename:    filename,
+		ContentType: source.ContentType,
+		FileInfo:    source.FileInfo,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sha1s, err := copyParts(ctx, client, source, file.FileID)
+	if err != nil {
+		// Don't leave the parts behind, they're billed as stored data
+		client.File.CancelLargeFile(ctx, &b2.CancelLargeFileRequest{FileID: file.FileID})
+		return nil, err
+	}
+
+	return client.File.FinishLargeFile(ctx, &b2.FinishLargeFileRequest{
+		FileID:   file.FileID,
+		PartSHA1: sha1s,
+	})
+}
+
+// copyParts copies the source to the parts of a large file and returns the
+// SHA1 checksums of the parts.
+func copyParts(ctx context.Context, client *b2.Client, source b2.File, largeFileID string) ([]string, error) {
+	size := int64(source.ContentLength)
+
+	partSize := client.RecommendedPartSize
+	if smallest := (size + maxLargeFileParts - 1) / maxLargeFileParts; partSize < smallest {
+		partSize = smallest
+	}
+
+	var sha1s []string
+	for start, number := int64(0), int64(1); start < size; start, number = start+partSize, number+1 {
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		part, err := client.File.CopyPart(ctx, &b2.CopyPartRequest{
+			SourceFileID: source.FileID,
+			LargeFileID:  largeFileID,
+			PartNumber:   number,
+			Range:        fmt.Sprintf("bytes=%d-%d", start, end),
+		})
+		if err != nil {
+			return nil, err
+		}
+		sha1s = append(sha1s, part.ContentSHA1)
+	}
+
+	return sha1s, nil
+}
+
+// deleteOlderVersions deletes the version of the source file and all older
+// versions. Versions are deleted from the oldest to the newest, so that a
+// move that was interrupted never leaves an older version as the latest.
+func deleteOlderVersions(ctx context.Context, client *b2.Client, bucketID string, source b2.File) error {
+	files, err := client.File.ListAllVersions(ctx, &b2.FileVersionListRequest{
+		BucketID:      bucketID,
+		StartFileName: source.FileName,
+		Prefix:        source.FileName,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Versions uploaded after the copy was made are kept
+	var versions []b2.File
+	for _, file := range files {
+		if file.FileName != source.FileName {
+			continue
+		}
+		if file.FileID == source.FileID || len(versions) > 0 {
+			versions = append(versions, file)
+		}
+	}
+
+	if len(versions) == 0 {
+		return fmt.Errorf("version %s of the source was not found", source.FileID)
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		req := &b2.DeleteFileVersionRequest{FileName: versions[i].FileName, FileID: versions[i].FileID}
+		if _, err := client.File.DeleteVersion(ctx, req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+)
+
+func TestMoveCommand_RenamesFile(t *testing.T) {
+	bucket := &testBucket{}
+	bucket.add(b2.File{FileID: "old", FileName: "a.txt", ContentLength: 3, ContentSHA1: "sha-old"})
+	bucket.add(b2.File{FileID: "new", FileName: "a.txt", ContentLength: 4, ContentSHA1: "sha-new"})
+	bucket.add(b2.File{FileID: "other", FileName: "a.txt.bak", ContentLength: 4, ContentSHA1: "sha-bak"})
+
+	ui := cli.NewMockUi()
+	cmd := &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"my-bucket/a.txt", "my-bucket/docs/"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, "move: my-bucket/a.txt -> my-bucket/docs/a.txt\n", ui.OutputWriter.String())
+
+	assert.Equal(t, []string{"docs/a.txt"}, bucket.copied)
+	// Older versions are deleted first
+	assert.Equal(t, []string{"old", "new"}, bucket.deleted)
+
+	files := bucket.list("", "", 0, false)
+	require.Len(t, files, 2)
+	assert.Equal(t, "a.txt.bak", files[0].FileName)
+	assert.Equal(t, "docs/a.txt", files[1].FileName)
+	assert.Equal(t, "sha-new", files[1].ContentSHA1)
+}
+
+func TestMoveCommand_ResumesInterruptedMove(t *testing.T) {
+	bucket := &testBucket{}
+	bucket.add(b2.File{FileName: "photos/cat.jpg", ContentLength: 3, ContentSHA1: "sha-cat"})
+	bucket.add(b2.File{FileName: "photos/2020/dog.jpg", ContentLength: 4, ContentSHA1: "sha-dog"})
+
+	// The first move was interrupted after copying cat.jpg
+	bucket.add(b2.File{FileName: "archive/photos/cat.jpg", ContentLength: 3, ContentSHA1: "sha-cat"})
+
+	ui := cli.NewMockUi()
+	cmd := &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"-R", "my-bucket/photos", "my-bucket/archive/photos"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	assert.Equal(t, []string{"archive/photos/2020/dog.jpg"}, bucket.copied)
+	assert.Empty(t, bucket.list("photos/", "", 0, false))
+	assert.Len(t, bucket.list("archive/photos/", "", 0, false), 2)
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "move: my-bucket/photos/cat.jpg -> my-bucket/archive/photos/cat.jpg\n")
+	assert.Contains(t, out, "move: my-bucket/photos/2020/dog.jpg -> my-bucket/archive/photos/2020/dog.jpg\n")
+
+	// Running it again is fine, there's nothing left to move
+	ui = cli.NewMockUi()
+	cmd = &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code = cmd.Run([]string{"-R", "my-bucket/photos", "my-bucket/archive/photos"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Empty(t, ui.OutputWriter.String())
+	assert.Len(t, bucket.copied, 1)
+}
+
+func TestMoveCommand_HidesSource(t *testing.T) {
+	bucket := &testBucket{}
+	bucket.add(b2.File{FileID: "a", FileName: "a.txt", ContentLength: 3, ContentSHA1: "sha-a"})
+
+	ui := cli.NewMockUi()
+	cmd := &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"-hide", "my-bucket/a.txt", "my-bucket/b.txt"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	assert.Empty(t, bucket.deleted)
+	assert.Empty(t, bucket.list("a.txt", "", 0, true))
+	assert.Len(t, bucket.list("a.txt", "", 0, false), 2)
+}
+
+func TestMoveCommand_KeepsSourceIfChecksumDiffers(t *testing.T) {
+	bucket := &testBucket{corrupt: true}
+	bucket.add(b2.File{FileID: "a", FileName: "a.txt", ContentLength: 3, ContentSHA1: "sha-a"})
+
+	ui := cli.NewMockUi()
+	cmd := &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"my-bucket/a.txt", "my-bucket/b.txt"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), `SHA1 of the copy "0000000000000000000000000000000000000000" doesn't match the SHA1 of the source "sha-a"`)
+	assert.Empty(t, bucket.deleted)
+}
+
+func TestMoveCommand_MovesFolderIntoParent(t *testing.T) {
+	bucket := &testBucket{}
+	bucket.add(b2.File{FileName: "photos/2020/dog.jpg", ContentLength: 4, ContentSHA1: "sha-dog"})
+
+	ui := cli.NewMockUi()
+	cmd := &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"-R", "my-bucket/photos/2020", "my-bucket/photos"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	assert.Equal(t, []string{"photos/dog.jpg"}, bucket.copied)
+	assert.Empty(t, bucket.list("photos/2020/", "", 0, false))
+}
+
+func TestMoveCommand_KeepsSourceOfUnverifiedCopy(t *testing.T) {
+	bucket := &testBucket{}
+	bucket.add(b2.File{FileName: "big.mp4", ContentLength: maxCopySize + 1, FileInfo: map[string]string{"large_file_sha1": "sha-big"}})
+
+	// The file was copied by an earlier move
+	bucket.add(b2.File{FileName: "archive/big.mp4", ContentLength: maxCopySize + 1, FileInfo: map[string]string{"large_file_sha1": "sha-big"}})
+
+	ui := cli.NewMockUi()
+	cmd := &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"my-bucket/big.mp4", "my-bucket/archive/"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "the copy can't be verified")
+	assert.Empty(t, bucket.copied)
+	assert.Empty(t, bucket.deleted)
+}
+
+func TestMoveCommand_KeepsSourceUploadedInParts(t *testing.T) {
+	bucket := &testBucket{}
+	bucket.add(b2.File{FileID: "a", FileName: "a.bin", ContentLength: 10, ContentSHA1: "none", FileInfo: map[string]string{"large_file_sha1": "sha-a"}})
+
+	ui := cli.NewMockUi()
+	cmd := &MoveCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"my-bucket/a.bin", "my-bucket/b.bin"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "the copy can't be verified")
+	assert.Equal(t, []string{"b.bin"}, bucket.copied)
+	assert.Empty(t, bucket.deleted)
+}
+
+func TestMoveCommand_InvalidArguments(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"my-bucket/photos/", "my-bucket/archive/"}, "my-bucket/photos/ is a folder, use -R to move it"},
+		{[]string{"-R", "my-bucket/photos", "my-bucket/photos/2020"}, "source and destination folders overlap"},
+		{[]string{"my-bucket/a.txt", "my-bucket/"}, "source and destination are the same file"},
+		{[]string{"my-bucket/missing.txt", "my-bucket/b.txt"}, `file "missing.txt" was not found`},
+	}
+
+	for _, tt := range tests {
+		ui := cli.NewMockUi()
+		cmd := &MoveCommand{
+			baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, &testBucket{})},
+		}
+
+		code := cmd.Run(tt.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tt.err)
+	}
+}
+
+func TestCopyFile_CopiesLargeFilesInParts(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	mux.HandleFunc("/b2api/v2/b2_start_large_file", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.StartLargeFileRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		assert.Equal(t, "video/mp4", req.ContentType)
+		assert.Equal(t, "sha-big", req.FileInfo["large_file_sha1"])
+		fmt.Fprint(w, `{"fileId": "large-id"}`)
+	})
+
+	var ranges []string
+	mux.HandleFunc("/b2api/v2/b2_copy_part", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.CopyPartRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		assert.Equal(t, "big", req.SourceFileID)
+		assert.Equal(t, "large-id", req.LargeFileID)
+		assert.Equal(t, int64(len(ranges)+1), req.PartNumber)
+		ranges = append(ranges, req.Range)
+		fmt.Fprintf(w, `{"partNumber": %d, "contentSha1": "sha-%d"}`, req.PartNumber, req.PartNumber)
+	})
+
+	var sha1s []string
+	mux.HandleFunc("/b2api/v2/b2_finish_large_file", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.FinishLargeFileRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		sha1s = req.PartSHA1
+		fmt.Fprint(w, `{"fileId": "large-id", "fileName": "copy.mp4", "contentLength": 5000000001, "fileInfo": {"large_file_sha1": "sha-big"}}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	source := b2.File{
+		FileID:        "big",
+		FileName:      "big.mp4",
+		ContentLength: 5000000001,
+		ContentSHA1:   "none",
+		ContentType:   "video/mp4",
+		FileInfo:      map[string]string{"large_file_sha1": "sha-big"},
+	}
+
+	file, err := copyFile(context.TODO(), client, source, "1", "copy.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, errUnverifiedCopy, verifyCopy(source, *file))
+
+	require.Len(t, ranges, 51)
+	assert.Equal(t, "bytes=0-99999999", ranges[0])
+	assert.Equal(t, "bytes=5000000000-5000000000", ranges[50])
+	assert.Len(t, sha1s, 51)
+	assert.Equal(t, "sha-51", sha1s[50])
+}
@@ -0,0 +1,176 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+)
+
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatJSONL    = "jsonl"
+	formatTemplate = "template"
+)
+
+// templateFuncs are available in -template in addition to the built-in
+// functions of text/template.
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseOutputFormat checks the -format and -template options.
+func (c *baseCommand) parseOutputFormat() error {
+	if c.template != "" && (c.format == "" || c.format == formatText) {
+		c.format = formatTemplate
+	}
+
+	switch c.format {
+	case "":
+		c.format = formatText
+	case formatText, formatJSON, formatJSONL:
+		if c.template != "" {
+			return fmt.Errorf("-template can't be used with -format=%s", c.format)
+		}
+	case formatTemplate:
+		if c.template == "" {
+			return errors.New("-format=template requires -template")
+		}
+	default:
+		return fmt.Errorf("-format must be one of %q, %q, %q or %q", formatText, formatJSON, formatJSONL, formatTemplate)
+	}
+
+	if c.format == formatTemplate {
+		tmpl, err := template.New("output").Funcs(templateFuncs).Parse(c.template)
+		if err != nil {
+			return fmt.Errorf("invalid -template: %v", err)
+		}
+		c.tmpl = tmpl
+	}
+
+	return nil
+}
+
+// textOutput returns whether output is meant for humans, in which case
+// progress bars and other chatter may be shown.
+func (c *baseCommand) textOutput() bool {
+	return c.format == "" || c.format == formatText
+}
+
+// resultPrinter prints the results of a command in the selected output
+// format. It's safe for concurrent use.
+type resultPrinter struct {
+	ui     cli.Ui
+	format string
+	tmpl   *template.Template
+
+	// Whether the results are printed as a JSON array rather than a single
+	// JSON object.
+	list bool
+
+	mu      sync.Mutex
+	results []interface{}
+	err     error
+}
+
+// newPrinter returns a printer for a single result, or for a list of
+// results if list is set.
+func (c *baseCommand) newPrinter(list bool) *resultPrinter {
+	format := c.format
+	if format == "" {
+		format = formatText
+	}
+	return &resultPrinter{ui: c.ui, format: format, tmpl: c.tmpl, list: list}
+}
+
+// print prints the result, or text if the output is meant for humans.
+func (p *resultPrinter) print(text string, result interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.format {
+	case formatText:
+		p.ui.Output(text)
+	case formatJSON:
+		p.results = append(p.results, result)
+	case formatJSONL:
+		b, err := json.Marshal(result)
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		p.ui.Output(string(b))
+	case formatTemplate:
+		var buf bytes.Buffer
+		if err := p.tmpl.Execute(&buf, result); err != nil {
+			p.fail(err)
+			return
+		}
+		p.ui.Output(strings.TrimSuffix(buf.String(), "\n"))
+	}
+}
+
+// fail records the first error.
+func (p *resultPrinter) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// flush prints results that are printed all at once and returns the first
+// error that occurred while printing.
+func (p *resultPrinter) flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	if p.format != formatJSON {
+		return nil
+	}
+
+	var v interface{} = p.results
+	if !p.list {
+		if len(p.results) == 0 {
+			return nil
+		}
+		v = p.results[0]
+	} else if p.results == nil {
+		v = []interface{}{}
+	}
+
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	p.ui.Output(string(b))
+
+	return nil
+}
+
+// transferResult describes a file that was uploaded, downloaded or deleted.
+type transferResult struct {
+	// Kind of transfer, e.g. "upload".
+	Action string `json:"action"`
+
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+
+	// Whether the transfer was only planned, but not performed.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// The file in the bucket.
+	File *b2.File `json:"file,omitempty"`
+}
@@ -0,0 +1,159 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOutputTestServer(t *testing.T) *b2.Client {
+	server, mux := testutil.NewServer()
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [
+			{"bucketId": "1", "bucketName": "my-bucket", "bucketType": "allPrivate"},
+			{"bucketId": "2", "bucketName": "other-bucket", "bucketType": "allPublic"}
+		]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files": [
+			{"action": "upload", "fileId": "a", "fileName": "a.txt", "contentLength": 7, "contentSha1": "dc724af18fbdd4e59189f5fe768a5f8311527050", "contentType": "text/plain", "uploadTimestamp": 1536964279000, "fileInfo": {"src_last_modified_millis": "1536964184056"}},
+			{"action": "upload", "fileId": "b", "fileName": "b.txt", "contentLength": 8}
+		]}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestOutput_ListFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		out  string
+	}{
+		{"text", nil, "a.txt\nb.txt\n"},
+		{"jsonl", []string{"-format", "jsonl"}, ""},
+		{"template", []string{"-template", "{{.FileName}} {{.ContentLength}}"}, "a.txt 7\nb.txt 8\n"},
+		{"template format", []string{"-format", "template", "-template", "{{.FileID}}"}, "a\nb\n"},
+		{"template json func", []string{"-template", "{{json .FileInfo}}"}, "{\"src_last_modified_millis\":\"1536964184056\"}\nnull\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &ListCommand{
+				baseCommand: &baseCommand{ui: ui, client: newOutputTestServer(t)},
+			}
+
+			code := cmd.Run(append(tt.args, "my-bucket/"))
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+			if tt.name != "jsonl" {
+				assert.Equal(t, tt.out, ui.OutputWriter.String())
+				return
+			}
+
+			lines := strings.Split(strings.TrimSpace(ui.OutputWriter.String()), "\n")
+			require.Len(t, lines, 2)
+			var file b2.File
+			require.NoError(t, json.Unmarshal([]byte(lines[1]), &file))
+			assert.Equal(t, "b.txt", file.FileName)
+			assert.Equal(t, 8, file.ContentLength)
+		})
+	}
+}
+
+func TestOutput_ListBucketsAsJSON(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &ListCommand{
+		baseCommand: &baseCommand{ui: ui, client: newOutputTestServer(t)},
+	}
+
+	code := cmd.Run([]string{"-format", "json"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var buckets []b2.Bucket
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &buckets))
+	require.Len(t, buckets, 2)
+	assert.Equal(t, "other-bucket", buckets[1].Name)
+	assert.Equal(t, "allPublic", buckets[1].Type)
+}
+
+func TestOutput_InvalidFormat(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-format", "xml"}, "-format must be one of"},
+		{[]string{"-format", "template"}, "-format=template requires -template"},
+		{[]string{"-format", "json", "-template", "{{.}}"}, "-template can't be used with -format=json"},
+		{[]string{"-template", "{{.FileName"}, "invalid -template"},
+	}
+
+	for _, tt := range tests {
+		ui := cli.NewMockUi()
+		cmd := &ListCommand{
+			baseCommand: &baseCommand{ui: ui},
+		}
+
+		code := cmd.Run(tt.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tt.err)
+	}
+}
+
+func TestStatCommand_File(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &StatCommand{
+		baseCommand: &baseCommand{ui: ui, client: newOutputTestServer(t)},
+	}
+
+	code := cmd.Run([]string{"my-bucket/a.txt"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "Name:         my-bucket/a.txt\n")
+	assert.Contains(t, out, "Size:         7\n")
+	assert.Contains(t, out, "SHA1:         dc724af18fbdd4e59189f5fe768a5f8311527050\n")
+	assert.Contains(t, out, "Uploaded:     2018-09-14T22:31:19Z\n")
+	assert.Contains(t, out, "Modified:     2018-09-14T22:29:44Z\n")
+	assert.Contains(t, out, "Info:         src_last_modified_millis=1536964184056\n")
+
+	// The API returns the next file if the name doesn't exist
+	ui = cli.NewMockUi()
+	cmd = &StatCommand{
+		baseCommand: &baseCommand{ui: ui, client: newOutputTestServer(t)},
+	}
+
+	code = cmd.Run([]string{"my-bucket/0.txt"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), `file "0.txt" was not found`)
+}
+
+func TestStatCommand_BucketAsJSON(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &StatCommand{
+		baseCommand: &baseCommand{ui: ui, client: newOutputTestServer(t)},
+	}
+
+	code := cmd.Run([]string{"-format", "json", "my-bucket"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var bucket b2.Bucket
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &bucket))
+	assert.Equal(t, "1", bucket.ID)
+	assert.Equal(t, "allPrivate", bucket.Type)
+}
@@ -1,31 +1,117 @@
 package command
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
 	"strings"
 	"time"
 
 	"github.com/gosuri/uiprogress"
+	"github.com/romantomjak/b2/b2"
+)
+
+const (
+	// B2 accepts parts of large files between 5MB and 5GB.
+	minPartSize = 5000000
+	maxPartSize = 5000000000
 )
 
 type PutCommand struct {
 	*baseCommand
+
+	// MIME type of the uploaded file. Empty means B2 will pick one.
+	contentType string
+
+	// Custom file info stored along with the uploaded file.
+	fileInfo map[string]string
+
+	// HTTP headers B2 will serve the uploaded file with.
+	responseHeaders b2.ResponseHeaders
+
+	// Whether to hide progress bars, e.g. when uploading files in
+	// parallel.
+	quiet bool
+
+	// Whether to upload directories recursively.
+	recursive bool
+
+	// Maximum number of files uploaded in parallel.
+	concurrency int
+
+	// Size of the parts large files are uploaded in. Defaults to the
+	// part size recommended by B2.
+	partSize sizeValue
+
+	// Decides which files are uploaded with -R.
+	filter fileFilter
 }
 
 func (c *PutCommand) Help() string {
 	helpText := `
-Usage: b2 put <source> <destination>
+Usage: b2 put [options] <source> <destination>
 
   Uploads the contents of source to destination. If destination
   contains a trailing slash it is treated as a directory and
   file is uploaded keeping the original filename.
 
+  Directories are uploaded with -R. Files keep their paths relative
+  to the source directory under the destination.
+
 General Options:
 
-  ` + c.generalOptions()
+  ` + c.generalOptions() + `
+
+Put Options:
+
+  -cache-control
+    The Cache-Control header to serve the file with, e.g.
+    "public, max-age=86400".
+
+  -content-disposition
+    The Content-Disposition header to serve the file with, e.g.
+    'attachment; filename="report.pdf"'.
+
+  -content-encoding
+    The Content-Encoding header to serve the file with, e.g. "gzip".
+
+  -content-language
+    The Content-Language header to serve the file with, e.g. "en-US".
+
+  -content-type
+    The MIME type of the file, e.g. "text/plain". If not set, B2 will
+    determine the content type from the file name extension.
+
+  -concurrency=<n>
+    Number of files to upload in parallel with -R. Defaults to 4.
+
+  -expires
+    The Expires header to serve the file with. Must be an HTTP date,
+    e.g. "Wed, 21 Oct 2015 07:28:00 GMT".
+
+  -info <key=value>
+    Custom information to store along with the file. Keys may contain
+    letters, numbers, "-" and "_". Can be specified multiple times, but
+    B2 stores no more than 10 items per file, including the last
+    modification time recorded by the client and the headers above.
+
+  -part-size=<size>
+    Size of the parts files larger than a single part are uploaded
+    in, e.g. "100M". Must be between 5000000 and 5000000000 bytes.
+    Defaults to the part size recommended by B2.
+
+  -R
+    Upload directories and their contents recursively.
+
+Filter Options:
+
+  These options apply when uploading directories with -R.
+
+  ` + filterOptions() + `
+`
 	return strings.TrimSpace(helpText)
 }
 
@@ -36,10 +122,23 @@ func (c *PutCommand) Synopsis() string {
 func (c *PutCommand) Name() string { return "put" }
 
 func (c *PutCommand) Run(args []string) int {
+	c.fileInfo = make(map[string]string)
+
 	flags := c.flagSet()
 	flags.Usage = func() { c.ui.Output(c.Help()) }
-
-	if err := flags.Parse(args); err != nil {
+	flags.StringVar(&c.contentType, "content-type", "", "")
+	flags.StringVar(&c.responseHeaders.CacheControl, "cache-control", "", "")
+	flags.StringVar(&c.responseHeaders.ContentDisposition, "content-disposition", "", "")
+	flags.StringVar(&c.responseHeaders.ContentEncoding, "content-encoding", "", "")
+	flags.StringVar(&c.responseHeaders.ContentLanguage, "content-language", "", "")
+	flags.StringVar(&c.responseHeaders.Expires, "expires", "", "")
+	flags.Var(keyValueFlag(c.fileInfo), "info", "")
+	flags.BoolVar(&c.recursive, "R", false, "")
+	flags.IntVar(&c.concurrency, "concurrency", 4, "")
+	flags.Var(&c.partSize, "part-size", "")
+	c.filter.addFlags(flags)
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
 		return 1
 	}
 
@@ -51,6 +150,36 @@ func (c *PutCommand) Run(args []string) int {
 		return 1
 	}
 
+	destination, err := c.bucketPath(args[1])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	args[1] = destination
+
+	if err := validatePartSize(c.partSize); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	// Progress would get mixed up with the results
+	if !c.textOutput() {
+		c.quiet = true
+	}
+
+	// Validate file metadata before doing any work
+	if c.contentType != "" {
+		if err := b2.ValidateContentType(c.contentType); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	}
+	_, filename := destinationBucketAndFilename(args[0], args[1])
+	if err := c.validateUploadFileInfo(filename, false); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
 	// Check that source file exists
 	info, err := os.Stat(args[0])
 	if err != nil {
@@ -62,6 +191,23 @@ func (c *PutCommand) Run(args []string) int {
 		return 1
 	}
 
+	if info.IsDir() {
+		if !c.recursive {
+			c.ui.Error(fmt.Sprintf("Error: %s is a directory, use -R to upload it", args[0]))
+			return 1
+		}
+		if c.concurrency < 1 {
+			c.ui.Error("-concurrency must be at least 1")
+			return 1
+		}
+		// Any of the files may turn out to be large
+		if err := c.validateUploadFileInfo(filename, true); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+		return c.putRecursive(args[0], args[1])
+	}
+
 	// Create a client
 	client, err := c.Client()
 	if err != nil {
@@ -69,13 +215,92 @@ func (c *PutCommand) Run(args []string) int {
 		return 1
 	}
 
-	if info.Size() > client.RecommendedPartSize {
+	if info.Size() > c.uploadPartSize(client) {
+		if err := c.validateUploadFileInfo(filename, true); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
 		return c.putLargeFile(info, args[0], args[1])
 	}
 
 	return c.putSmallFile(info, args[0], args[1])
 }
 
+// uploadFile uploads src to the bucket, splitting it into multiple parts
+// if the file is larger than a single part.
+func (c *PutCommand) uploadFile(ctx context.Context, bucketID string, info fs.FileInfo, src, filename string) (*b2.File, error) {
+	client, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() > c.uploadPartSize(client) {
+		return c.uploadLargeFile(ctx, bucketID, info, src, filename)
+	}
+
+	return c.uploadSmallFile(ctx, bucketID, info, src, filename)
+}
+
+// printUpload prints the result of uploading src to the bucket.
+func (c *PutCommand) printUpload(src, bucketName, filename string, file *b2.File) int {
+	destination := path.Join(bucketName, filename)
+
+	out := c.newPrinter(false)
+	out.print(fmt.Sprintf("Uploaded %q to %q", src, destination), transferResult{
+		Action:      "upload",
+		Source:      src,
+		Destination: destination,
+		File:        file,
+	})
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// trace prints details about the progress of an upload, unless progress
+// is hidden.
+func (c *PutCommand) trace(msg string) {
+	if !c.quiet {
+		c.ui.Info(msg)
+	}
+}
+
+// uploadPartSize returns the size of the parts large files are uploaded in.
+func (c *PutCommand) uploadPartSize(client *b2.Client) int64 {
+	if c.partSize.set {
+		return c.partSize.bytes
+	}
+	return client.RecommendedPartSize
+}
+
+// uploadFileInfo returns the custom file info merged with the file info
+// the client records for every upload.
+func (c *PutCommand) uploadFileInfo(extra map[string]string) map[string]string {
+	info := make(map[string]string, len(c.fileInfo)+len(extra))
+	for k, v := range c.fileInfo {
+		info[k] = v
+	}
+	for k, v := range extra {
+		info[k] = v
+	}
+	return info
+}
+
+// validateUploadFileInfo checks the file info the file would be uploaded
+// with, including the items added at upload time, so that uploads don't
+// fail half way through. Large files also carry their SHA1 in it.
+func (c *PutCommand) validateUploadFileInfo(filename string, large bool) error {
+	extra := c.responseHeaders.FileInfo()
+	extra["src_last_modified_millis"] = fmt.Sprintf("%d", time.Now().Unix()*1000)
+	if large {
+		extra["large_file_sha1"] = strings.Repeat("0", 40)
+	}
+	return b2.ValidateFileInfo(filename, c.uploadFileInfo(extra))
+}
+
 // progressReader is a helper for tracking the amount of bytes uploaded.
 type progressReader struct {
 	file     *os.File
@@ -144,6 +369,17 @@ func checkMaxFileSize(filename string) error {
 	return nil
 }
 
+// validatePartSize checks that the part size is within the limits of B2.
+func validatePartSize(size sizeValue) error {
+	if !size.set {
+		return nil
+	}
+	if size.bytes < minPartSize || size.bytes > maxPartSize {
+		return fmt.Errorf("-part-size must be between %d and %d bytes", minPartSize, maxPartSize)
+	}
+	return nil
+}
+
 // destinationBucketAndFilename returns upload bucket and filePrefix
 //
 // b2 does not have a concept of folders, so if destination contains
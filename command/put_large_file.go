@@ -24,13 +24,23 @@ func (c *PutCommand) putLargeFile(info fs.FileInfo, src, dst string) int {
 
 	ctx := context.TODO()
 
-	// TODO: caching bucket name:id mappings could save this request
-	bucket, err := findBucketByName(ctx, client, bucketName)
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
 	if err != nil {
 		c.ui.Error(fmt.Sprintf("Error: %v", err))
 		return 1
 	}
 
+	file, err := c.uploadLargeFile(ctx, bucket.ID, info, src, filePrefix)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return c.printUpload(src, bucketName, filePrefix, file)
+}
+
+// uploadLargeFile uploads src to the bucket in multiple parts.
+func (c *PutCommand) uploadLargeFile(ctx context.Context, bucketID string, info fs.FileInfo, src, filename string) (*b2.File, error) {
 	// start large file upload
 	// split file into n chunks using recommended part size
 	// start uploading 4 parts
@@ -40,36 +50,27 @@ func (c *PutCommand) putLargeFile(info fs.FileInfo, src, dst string) int {
 
 	sha1, err := calculateFileSHA1(src)
 	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error: %v", err))
-		return 1
+		return nil, err
 	}
 
-	c.ui.Info(fmt.Sprintf("File sha1: %s", sha1))
+	c.trace(fmt.Sprintf("File sha1: %s", sha1))
 
-	startLargeFileResp, err := c.startLargeFileUpload(ctx, sha1, info.ModTime(), bucket.ID, filePrefix)
+	startLargeFileResp, err := c.startLargeFileUpload(ctx, sha1, info.ModTime(), bucketID, filename)
 	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error: %v", err))
-		return 1
+		return nil, err
 	}
 
-	c.ui.Info(fmt.Sprintf("file id: %v", startLargeFileResp.FileID))
+	c.trace(fmt.Sprintf("file id: %v", startLargeFileResp.FileID))
 
 	partSHA1, err := c.uploadFileInChunks(ctx, info, src, startLargeFileResp.FileID)
 	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error: %v", err))
-		if _, err := c.cancelLargeFileUpload(ctx, startLargeFileResp.FileID); err != nil {
-			c.ui.Error(fmt.Sprintf("Error: %v", err))
+		if _, cancelErr := c.cancelLargeFileUpload(ctx, startLargeFileResp.FileID); cancelErr != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", cancelErr))
 		}
-		return 1
-	}
-
-	_, err = c.finishLargeFileUpload(ctx, startLargeFileResp.FileID, partSHA1)
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error: %v", err))
-		return 1
+		return nil, err
 	}
 
-	return 0
+	return c.finishLargeFileUpload(ctx, startLargeFileResp.FileID, partSHA1)
 }
 
 func (c *PutCommand) startLargeFileUpload(ctx context.Context, sha1 string, lastModified time.Time, bucketID, filename string) (*b2.File, error) {
@@ -81,11 +82,12 @@ func (c *PutCommand) startLargeFileUpload(ctx context.Context, sha1 string, last
 	req := &b2.StartLargeFileRequest{
 		BucketID:    bucketID,
 		Filename:    filename,
-		ContentType: "b2/x-auto",
-		FileInfo: map[string]string{
+		ContentType: c.contentType,
+		FileInfo: c.uploadFileInfo(map[string]string{
 			"src_last_modified_millis": fmt.Sprintf("%d", lastModified.Unix()*1000),
 			"large_file_sha1":          sha1,
-		},
+		}),
+		ResponseHeaders: c.responseHeaders,
 	}
 
 	return client.File.StartLargeFile(ctx, req)
@@ -119,32 +121,38 @@ func (c *PutCommand) cancelLargeFileUpload(ctx context.Context, fileID string) (
 }
 
 func (c *PutCommand) uploadFileInChunks(ctx context.Context, info fs.FileInfo, filename, fileID string) ([]string, error) {
-	// Create a client
-	// client, err := c.Client()
-	// if err != nil {
-	// 	return nil, err
-	// }
+	client, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
 
-	// partSize := client.RecommendedPartSize
-	// FIXME: remove once testing is done
-	partSize := int64(5000000)
+	partSize := c.uploadPartSize(client)
 
-	numParts := info.Size() / partSize
+	numParts := (info.Size() + partSize - 1) / partSize
 	maxParts := int64(10000)
 
 	// Backblaze enforces a maximum limit of 10_000 parts
 	if numParts > maxParts {
-		partSize = info.Size() / maxParts
-		numParts = maxParts
+		partSize = (info.Size() + maxParts - 1) / maxParts
+		numParts = (info.Size() + partSize - 1) / partSize
+	}
+
+	// Open file for reading.
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	c.ui.Info(fmt.Sprintf("selected %v partsize, num chunks: %d", partSize, numParts))
+	// Stop uploading the remaining parts once one of them fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// Start workers
 	numWorkers := 4
 	chunks := make(chan chunk, numWorkers)
-	results := make(chan *b2.FilePart)
-	errors := make(chan error, numWorkers)
+	results := make(chan *b2.FilePart, numParts)
+	errors := make(chan error, numParts)
 	for i := 0; i < numWorkers; i++ {
 		go func(chunks <-chan chunk, results chan<- *b2.FilePart) {
 			for ch := range chunks {
@@ -158,37 +166,31 @@ func (c *PutCommand) uploadFileInChunks(ctx context.Context, info fs.FileInfo, f
 		}(chunks, results)
 	}
 
-	// Open file for reading.
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
 	offset := int64(0)
 
 	// Backblaze wants part numbers to be contiguous numbers, starting with 1
 	for i := int64(1); i <= numParts; i++ {
 		i := i
 
-		c.ui.Info(fmt.Sprintf("calculating hash for chunk %d...", i))
+		c.trace(fmt.Sprintf("calculating hash for chunk %d...", i))
 
 		hash := sha1.New()
 		n, err := io.CopyN(hash, f, partSize)
-		if err != nil {
+		if err != nil && err != io.EOF {
+			close(chunks)
 			return nil, fmt.Errorf("compute part sha1 hash: %v", err)
 		}
 		partSHA1 := fmt.Sprintf("%x", hash.Sum(nil))
 
-		c.ui.Info(fmt.Sprintf("chunk %d hash: %s", i, partSHA1))
+		c.trace(fmt.Sprintf("chunk %d hash: %s", i, partSHA1))
 
 		chunks <- chunk{filename, fileID, offset, i, n, partSHA1}
 
-		c.ui.Info(fmt.Sprintf("enqueued chunk %d", i))
+		c.trace(fmt.Sprintf("enqueued chunk %d", i))
 
 		offset += n
 	}
-	// note: not closing the chunks channel to allow for re-uploading
+	close(chunks)
 
 	partSHA1ByPartNumber := make(map[int]string)
 
@@ -215,7 +217,7 @@ outer:
 }
 
 func (c *PutCommand) uploadChunk(ctx context.Context, ch chunk) (*b2.FilePart, error) {
-	c.ui.Info(fmt.Sprintf("chunk: %d, offset: %d, len: %d, sha1: %s", ch.partNum, ch.fileOffset, ch.partSize, ch.partSha1))
+	c.trace(fmt.Sprintf("chunk: %d, offset: %d, len: %d, sha1: %s", ch.partNum, ch.fileOffset, ch.partSize, ch.partSha1))
 
 	client, err := c.Client()
 	if err != nil {
@@ -231,7 +233,7 @@ func (c *PutCommand) uploadChunk(ctx context.Context, ch chunk) (*b2.FilePart, e
 		return nil, err
 	}
 
-	c.ui.Info(fmt.Sprintf("chunk upload url: %s", uploadAuth.UploadURL))
+	c.trace(fmt.Sprintf("chunk upload url: %s", uploadAuth.UploadURL))
 
 	// Open file for reading.
 	f, err := os.Open(ch.filename)
@@ -240,7 +242,7 @@ func (c *PutCommand) uploadChunk(ctx context.Context, ch chunk) (*b2.FilePart, e
 	}
 	defer f.Close()
 
-	c.ui.Info(fmt.Sprintf("seeking to %d to read %d bytes", ch.fileOffset, ch.partSize))
+	c.trace(fmt.Sprintf("seeking to %d to read %d bytes", ch.fileOffset, ch.partSize))
 
 	f.Seek(ch.fileOffset, 0)
 	r := io.LimitReader(f, ch.partSize)
@@ -259,7 +261,7 @@ func (c *PutCommand) uploadChunk(ctx context.Context, ch chunk) (*b2.FilePart, e
 		return nil, err
 	}
 
-	c.ui.Info(fmt.Sprintf("chunk %d uploaded", ch.partNum))
+	c.trace(fmt.Sprintf("chunk %d uploaded", ch.partNum))
 
 	return part, nil
 }
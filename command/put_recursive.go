@@ -0,0 +1,141 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/mitchellh/cli"
+)
+
+// uploadJob is a single file found while walking the source directory.
+type uploadJob struct {
+	path     string
+	info     fs.FileInfo
+	filename string
+}
+
+// putRecursive uploads all files in the directory tree, keeping their paths
+// relative to src under the destination.
+//
+// The tree is walked while uploading. Small files are uploaded by a pool of
+// workers, whereas large files are queued until the walk is done and then
+// uploaded one at a time, because their parts are already uploaded in
+// parallel. Waiting for a large file would leave the pool idle otherwise.
+func (c *PutCommand) putRecursive(src, dst string) int {
+	// Use the absolute path, so that "." is uploaded under the name of
+	// the current directory.
+	dir, err := filepath.Abs(src)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	bucketName, filePrefix := destinationBucketAndFilename(filepath.ToSlash(dir), dst)
+
+	// Create a client
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ctx := context.TODO()
+
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ui := &cli.ConcurrentUi{Ui: c.ui}
+
+	// Workers share the upload settings, but must not draw progress bars
+	// over each other.
+	put := *c
+	put.baseCommand = &baseCommand{ui: ui, client: client}
+	put.quiet = true
+
+	out := c.newPrinter(true)
+
+	smallFiles := make(chan uploadJob)
+	var largeFiles []uploadJob
+
+	var mu sync.Mutex
+	failed := 0
+
+	upload := func(jobs <-chan uploadJob, wg *sync.WaitGroup) {
+		defer wg.Done()
+		for job := range jobs {
+			file, err := put.uploadFile(ctx, bucket.ID, job.info, job.path, job.filename)
+			if err != nil {
+				ui.Error(fmt.Sprintf("Error: %s: %v", job.path, err))
+				mu.Lock()
+				failed++
+				mu.Unlock()
+				continue
+			}
+			destination := path.Join(bucketName, job.filename)
+			out.print(fmt.Sprintf("Uploaded %q to %q", job.path, destination), transferResult{
+				Action:      "upload",
+				Source:      job.path,
+				Destination: destination,
+				File:        file,
+			})
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(c.concurrency)
+	for i := 0; i < c.concurrency; i++ {
+		go upload(smallFiles, &wg)
+	}
+
+	err = c.filter.walkDir(dir, func(p, name string, info fs.FileInfo) error {
+		job := uploadJob{
+			path:     filepath.Join(src, filepath.FromSlash(name)),
+			info:     info,
+			filename: path.Join(filePrefix, name),
+		}
+
+		if info.Size() > c.uploadPartSize(client) {
+			largeFiles = append(largeFiles, job)
+		} else {
+			smallFiles <- job
+		}
+		return nil
+	})
+
+	close(smallFiles)
+
+	queue := make(chan uploadJob, len(largeFiles))
+	for _, job := range largeFiles {
+		queue <- job
+	}
+	close(queue)
+
+	wg.Add(1)
+	go upload(queue, &wg)
+	wg.Wait()
+
+	// Report the files that were uploaded, even if others failed
+	if err := out.flush(); err != nil {
+		ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	if failed > 0 {
+		ui.Error(fmt.Sprintf("Error: %d files failed to upload", failed))
+		return 1
+	}
+
+	return 0
+}
@@ -23,28 +23,42 @@ func (c *PutCommand) putSmallFile(info fs.FileInfo, src, dst string) int {
 
 	ctx := context.TODO()
 
-	// TODO: caching bucket name:id mappings could save this request
-	bucket, err := findBucketByName(ctx, client, bucketName)
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
 	if err != nil {
 		c.ui.Error(fmt.Sprintf("Error: %v", err))
 		return 1
 	}
 
+	file, err := c.uploadSmallFile(ctx, bucket.ID, info, src, filePrefix)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	return c.printUpload(src, bucketName, filePrefix, file)
+}
+
+// uploadSmallFile uploads src to the bucket in a single request.
+func (c *PutCommand) uploadSmallFile(ctx context.Context, bucketID string, info fs.FileInfo, src, filename string) (*b2.File, error) {
+	// Create a client
+	client, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+
 	// Request upload url
 	uploadAuthReq := &b2.UploadAuthorizationRequest{
-		BucketID: bucket.ID,
+		BucketID: bucketID,
 	}
 	uploadAuth, _, err := client.File.UploadAuthorization(ctx, uploadAuthReq)
 	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error: %v", err))
-		return 1
+		return nil, err
 	}
 
 	// Open file for reading.
 	f, err := os.Open(src)
 	if err != nil {
-		c.ui.Error(err.Error())
-		return 1
+		return nil, err
 	}
 	defer f.Close()
 
@@ -52,37 +66,44 @@ func (c *PutCommand) putSmallFile(info fs.FileInfo, src, dst string) int {
 	hash := sha1.New()
 	_, err = io.Copy(hash, f)
 	if err != nil {
-		c.ui.Error(err.Error())
-		return 1
+		return nil, err
 	}
 	sha1 := fmt.Sprintf("%x", hash.Sum(nil))
 
 	// Rewind the file
 	f.Seek(0, 0)
 
+	var body io.Reader = f
+
 	// Create a progress bar.
-	pr, err := newProgressReader(f)
-	if err != nil {
-		c.ui.Error(err.Error())
-		return 1
+	if !c.quiet {
+		pr, err := newProgressReader(f)
+		if err != nil {
+			return nil, err
+		}
+		pr.Start()
+		defer pr.Stop()
+
+		body = pr
 	}
-	pr.Start()
-	defer pr.Stop()
 
 	uploadReq := &b2.UploadRequest{
 		Authorization: uploadAuth,
-		Body:          pr,
-		Key:           filePrefix,
+		Body:          body,
+		Key:           filename,
 		ChecksumSHA1:  sha1,
 		ContentLength: info.Size(),
 		LastModified:  info.ModTime(),
+		ContentType:   c.contentType,
+		FileInfo:      c.uploadFileInfo(nil),
+
+		ResponseHeaders: c.responseHeaders,
 	}
 
-	_, _, err = client.File.Upload(ctx, uploadReq)
+	file, _, err := client.File.Upload(ctx, uploadReq)
 	if err != nil {
-		c.ui.Error(err.Error())
-		return 1
+		return nil, err
 	}
 
-	return 0
+	return file, nil
 }
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/mitchellh/cli"
@@ -106,3 +110,239 @@ func TestPutCommand_CanUploadFile(t *testing.T) {
 	filename := fmt.Sprintf("%s/%s", dst, path.Base(tmpFile.Name()))
 	assert.Contains(t, out, fmt.Sprintf("Uploaded %q to %q", src, filename))
 }
+
+func TestPutCommand_SendsContentTypeAndFileInfo(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"buckets": [
+			{
+				"accountId": "30f20426f0b1",
+				"bucketId": "87ba238875c6214145260818",
+				"bucketName": "Secret-Documents",
+				"bucketType": "allPrivate"
+			} ]
+		}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{
+			"bucketId": "87ba238875c6214145260818",
+			"uploadUrl": "%s/upload",
+			"authorizationToken": "some-secret-token"
+		}`, server.URL)
+	})
+
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/markdown", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Jane+Doe", r.Header.Get("X-Bz-Info-author"))
+		assert.Equal(t, "draft", r.Header.Get("X-Bz-Info-status"))
+		assert.NotEmpty(t, r.Header.Get("X-Bz-Info-src_last_modified_millis"))
+
+		fmt.Fprint(w, `{"fileId": "4_h4a48fe8875c6214145260818", "fileName": "notes.md"}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &PutCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	tmpFile, _ := ioutil.TempFile(os.TempDir(), "b2-cli-test-")
+	defer os.Remove(tmpFile.Name())
+
+	tmpFile.Write([]byte("# Notes"))
+	tmpFile.Close()
+
+	args := []string{
+		"-content-type", "text/markdown",
+		"-info", "author=Jane Doe",
+		"-info", "status=draft",
+		tmpFile.Name(), "Secret-Documents/notes.md",
+	}
+
+	code := cmd.Run(args)
+	assert.Equal(t, 0, code)
+}
+
+func TestPutCommand_SendsResponseHeaders(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "87ba238875c6214145260818", "bucketName": "assets"}]}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"uploadUrl": "%s/upload", "authorizationToken": "some-secret-token"}`, server.URL)
+	})
+
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "public%2C+max-age%3D86400", r.Header.Get("X-Bz-Info-b2-cache-control"))
+		assert.Equal(t, "gzip", r.Header.Get("X-Bz-Info-b2-content-encoding"))
+		assert.Equal(t, "en-US", r.Header.Get("X-Bz-Info-b2-content-language"))
+		assert.Equal(t, "inline", r.Header.Get("X-Bz-Info-b2-content-disposition"))
+		assert.Equal(t, "Wed%2C+21+Oct+2015+07%3A28%3A00+GMT", r.Header.Get("X-Bz-Info-b2-expires"))
+
+		fmt.Fprint(w, `{"fileId": "4_h4a48fe8875c6214145260818", "fileName": "app.js"}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &PutCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	tmpFile, _ := ioutil.TempFile(os.TempDir(), "b2-cli-test-")
+	defer os.Remove(tmpFile.Name())
+
+	tmpFile.Write([]byte("console.log(1)"))
+	tmpFile.Close()
+
+	args := []string{
+		"-cache-control", "public, max-age=86400",
+		"-content-encoding", "gzip",
+		"-content-language", "en-US",
+		"-content-disposition", "inline",
+		"-expires", "Wed, 21 Oct 2015 07:28:00 GMT",
+		tmpFile.Name(), "assets/app.js",
+	}
+
+	code := cmd.Run(args)
+	assert.Equal(t, 0, code)
+}
+
+func TestPutCommand_ValidatesFileInfo(t *testing.T) {
+	tooMany := []string{}
+	for i := 0; i < 11; i++ {
+		tooMany = append(tooMany, "-info", fmt.Sprintf("key%d=value", i))
+	}
+
+	// Uploads add src_last_modified_millis, which counts towards the limit
+	nine := []string{}
+	for i := 0; i < 9; i++ {
+		nine = append(nine, "-info", fmt.Sprintf("key%d=value", i))
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"invalid pair", []string{"-info", "novalue"}, ""},
+		{"invalid key", []string{"-info", "bad key=value"}, "may only contain letters"},
+		{"reserved prefix", []string{"-info", "b2-secret=value"}, "reserved"},
+		{"too many", tooMany, "too many file info items"},
+		{"too many with upload info", append(nine, "-cache-control", "no-cache"), "too many file info items"},
+		{"content type", []string{"-content-type", "text/"}, "invalid content type"},
+		{"expires", []string{"-expires", "2021-01-01"}, "invalid b2-expires"},
+		{"content disposition", []string{"-content-disposition", "attachment; filename"}, "invalid b2-content-disposition"},
+		{"content language", []string{"-content-language", "en US"}, "invalid b2-content-language"},
+		{"part size too small", []string{"-part-size", "1M"}, "-part-size must be between"},
+		{"part size too large", []string{"-part-size", "5G"}, "-part-size must be between"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &PutCommand{
+				baseCommand: &baseCommand{ui: ui},
+			}
+
+			args := append(tt.args, "file.txt", "bucket/file.txt")
+			code := cmd.Run(args)
+			assert.Equal(t, 1, code)
+			if tt.err != "" {
+				assert.Contains(t, ui.ErrorWriter.String(), tt.err)
+			}
+		})
+	}
+}
+
+func TestPutCommand_ValidatesLargeFileInfo(t *testing.T) {
+	// Large files add large_file_sha1 as well, and any file in a directory
+	// may be large
+	args := []string{"-R", "-cache-control", "no-cache"}
+	for i := 0; i < 8; i++ {
+		args = append(args, "-info", fmt.Sprintf("key%d=value", i))
+	}
+
+	ui := cli.NewMockUi()
+	cmd := &PutCommand{
+		baseCommand: &baseCommand{ui: ui},
+	}
+
+	code := cmd.Run(append(args, t.TempDir(), "bucket/dir"))
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "too many file info items")
+}
+
+func TestPutCommand_RejectsDirectoryWithoutRecursive(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	defer os.RemoveAll(dir)
+
+	ui := cli.NewMockUi()
+	cmd := &PutCommand{
+		baseCommand: &baseCommand{ui: ui},
+	}
+
+	code := cmd.Run([]string{dir, "bucket/"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "is a directory, use -R to upload it")
+}
+
+func TestPutCommand_UploadsDirectoryRecursively(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "87ba238875c6214145260818", "bucketName": "photos"}]}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"uploadUrl": "%s/upload", "authorizationToken": "some-secret-token"}`, server.URL)
+	})
+
+	var mu sync.Mutex
+	var uploaded []string
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		name, _ := url.QueryUnescape(r.Header.Get("X-Bz-File-Name"))
+		mu.Lock()
+		uploaded = append(uploaded, name)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"fileName": %q}`, name)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	dir, _ := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.jpg", "2020/b.jpg", "2020/summer/c.jpg"} {
+		filename := filepath.Join(dir, "album", filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		ioutil.WriteFile(filename, []byte(name), 0644)
+	}
+
+	ui := cli.NewMockUi()
+	cmd := &PutCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"-R", filepath.Join(dir, "album"), "photos/backup/"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	sort.Strings(uploaded)
+	assert.Equal(t, []string{
+		"backup/album/2020/b.jpg",
+		"backup/album/2020/summer/c.jpg",
+		"backup/album/a.jpg",
+	}, uploaded)
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Uploaded %q to %q", filepath.Join(dir, "album", "2020", "b.jpg"), "photos/backup/album/2020/b.jpg"))
+}
@@ -0,0 +1,33 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// ServeCommand only prints the help, which lists the servers, e.g. "serve
+// http".
+type ServeCommand struct {
+	*baseCommand
+}
+
+func (c *ServeCommand) Help() string {
+	helpText := `
+Usage: b2 serve <subcommand> [options] [args]
+
+  Serves the files of a bucket to clients that don't hold B2 credentials,
+  until interrupted. Run a subcommand with -help for its options.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ServeCommand) Synopsis() string {
+	return "Serve the files of a bucket"
+}
+
+func (c *ServeCommand) Name() string { return "serve" }
+
+func (c *ServeCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
@@ -0,0 +1,513 @@
+package command
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+)
+
+// gatewayRequestHeaders are the headers of requests that are passed on to
+// B2 when downloading a file.
+var gatewayRequestHeaders = []string{
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+	"Range",
+}
+
+// gatewayResponseHeaders are the headers of B2 responses that are passed on
+// to clients, along with all X-Bz-* headers.
+var gatewayResponseHeaders = []string{
+	"Accept-Ranges",
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Length",
+	"Content-Range",
+	"Content-Type",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+}
+
+type ServeHTTPCommand struct {
+	*baseCommand
+
+	// Address to listen on.
+	listen string
+
+	// Credentials clients have to present, if any.
+	user     string
+	password string
+	token    string
+}
+
+func (c *ServeHTTPCommand) Help() string {
+	helpText := `
+Usage: b2 serve http [options] <bucket>[/<prefix>]
+
+  Starts a read-only HTTP gateway to the files of a bucket, or of a folder
+  in it, so that services can read from a private bucket without holding
+  B2 credentials. For example, when serving "my-bucket/site", a request for
+  "/css/main.css" returns "my-bucket/site/css/main.css".
+
+  Downloads are streamed, and range and conditional requests are passed on
+  to B2. Paths ending with a slash list the files and folders in them.
+
+General Options:
+
+  ` + c.generalOptions() + `
+
+Serve Options:
+
+  -listen=<address>
+    Address to listen on. Defaults to "127.0.0.1:8080".
+
+  -password=<password>
+    Password clients have to present with -user using basic
+    authentication. Overrides the B2_SERVE_PASSWORD environment
+    variable if set.
+
+  -token=<token>
+    Token clients have to present as "Authorization: Bearer <token>".
+    Overrides the B2_SERVE_TOKEN environment variable if set.
+
+  -user=<name>
+    Name clients have to present using basic authentication.
+    Requires -password.
+
+  Anyone who can reach the address can read the files unless -user or
+  -token is given. When both are given, either is accepted.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ServeHTTPCommand) Synopsis() string {
+	return "Serve the files of a bucket over HTTP"
+}
+
+func (c *ServeHTTPCommand) Name() string { return "serve http" }
+
+func (c *ServeHTTPCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.StringVar(&c.listen, "listen", "127.0.0.1:8080", "")
+	flags.StringVar(&c.user, "user", "", "")
+	flags.StringVar(&c.password, "password", os.Getenv("B2_SERVE_PASSWORD"), "")
+	flags.StringVar(&c.token, "token", os.Getenv("B2_SERVE_TOKEN"), "")
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got exactly one argument
+	args = flags.Args()
+	if len(args) != 1 {
+		c.ui.Error("This command takes one argument: <bucket>[/<prefix>]")
+		return 1
+	}
+
+	if c.user != "" && c.password == "" {
+		c.ui.Error("Error: -user requires -password")
+		return 1
+	}
+	if c.user == "" && c.password != "" {
+		c.ui.Error("Error: -password requires -user")
+		return 1
+	}
+
+	p, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	bucketName, prefix := splitBucketAndPrefix(p)
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	bucket, err := client.Bucket.Lookup(context.TODO(), bucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ln, err := net.Listen("tcp", c.listen)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	g := &gateway{
+		ui:       &cli.ConcurrentUi{Ui: c.ui},
+		client:   client,
+		bucket:   bucket,
+		prefix:   syncPrefix(prefix),
+		user:     c.user,
+		password: c.password,
+		token:    c.token,
+	}
+
+	c.ui.Output(fmt.Sprintf("Serving %s/%s on http://%s", bucket.Name, g.prefix, ln.Addr()))
+
+	server := &http.Server{
+		Handler:           g,
+		ReadHeaderTimeout: time.Minute,
+	}
+	if err := server.Serve(ln); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// gateway serves the files of a bucket read-only over HTTP.
+type gateway struct {
+	ui     cli.Ui
+	client *b2.Client
+	bucket *b2.Bucket
+
+	// Folder the paths of requests are relative to, with a trailing slash,
+	// or empty for the whole bucket.
+	prefix string
+
+	// Credentials clients have to present. Anyone may read the files if
+	// neither user nor token are set.
+	user     string
+	password string
+	token    string
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !g.authorized(r) {
+		if g.user != "" {
+			w.Header().Add("WWW-Authenticate", `Basic realm="b2"`)
+		}
+		if g.token != "" {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="b2"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	// Cleaning the path keeps requests inside of the prefix
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if strings.HasSuffix(r.URL.Path, "/") && name != "" {
+		name += "/"
+	}
+
+	if name == "" || strings.HasSuffix(name, "/") {
+		g.serveFolder(w, r, name)
+		return
+	}
+	g.serveFile(w, r, name)
+}
+
+// authorized reports whether the request carries the credentials the
+// gateway requires.
+func (g *gateway) authorized(r *http.Request) bool {
+	if g.user == "" && g.token == "" {
+		return true
+	}
+
+	if g.user != "" {
+		user, password, ok := r.BasicAuth()
+		if ok && secretEqual(user, g.user) && secretEqual(password, g.password) {
+			return true
+		}
+	}
+
+	if g.token != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") && secretEqual(strings.TrimPrefix(auth, "Bearer "), g.token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// secretEqual compares secrets in constant time.
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// serveFile streams the file from B2.
+func (g *gateway) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	header := make(http.Header)
+	for _, k := range gatewayRequestHeaders {
+		if v, ok := r.Header[k]; ok {
+			header[k] = v
+		}
+	}
+
+	resp, err := g.open(r.Context(), r.Method, name, header)
+
+	// B2 may ignore If-Range and send the range of a changed file, so the
+	// whole file is downloaded instead if the validator doesn't match
+	if err == nil && resp.StatusCode == http.StatusPartialContent && header.Get("If-Range") != "" {
+		if !ifRangeMatches(header.Get("If-Range"), fileValidators(resp.Header)) {
+			resp.Body.Close()
+			header.Del("Range")
+			header.Del("If-Range")
+			resp, err = g.open(r.Context(), r.Method, name, header)
+		}
+	}
+
+	switch {
+	case errors.Is(err, b2.ErrNotFound):
+		g.serveNotFound(w, r, name)
+		return
+	case errors.Is(err, b2.ErrRangeNotSatisfiable):
+		http.Error(w, http.StatusText(http.StatusRequestedRangeNotSatisfiable), http.StatusRequestedRangeNotSatisfiable)
+		return
+	case err != nil:
+		g.serveError(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	h := w.Header()
+	for k, v := range resp.Header {
+		if strings.HasPrefix(k, "X-Bz-") {
+			h[k] = v
+		}
+	}
+	for _, k := range gatewayResponseHeaders {
+		if v, ok := resp.Header[k]; ok {
+			h[k] = v
+		}
+	}
+	for k, v := range fileValidators(resp.Header) {
+		if h.Get(k) == "" {
+			h.Set(k, v)
+		}
+	}
+
+	// B2 may ignore the conditions too, in which case the gateway checks
+	// them itself
+	status := resp.StatusCode
+	if status >= 200 && status <= 299 {
+		if s := checkPreconditions(r, h); s != 0 {
+			status = s
+		}
+	}
+
+	if status == http.StatusNotModified || status == http.StatusPreconditionFailed {
+		for _, k := range []string{"Content-Length", "Content-Range", "Content-Type"} {
+			h.Del(k)
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// The client has most likely gone away if copying fails
+	io.Copy(w, resp.Body)
+}
+
+// open starts downloading the file, or only requests its headers for HEAD
+// requests.
+func (g *gateway) open(ctx context.Context, method, name string, header http.Header) (*http.Response, error) {
+	uri := downloadURL(g.client, g.bucket.Name, g.prefix+name)
+	if method == http.MethodHead {
+		return g.client.File.Head(ctx, uri, header)
+	}
+	return g.client.File.Open(ctx, uri, header)
+}
+
+// serveNotFound redirects to the folder if there is one by the name, like
+// file servers do for directories, or answers with 404 otherwise.
+func (g *gateway) serveNotFound(w http.ResponseWriter, r *http.Request, name string) {
+	files, _, err := g.client.File.List(r.Context(), &b2.FileListRequest{
+		BucketID:     g.bucket.ID,
+		Prefix:       g.prefix + name + "/",
+		MaxFileCount: 1,
+	})
+	if err != nil {
+		g.serveError(w, r, err)
+		return
+	}
+	if len(files) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	u := *r.URL
+	u.Path += "/"
+	http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+}
+
+// serveFolder lists the files and folders in the folder as HTML.
+func (g *gateway) serveFolder(w http.ResponseWriter, r *http.Request, name string) {
+	files, err := g.client.File.ListAll(r.Context(), &b2.FileListRequest{
+		BucketID:  g.bucket.ID,
+		Prefix:    g.prefix + name,
+		Delimiter: "/",
+	})
+	if err != nil {
+		g.serveError(w, r, err)
+		return
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.Action != "upload" && file.Action != "folder" {
+			continue
+		}
+		names = append(names, strings.TrimPrefix(file.FileName, g.prefix+name))
+	}
+
+	// Folders only exist as long as there are files in them
+	if len(names) == 0 && name != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	fmt.Fprintf(w, "<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n")
+	fmt.Fprintf(w, "<title>%s</title>\n<pre>\n", html.EscapeString("/"+name))
+	if name != "" {
+		fmt.Fprintf(w, "<a href=\"../\">../</a>\n")
+	}
+	for _, n := range names {
+		// Names with colons could be mistaken for URL schemes
+		u := url.URL{Path: "./" + n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(n))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// serveError reports errors talking to B2 as a bad gateway. The details
+// are only printed, as they may reveal more than the clients should see.
+func (g *gateway) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		// The client has gone away
+		return
+	}
+	g.ui.Error(fmt.Sprintf("Error: %s %s: %v", r.Method, r.URL.Path, err))
+	http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+}
+
+// fileValidators returns the ETag and Last-Modified headers describing the
+// version of the file in the response, as far as B2 reveals them.
+func fileValidators(h http.Header) map[string]string {
+	file := b2.FileFromHeader(h)
+	validators := make(map[string]string)
+
+	if sha1 := fileSHA1(*file); sha1 != "" {
+		validators["ETag"] = `"` + sha1 + `"`
+	}
+
+	millis, ok := fileLastModified(*file)
+	if !ok {
+		millis = file.UploadTimestamp
+	}
+	if millis > 0 {
+		validators["Last-Modified"] = time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(http.TimeFormat)
+	}
+
+	return validators
+}
+
+// checkPreconditions evaluates the conditional headers of the request
+// against the validators of the response in the order RFC 7232 gives, and
+// returns the status to answer with instead of the file, or zero to send
+// the file.
+func checkPreconditions(r *http.Request, h http.Header) int {
+	etag := h.Get("ETag")
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		modified = time.Time{}
+	}
+
+	if v := r.Header.Get("If-Match"); v != "" {
+		if !etagMatches(v, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !modified.IsZero() {
+		if modified.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		if etagMatches(v, etag, true) {
+			return http.StatusNotModified
+		}
+	} else if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.IsZero() {
+		if !modified.After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// etagMatches reports whether the ETag is in the comma-separated list of
+// ETags, or the list is "*". Weak comparison ignores the W/ prefix.
+func etagMatches(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return etag != ""
+	}
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(candidate, "W/") || strings.HasPrefix(etag, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches reports whether the If-Range header, either an ETag or a
+// date, matches the validators of the file.
+func ifRangeMatches(v string, validators map[string]string) bool {
+	if strings.HasPrefix(v, `"`) || strings.HasPrefix(v, "W/") {
+		return etagMatches(v, validators["ETag"], false)
+	}
+	return v == validators["Last-Modified"]
+}
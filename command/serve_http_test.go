@@ -0,0 +1,265 @@
+package command
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+)
+
+func newGatewayTestServer(t *testing.T, user, password, token string) *httptest.Server {
+	b2Server, emulator := testutil.NewEmulatorServer()
+	t.Cleanup(b2Server.Close)
+	emulator.Now = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+	_, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+	files := map[string]string{
+		"site/index.html":   "hello, world",
+		"site/css/main.css": "body {}",
+		"site/a b.txt":      "spaces",
+		"other.txt":         "outside of the prefix",
+	}
+	for name, data := range files {
+		_, err := emulator.PutFile("my-bucket", name, []byte(data))
+		require.NoError(t, err)
+	}
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient(emulator.KeyID, emulator.KeySecret, b2.SetBaseURL(b2Server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	bucket, err := client.Bucket.Lookup(context.Background(), "my-bucket")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(&gateway{
+		ui:       cli.NewMockUi(),
+		client:   client,
+		bucket:   bucket,
+		prefix:   "site/",
+		user:     user,
+		password: password,
+		token:    token,
+	})
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// requestGateway requests the path from the gateway without following redirects.
+func requestGateway(t *testing.T, server *httptest.Server, method, path string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, string(body)
+}
+
+func TestGateway_ServesFiles(t *testing.T) {
+	server := newGatewayTestServer(t, "", "", "")
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{"file", "/index.html", http.StatusOK, "hello, world"},
+		{"nested file", "/css/main.css", http.StatusOK, "body {}"},
+		{"escaped name", "/a%20b.txt", http.StatusOK, "spaces"},
+		{"missing file", "/missing.txt", http.StatusNotFound, "404 page not found\n"},
+		{"outside of prefix", "/../other.txt", http.StatusNotFound, "404 page not found\n"},
+		{"folder without slash", "/css", http.StatusMovedPermanently, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := requestGateway(t, server, http.MethodGet, tt.path, nil)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, body)
+			}
+		})
+	}
+
+	resp, _ := requestGateway(t, server, http.MethodGet, "/css?v=1", nil)
+	assert.Equal(t, "/css/?v=1", resp.Header.Get("Location"))
+
+	resp, body := requestGateway(t, server, http.MethodHead, "/index.html", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "12", resp.Header.Get("Content-Length"))
+	assert.Equal(t, "b7e23ec29af22b0b4e41da31e868d57226121c84", resp.Header.Get("X-Bz-Content-Sha1"))
+	assert.Empty(t, body)
+
+	resp, _ = requestGateway(t, server, http.MethodHead, "/missing.txt", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = requestGateway(t, server, http.MethodPost, "/index.html", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, "GET, HEAD", resp.Header.Get("Allow"))
+}
+
+func TestGateway_SendsHeadUpstream(t *testing.T) {
+	b2Server, mux := testutil.NewServer()
+	defer b2Server.Close()
+
+	var methods []string
+	mux.HandleFunc("/file/my-bucket/index.html", func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Header().Set("Content-Length", "12")
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, err := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(b2Server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(&gateway{
+		ui:     cli.NewMockUi(),
+		client: client,
+		bucket: &b2.Bucket{ID: "1", Name: "my-bucket"},
+	})
+	defer server.Close()
+
+	resp, _ := requestGateway(t, server, http.MethodHead, "/index.html", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{http.MethodHead}, methods)
+}
+
+func TestGateway_ListsFolders(t *testing.T) {
+	server := newGatewayTestServer(t, "", "", "")
+
+	resp, body := requestGateway(t, server, http.MethodGet, "/", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `<a href="./a%20b.txt">a b.txt</a>`)
+	assert.Contains(t, body, `<a href="./css/">css/</a>`)
+	assert.Contains(t, body, `<a href="./index.html">index.html</a>`)
+	assert.NotContains(t, body, "../")
+	assert.NotContains(t, body, "other.txt")
+
+	resp, body = requestGateway(t, server, http.MethodGet, "/css/", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `<a href="../">../</a>`)
+	assert.Contains(t, body, `<a href="./main.css">main.css</a>`)
+
+	resp, _ = requestGateway(t, server, http.MethodGet, "/missing/", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGateway_RangeAndConditionalRequests(t *testing.T) {
+	server := newGatewayTestServer(t, "", "", "")
+
+	resp, _ := requestGateway(t, server, http.MethodGet, "/index.html", nil)
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	assert.Equal(t, `"b7e23ec29af22b0b4e41da31e868d57226121c84"`, etag)
+	assert.Equal(t, "Thu, 04 Mar 2021 05:06:07 GMT", lastModified)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+		body   string
+	}{
+		{"range", http.Header{"Range": {"bytes=0-4"}}, http.StatusPartialContent, "hello"},
+		{"suffix range", http.Header{"Range": {"bytes=-5"}}, http.StatusPartialContent, "world"},
+		{"range outside of file", http.Header{"Range": {"bytes=100-"}}, http.StatusRequestedRangeNotSatisfiable, "Requested Range Not Satisfiable\n"},
+		{"if-none-match", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, ""},
+		{"if-none-match changed", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK, "hello, world"},
+		{"if-modified-since", http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified, ""},
+		{"if-modified-since earlier", http.Header{"If-Modified-Since": {"Wed, 03 Mar 2021 00:00:00 GMT"}}, http.StatusOK, "hello, world"},
+		{"if-match", http.Header{"If-Match": {etag}}, http.StatusOK, "hello, world"},
+		{"if-match changed", http.Header{"If-Match": {`"other"`}}, http.StatusPreconditionFailed, ""},
+		{"if-unmodified-since earlier", http.Header{"If-Unmodified-Since": {"Wed, 03 Mar 2021 00:00:00 GMT"}}, http.StatusPreconditionFailed, ""},
+		{"if-range", http.Header{"Range": {"bytes=0-4"}, "If-Range": {etag}}, http.StatusPartialContent, "hello"},
+		{"if-range changed", http.Header{"Range": {"bytes=0-4"}, "If-Range": {`"other"`}}, http.StatusOK, "hello, world"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := requestGateway(t, server, http.MethodGet, "/index.html", tt.header)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.body, body)
+		})
+	}
+}
+
+func TestGateway_Authentication(t *testing.T) {
+	tests := []struct {
+		name          string
+		user          string
+		password      string
+		token         string
+		authorization string
+		status        int
+	}{
+		{"no protection", "", "", "", "", http.StatusOK},
+		{"basic", "alice", "secret", "", "Basic YWxpY2U6c2VjcmV0", http.StatusOK},
+		{"basic wrong password", "alice", "secret", "", "Basic YWxpY2U6d3Jvbmc=", http.StatusUnauthorized},
+		{"basic missing", "alice", "secret", "", "", http.StatusUnauthorized},
+		{"bearer", "", "", "token", "Bearer token", http.StatusOK},
+		{"bearer wrong token", "", "", "token", "Bearer wrong", http.StatusUnauthorized},
+		{"bearer instead of basic", "alice", "secret", "", "Bearer secret", http.StatusUnauthorized},
+		{"either", "alice", "secret", "token", "Bearer token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newGatewayTestServer(t, tt.user, tt.password, tt.token)
+
+			header := http.Header{}
+			if tt.authorization != "" {
+				header.Set("Authorization", tt.authorization)
+			}
+
+			resp, _ := requestGateway(t, server, http.MethodGet, "/index.html", header)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	server := newGatewayTestServer(t, "alice", "secret", "token")
+	resp, _ := requestGateway(t, server, http.MethodGet, "/", nil)
+	assert.Equal(t, []string{`Basic realm="b2"`, `Bearer realm="b2"`}, resp.Header["Www-Authenticate"])
+}
+
+func TestServeHTTPCommand_InvalidArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"no arguments", []string{}, "This command takes one argument: <bucket>[/<prefix>]"},
+		{"too many arguments", []string{"my-bucket", "other-bucket"}, "This command takes one argument: <bucket>[/<prefix>]"},
+		{"user without password", []string{"-user", "alice", "my-bucket"}, "Error: -user requires -password"},
+		{"password without user", []string{"-password", "secret", "my-bucket"}, "Error: -password requires -user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &ServeHTTPCommand{baseCommand: &baseCommand{ui: ui}}
+
+			code := cmd.Run(tt.args)
+			assert.Equal(t, 1, code)
+			assert.Contains(t, ui.ErrorWriter.String(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,608 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+)
+
+// maxCompletions is the number of remote names listed for tab completion.
+const maxCompletions = 1000
+
+// shellCommands are the commands built into the shell, along with their
+// synopsis.
+var shellCommands = map[string]string{
+	"cd":   "Change the current folder",
+	"exit": "Leave the shell",
+	"help": "Show the commands or the help of a command",
+	"ls":   "Same as list",
+	"pwd":  "Print the current folder",
+	"quit": "Same as exit",
+}
+
+type ShellCommand struct {
+	*baseCommand
+
+	// Where commands are read from and the prompt is written to. Default
+	// to os.Stdin and os.Stdout.
+	stdin  io.Reader
+	stdout io.Writer
+
+	session *shellSession
+}
+
+func (c *ShellCommand) Help() string {
+	helpText := `
+Usage: b2 shell [options] [<path>]
+
+  Starts an interactive shell that keeps a current folder, so that paths
+  don't have to be typed out in full. The shell starts in the path, or
+  in the default bucket of the profile, and authorizes once for all of
+  the commands that are run from it.
+
+  Commands are typed without "b2", e.g. "list -l" or "get cat.jpg .".
+  Remote paths are relative to the current folder, and "." and ".."
+  refer to the current and the parent folder. Paths starting with "/"
+  start at the list of buckets, e.g. "/my-bucket/photos". Remote paths
+  of sync are written as "b2://<path>", e.g. "b2://photos".
+
+  Besides the b2 commands, the shell understands:
+
+    cd [<path>]       Change the current folder, or return to the
+                      folder the shell started in.
+    exit, quit        Leave the shell.
+    help [<command>]  Show the commands or the help of a command.
+    ls                Same as list.
+    pwd               Print the current folder.
+
+  Commands use the account and credentials of the shell, so -profile,
+  -key-id, -key-secret, -key-secret-file and -no-cache are only accepted
+  when starting the shell.
+
+  Press Tab to complete command names and remote names, and the up and
+  down arrows to go through the commands typed so far. Commands may also
+  be piped to the shell, one per line.
+
+General Options:
+
+  ` + c.generalOptions()
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ShellCommand) Synopsis() string {
+	return "Run commands in an interactive shell"
+}
+
+func (c *ShellCommand) Name() string { return "shell" }
+
+func (c *ShellCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got at most one argument
+	args = flags.Args()
+	if len(args) > 1 {
+		c.ui.Error("This command takes at most one argument: [<path>]")
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	c.session = &shellSession{client: client}
+	if c.bucket != "" {
+		c.session.home = c.bucket + "/"
+	}
+	if len(args) == 1 {
+		c.session.home = folderPath(c.session.resolve(args[0]))
+	}
+
+	ctx := context.TODO()
+
+	if err := c.session.cd(ctx, c.session.home); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	reader := c.lineReader()
+	for {
+		line, err := reader.readLine(c.prompt())
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if args[0] == "exit" || args[0] == "quit" {
+			return 0
+		}
+		c.run(ctx, args[0], args[1:])
+	}
+}
+
+// run runs a shell command or a b2 command. Errors are reported to the user
+// and don't end the shell.
+func (c *ShellCommand) run(ctx context.Context, name string, args []string) {
+	// Commands may change the files, so names have to be listed again
+	defer func() { c.session.completions = nil }()
+
+	switch name {
+	case "cd":
+		if len(args) > 1 {
+			c.ui.Error("cd takes at most one argument: [<path>]")
+			return
+		}
+		dir := c.session.home
+		if len(args) == 1 {
+			dir = folderPath(c.session.resolve(args[0]))
+		}
+		if err := c.session.cd(ctx, dir); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+		}
+		return
+	case "pwd":
+		c.ui.Output("/" + c.session.dir)
+		return
+	case "help":
+		c.help(args)
+		return
+	case "ls":
+		name = "list"
+	}
+
+	factory, ok := c.commands()[name]
+	if !ok {
+		c.ui.Error(fmt.Sprintf("Unknown command %q. Type \"help\" for a list of commands.", name))
+		return
+	}
+
+	cmd, err := factory()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	cmd.Run(args)
+}
+
+// commands returns the b2 commands other than shell, which share the client
+// and resolve paths against the current folder. Each call returns fresh
+// commands, so that flags don't carry over from one command to the next.
+func (c *ShellCommand) commands() map[string]cli.CommandFactory {
+	commands := commandFactories(&baseCommand{
+		ui:         c.ui,
+		client:     c.session.client,
+		profile:    c.profile,
+		configPath: c.configPath,
+		shell:      c.session,
+	})
+	delete(commands, c.Name())
+
+	// Servers would never give the prompt back
+	delete(commands, "serve")
+	delete(commands, "serve http")
+	return commands
+}
+
+// commandNames returns the names of the shell and b2 commands, sorted.
+func (c *ShellCommand) commandNames() []string {
+	var names []string
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	for name := range c.commands() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// help prints the shell and b2 commands, or the help of one command.
+func (c *ShellCommand) help(args []string) {
+	if len(args) > 0 {
+		if synopsis, ok := shellCommands[args[0]]; ok {
+			c.ui.Output(synopsis)
+			return
+		}
+
+		factory, ok := c.commands()[args[0]]
+		if !ok {
+			c.ui.Error(fmt.Sprintf("Unknown command %q", args[0]))
+			return
+		}
+		cmd, err := factory()
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		c.ui.Output(cmd.Help())
+		return
+	}
+
+	commands := c.commands()
+
+	var shellRows, rows [][]string
+	for _, name := range c.commandNames() {
+		if synopsis, ok := shellCommands[name]; ok {
+			shellRows = append(shellRows, []string{"   ", name, synopsis})
+			continue
+		}
+		cmd, err := commands[name]()
+		if err != nil {
+			continue
+		}
+		rows = append(rows, []string{"   ", name, cmd.Synopsis()})
+	}
+
+	lines := []string{"Shell commands:"}
+	lines = append(lines, formatColumns(shellRows)...)
+	lines = append(lines, "", "Commands:")
+	lines = append(lines, formatColumns(rows)...)
+	c.ui.Output(strings.Join(lines, "\n"))
+}
+
+// prompt returns the prompt showing the current folder.
+func (c *ShellCommand) prompt() string {
+	return "b2:/" + strings.TrimSuffix(c.session.dir, "/") + "> "
+}
+
+// lineReader returns a reader with line editing, history and tab completion
+// when the shell reads from a terminal, or a plain line reader otherwise.
+func (c *ShellCommand) lineReader() lineReader {
+	stdin := c.stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	stdout := c.stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+
+	f, ok := stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return &plainReader{scanner: bufio.NewScanner(stdin)}
+	}
+
+	names := c.commandNames()
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{stdin, stdout}, "")
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' || pos != len(line) {
+			return "", 0, false
+		}
+		newLine, ok := c.session.complete(context.TODO(), line, names)
+		return newLine, len(newLine), ok
+	}
+
+	return &terminalReader{fd: int(f.Fd()), terminal: terminal}
+}
+
+// lineReader reads the commands typed into the shell.
+type lineReader interface {
+	// readLine returns the next line, or io.EOF when there are no more.
+	readLine(prompt string) (string, error)
+}
+
+// plainReader reads lines without showing a prompt, e.g. from a pipe.
+type plainReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// terminalReader reads lines from a terminal. The terminal is only in raw
+// mode while a line is read, so that commands can print progress and be
+// interrupted as usual.
+type terminalReader struct {
+	fd       int
+	terminal *term.Terminal
+}
+
+func (r *terminalReader) readLine(prompt string) (string, error) {
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+
+	if width, height, err := term.GetSize(r.fd); err == nil {
+		r.terminal.SetSize(width, height)
+	}
+	r.terminal.SetPrompt(prompt)
+
+	return r.terminal.ReadLine()
+}
+
+// shellSession is the state the shell keeps between commands.
+type shellSession struct {
+	client *b2.Client
+
+	// Current folder as "<bucket>/<prefix>", always ending with a slash,
+	// or empty at the root, which holds the buckets.
+	dir string
+
+	// Folder the shell started in.
+	home string
+
+	// Remote names listed for tab completion, keyed by folder and the
+	// start of the name.
+	completions map[string][]string
+}
+
+// resolve returns the path as "<bucket>/<prefix>" by resolving it against
+// the current folder, or against the root if it starts with "/". A trailing
+// slash is kept, and the root resolves to an empty path.
+func (s *shellSession) resolve(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + s.dir + p
+	}
+
+	base := path.Base(p)
+	folder := strings.HasSuffix(p, "/") || base == "." || base == ".."
+
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	if folder {
+		p = folderPath(p)
+	}
+	return p
+}
+
+// cd changes the current folder, which has to be the root, a bucket or a
+// folder with files in it.
+func (s *shellSession) cd(ctx context.Context, dir string) error {
+	if dir == "" {
+		s.dir = dir
+		return nil
+	}
+
+	bucketName, prefix := splitBucketAndPrefix(dir)
+
+	bucket, err := s.client.Bucket.Lookup(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+
+	if prefix != "" {
+		files, _, err := s.client.File.List(ctx, &b2.FileListRequest{
+			BucketID:     bucket.ID,
+			Prefix:       prefix,
+			MaxFileCount: 1,
+		})
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no such folder: /%s", dir)
+		}
+	}
+
+	s.dir = dir
+	return nil
+}
+
+// complete completes the last word of the line with a command name if it's
+// the first word, or with a remote name otherwise. If several names match,
+// the word is completed up to where they differ. It reports whether the
+// line was changed.
+func (s *shellSession) complete(ctx context.Context, line string, commands []string) (string, bool) {
+	start := lastWord(line)
+	words, err := splitArgs(line[start:])
+	if err != nil {
+		return line, false
+	}
+	word := ""
+	if len(words) > 0 {
+		word = words[0]
+	}
+	if strings.HasPrefix(word, "-") {
+		return line, false
+	}
+
+	var dir string
+	var names []string
+	if strings.TrimSpace(line[:start]) == "" {
+		for _, name := range commands {
+			if strings.HasPrefix(name, word) {
+				names = append(names, name)
+			}
+		}
+	} else {
+		dir = word[:strings.LastIndex(word, "/")+1]
+		if names, err = s.remoteNames(ctx, dir, word[len(dir):]); err != nil {
+			return line, false
+		}
+	}
+
+	if len(names) == 0 {
+		return line, false
+	}
+
+	completed := dir + commonPrefix(names)
+	newLine := line[:start] + argEscaper.Replace(completed)
+	if len(names) == 1 && !strings.HasSuffix(completed, "/") {
+		newLine += " "
+	}
+	return newLine, newLine != line
+}
+
+// remoteNames returns the names of the buckets, files and folders in the
+// folder that start with the given name. Folder names end with a slash.
+func (s *shellSession) remoteNames(ctx context.Context, dir, name string) ([]string, error) {
+	folder := folderPath(s.resolve(dir))
+	if names, ok := s.completions[folder+name]; ok {
+		return names, nil
+	}
+
+	var names []string
+	if folder == "" {
+		buckets, _, err := s.client.Bucket.List(ctx, &b2.BucketListRequest{AccountID: s.client.AccountID})
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range buckets {
+			if strings.HasPrefix(bucket.Name, name) {
+				names = append(names, bucket.Name+"/")
+			}
+		}
+	} else {
+		bucketName, prefix := splitBucketAndPrefix(folder)
+
+		bucket, err := s.client.Bucket.Lookup(ctx, bucketName)
+		if err != nil {
+			return nil, err
+		}
+
+		files, _, err := s.client.File.List(ctx, &b2.FileListRequest{
+			BucketID:     bucket.ID,
+			Prefix:       prefix + name,
+			Delimiter:    "/",
+			MaxFileCount: maxCompletions,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			names = append(names, strings.TrimPrefix(file.FileName, prefix))
+		}
+	}
+
+	if s.completions == nil {
+		s.completions = make(map[string][]string)
+	}
+	s.completions[folder+name] = names
+	return names, nil
+}
+
+// folderPath adds a trailing slash to the path unless it's empty or already
+// has one.
+func folderPath(p string) string {
+	if p == "" || strings.HasSuffix(p, "/") {
+		return p
+	}
+	return p + "/"
+}
+
+// argEscaper escapes the characters that splitArgs treats specially.
+var argEscaper = strings.NewReplacer(`\`, `\\`, " ", `\ `, "\t", `\	`, `"`, `\"`, "'", `\'`)
+
+// lastWord returns the index where the last word of the line starts. Spaces
+// escaped with a backslash are part of the word.
+func lastWord(line string) int {
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ' ', '\t':
+			start = i + 1
+		}
+	}
+	return start
+}
+
+// commonPrefix returns the longest prefix shared by all of the names.
+func commonPrefix(names []string) string {
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// splitArgs splits a line into arguments separated by spaces. Single quotes
+// keep everything between them as is, while a backslash escapes the next
+// character outside of quotes and a quote or backslash in double quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	quote := byte(0)
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				arg.WriteByte(ch)
+			}
+		case quote == '"':
+			switch {
+			case ch == '"':
+				quote = 0
+			case ch == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\'):
+				i++
+				arg.WriteByte(line[i])
+			default:
+				arg.WriteByte(ch)
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+			inArg = true
+		case ch == '\\':
+			if i+1 < len(line) {
+				i++
+				arg.WriteByte(line[i])
+			}
+			inArg = true
+		case ch == ' ' || ch == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(ch)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,141 @@
+package command
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+func TestShellSession_Resolve(t *testing.T) {
+	tests := []struct {
+		dir  string
+		path string
+		want string
+	}{
+		{"my-bucket/photos/", "cat.jpg", "my-bucket/photos/cat.jpg"},
+		{"my-bucket/photos/", "2020/", "my-bucket/photos/2020/"},
+		{"my-bucket/photos/", "", "my-bucket/photos/"},
+		{"my-bucket/photos/", ".", "my-bucket/photos/"},
+		{"my-bucket/photos/", "..", "my-bucket/"},
+		{"my-bucket/photos/", "../..", ""},
+		{"my-bucket/photos/", "../../..", ""},
+		{"my-bucket/photos/", "../notes.txt", "my-bucket/notes.txt"},
+		{"my-bucket/photos/", "/other-bucket/logs", "other-bucket/logs"},
+		{"my-bucket/photos/", "/", ""},
+		{"", "my-bucket", "my-bucket"},
+	}
+
+	for _, tt := range tests {
+		s := &shellSession{dir: tt.dir}
+		assert.Equal(t, tt.want, s.resolve(tt.path), "%q in %q", tt.path, tt.dir)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	script := `
+pwd
+cd photos
+pwd
+ls
+cd 2020
+cd ../../photos-old
+pwd
+cd /
+ls
+cd missing
+cd /my-bucket/missing
+pwd
+cd
+pwd
+shell
+ls -profile work
+exit
+pwd
+`
+
+	ui := cli.NewMockUi()
+	cmd := &ShellCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, newFindTestBucket())},
+		stdin:       strings.NewReader(script),
+	}
+
+	code := cmd.Run([]string{"my-bucket"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	assert.Equal(t, "/my-bucket/\n"+
+		"/my-bucket/photos/\n"+
+		"photos/2020/\n"+
+		"photos/cat.jpg\n"+
+		"photos/notes.txt\n"+
+		"/my-bucket/photos-old/\n"+
+		"my-bucket/\n"+
+		"/\n"+
+		"/my-bucket/\n", ui.OutputWriter.String())
+
+	errors := strings.Split(strings.TrimSpace(ui.ErrorWriter.String()), "\n")
+	require.Len(t, errors, 4)
+	assert.Contains(t, errors[0], "missing")
+	assert.Equal(t, "Error: no such folder: /my-bucket/missing/", errors[1])
+	assert.Equal(t, `Unknown command "shell". Type "help" for a list of commands.`, errors[2])
+	assert.Equal(t, "Error: -profile can't be used in the shell, start the shell with it instead", errors[3])
+}
+
+func TestShellSession_Complete(t *testing.T) {
+	bucket := newFindTestBucket()
+	bucket.add(b2.File{FileName: "photos/my cat.jpg"})
+
+	s := &shellSession{client: newTestBucketServer(t, bucket), dir: "my-bucket/"}
+	commands := []string{"cat", "cd", "create"}
+
+	tests := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"c", "c", false},
+		{"cr", "create ", true},
+		{"ls ph", "ls photos", true},
+		{"ls photos/", "ls photos/", false},
+		{"ls photos/n", "ls photos/notes.txt ", true},
+		{"ls photos/2", "ls photos/2020/", true},
+		{"ls photos/m", `ls photos/my\ cat.jpg `, true},
+		{"ls photos/x", "ls photos/x", false},
+		{"ls ../m", "ls ../my-bucket/", true},
+		{"cd /m", "cd /my-bucket/", true},
+		{"ls -l", "ls -l", false},
+	}
+
+	for _, tt := range tests {
+		line, ok := s.complete(context.Background(), tt.line, commands)
+		assert.Equal(t, tt.want, line, tt.line)
+		assert.Equal(t, tt.ok, ok, tt.line)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  list  -l  photos ", []string{"list", "-l", "photos"}},
+		{`get my\ cat.jpg .`, []string{"get", "my cat.jpg", "."}},
+		{`get "my cat.jpg" 'a "b"'`, []string{"get", "my cat.jpg", `a "b"`}},
+		{`put "say \"hi\".txt" ''`, []string{"put", `say "hi".txt`, ""}},
+	}
+
+	for _, tt := range tests {
+		args, err := splitArgs(tt.line)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, args, tt.line)
+	}
+
+	_, err := splitArgs(`get "cat.jpg`)
+	assert.EqualError(t, err, "unterminated quote")
+}
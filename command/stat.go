@@ -0,0 +1,200 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+type StatCommand struct {
+	*baseCommand
+}
+
+func (c *StatCommand) Help() string {
+	helpText := `
+Usage: b2 stat [options] <path>
+
+  Shows information about a bucket or a file, e.g. "my-bucket" or
+  "my-bucket/photos/cat.jpg".
+
+General Options:
+
+  ` + c.generalOptions() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StatCommand) Synopsis() string {
+	return "Show information about a bucket or a file"
+}
+
+func (c *StatCommand) Name() string { return "stat" }
+
+func (c *StatCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got exactly one argument
+	args = flags.Args()
+	if len(args) != 1 {
+		c.ui.Error("This command takes one argument: <path>")
+		return 1
+	}
+
+	p, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	bucketName, filename := splitBucketAndPrefix(p)
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ctx := context.TODO()
+
+	out := c.newPrinter(false)
+
+	if filename == "" {
+		bucket, err := statBucket(ctx, client, bucketName)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+		out.print(formatBucket(bucket), bucket)
+	} else {
+		bucket, err := client.Bucket.Lookup(ctx, bucketName)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+		file, err := statFile(ctx, client, bucket.ID, filename)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+		out.print(formatFile(bucket.Name, file), file)
+	}
+
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// statBucket returns the current settings of the bucket. Unlike lookups,
+// it never uses the cache.
+func statBucket(ctx context.Context, client *b2.Client, name string) (*b2.Bucket, error) {
+	req := &b2.BucketListRequest{
+		AccountID: client.AccountID,
+		Name:      name,
+	}
+
+	buckets, _, err := client.Bucket.List(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("bucket with name %q was not found", name)
+	}
+
+	return &buckets[0], nil
+}
+
+// statFile returns the latest version of the file with the given name.
+func statFile(ctx context.Context, client *b2.Client, bucketID, filename string) (*b2.File, error) {
+	file, err := findFile(ctx, client, bucketID, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == nil {
+		return nil, fmt.Errorf("file %q was not found", filename)
+	}
+
+	return file, nil
+}
+
+// findFile returns the latest version of the file with the given name, or
+// nil if there is no such file.
+func findFile(ctx context.Context, client *b2.Client, bucketID, filename string) (*b2.File, error) {
+	req := &b2.FileListRequest{
+		BucketID:      bucketID,
+		StartFileName: filename,
+		Prefix:        filename,
+		MaxFileCount:  1,
+	}
+
+	files, _, err := client.File.List(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 || files[0].FileName != filename {
+		return nil, nil
+	}
+
+	return &files[0], nil
+}
+
+// formatBucket returns the human readable description of the bucket.
+func formatBucket(bucket *b2.Bucket) string {
+	lines := []string{
+		statLine("Name", bucket.Name),
+		statLine("ID", bucket.ID),
+		statLine("Type", bucket.Type),
+		statLine("Revision", fmt.Sprint(bucket.Revision)),
+	}
+	lines = append(lines, statInfo(bucket.Info)...)
+	return strings.Join(lines, "\n")
+}
+
+// formatFile returns the human readable description of the file.
+func formatFile(bucketName string, file *b2.File) string {
+	lines := []string{
+		statLine("Name", bucketName+"/"+file.FileName),
+		statLine("ID", file.FileID),
+		statLine("Size", fmt.Sprint(file.ContentLength)),
+		statLine("Content type", file.ContentType),
+		statLine("SHA1", fileSHA1(*file)),
+		statLine("Uploaded", time.Unix(0, file.UploadTimestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339)),
+	}
+	if millis, ok := fileLastModified(*file); ok {
+		lines = append(lines, statLine("Modified", time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC3339)))
+	}
+	lines = append(lines, statInfo(file.FileInfo)...)
+	return strings.Join(lines, "\n")
+}
+
+func statLine(name, value string) string {
+	return fmt.Sprintf("%-14s%s", name+":", value)
+}
+
+// statInfo returns the info key/value pairs, sorted by key.
+func statInfo(info map[string]string) []string {
+	keys := make([]string, 0, len(info))
+	for k := range info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, statLine("Info", k+"="+info[k]))
+	}
+	return lines
+}
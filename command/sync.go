@@ -0,0 +1,813 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/romantomjak/b2/b2"
+	"golang.org/x/sync/semaphore"
+)
+
+// remotePathPrefix marks a path as referring to a bucket rather than to
+// the local file system.
+const remotePathPrefix = "b2://"
+
+// Kinds of actions performed by sync.
+const (
+	syncUpload   = "upload"
+	syncDownload = "download"
+	syncHide     = "hide"
+	syncDelete   = "delete"
+)
+
+// Ways of handling files that exist in the destination, but not in the
+// source.
+const (
+	deleteModeKeep   = "keep"
+	deleteModeHide   = "hide"
+	deleteModeDelete = "delete"
+)
+
+type SyncCommand struct {
+	*baseCommand
+
+	// Whether to compare files by SHA1 checksum instead of size and
+	// modification time.
+	checksum bool
+
+	// Maximum number of files transferred in parallel.
+	concurrency int
+
+	// What to do with destination files that are missing in the source.
+	deleteMode string
+
+	// Whether to only print the actions instead of performing them.
+	dryRun bool
+
+	// Maximum percentage of destination files that may be deleted.
+	maxDelete int
+
+	// Size of the parts large files are uploaded in.
+	partSize sizeValue
+
+	// Decides which files are synchronized. Files that are filtered out
+	// are neither transferred nor deleted.
+	filter fileFilter
+}
+
+func (c *SyncCommand) Help() string {
+	helpText := `
+Usage: b2 sync [options] <source> <destination>
+
+  Uploads new and changed files from a local directory to a bucket, or
+  downloads them from a bucket to a local directory. The remote side is
+  written as b2://<bucket>/<prefix>, and files keep their paths relative
+  to the source directory or prefix.
+
+  Downloaded files get the modification time recorded when the file was
+  uploaded, so that subsequent syncs recognize them as unchanged.
+
+  Files that exist in the destination but not in the source are kept
+  unless -delete says otherwise.
+
+  Files are compared by size and modification time, or by SHA1 checksum
+  if -checksum is set, and only files that differ are transferred.
+
+General Options:
+
+  ` + c.generalOptions() + `
+
+Sync Options:
+
+  -checksum
+    Compare files by SHA1 checksum instead of size and modification
+    time. This requires reading every local file.
+
+  -concurrency=<n>
+    Number of files to transfer in parallel. Defaults to 4.
+
+  -delete=<mode>
+    What to do with files that exist in the destination, but not in the
+    source. Either "keep" to leave them alone, "hide" to hide them in
+    the bucket while keeping the older versions, or "delete" to delete
+    all versions from the bucket or delete the local files when syncing
+    from a bucket. Defaults to "keep".
+
+  -dry-run
+    Print the actions that would be performed without performing them.
+
+  -max-delete=<percent>
+    Abort without making changes if more than this percentage of the
+    destination files would be hidden or deleted. Defaults to 50.
+
+  -part-size=<size>
+    Size of the parts files larger than a single part are uploaded
+    in, e.g. "100M". Must be between 5000000 and 5000000000 bytes.
+    Defaults to the part size recommended by B2.
+
+Filter Options:
+
+  Files that are filtered out are neither transferred nor deleted, on
+  both sides of the sync.
+
+  ` + filterOptions() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *SyncCommand) Synopsis() string {
+	return "Synchronize a directory with a bucket"
+}
+
+func (c *SyncCommand) Name() string { return "sync" }
+
+func (c *SyncCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.BoolVar(&c.checksum, "checksum", false, "")
+	flags.IntVar(&c.concurrency, "concurrency", 4, "")
+	flags.StringVar(&c.deleteMode, "delete", deleteModeKeep, "")
+	flags.BoolVar(&c.dryRun, "dry-run", false, "")
+	flags.IntVar(&c.maxDelete, "max-delete", 50, "")
+	flags.Var(&c.partSize, "part-size", "")
+	c.filter.addFlags(flags)
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got both arguments
+	args = flags.Args()
+	if len(args) != 2 {
+		c.ui.Error("This command takes two arguments: <source> and <destination>")
+		return 1
+	}
+
+	if c.concurrency < 1 {
+		c.ui.Error("-concurrency must be at least 1")
+		return 1
+	}
+
+	if c.maxDelete < 0 || c.maxDelete > 100 {
+		c.ui.Error("-max-delete must be a percentage between 0 and 100")
+		return 1
+	}
+
+	if err := validatePartSize(c.partSize); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	src, dst := args[0], args[1]
+
+	// Remote paths without a bucket name refer to the default bucket
+	for _, p := range []*string{&src, &dst} {
+		if !strings.HasPrefix(*p, remotePathPrefix) {
+			continue
+		}
+		path, err := c.bucketPath(strings.TrimPrefix(*p, remotePathPrefix))
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+		*p = remotePathPrefix + path
+	}
+
+	// One side of the sync must be remote
+	bucketName, filePrefix, upload := parseRemotePath(dst)
+	if !upload {
+		var download bool
+		bucketName, filePrefix, download = parseRemotePath(src)
+		if !download {
+			c.ui.Error(fmt.Sprintf("Error: either source or destination must be a %s<bucket>/<prefix> path", remotePathPrefix))
+			return 1
+		}
+	}
+
+	// Validate delete mode
+	switch c.deleteMode {
+	case deleteModeKeep, deleteModeDelete:
+	case deleteModeHide:
+		if !upload {
+			c.ui.Error(`-delete=hide can only be used when syncing to a bucket`)
+			return 1
+		}
+	default:
+		c.ui.Error(`-delete must be one of "keep", "hide" or "delete"`)
+		return 1
+	}
+
+	// Check that the local side is a directory
+	dir := src
+	if !upload {
+		dir = dst
+	}
+	info, err := os.Stat(dir)
+	if err != nil && !(os.IsNotExist(err) && !upload) {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	if err == nil && !info.IsDir() {
+		c.ui.Error(fmt.Sprintf("Error: %s is not a directory", dir))
+		return 1
+	}
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ctx := context.TODO()
+
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	if upload {
+		return c.syncUp(ctx, bucket, dir, filePrefix)
+	}
+	return c.syncDown(ctx, bucket, filePrefix, dir)
+}
+
+// syncAction is a single transfer required to bring the destination in
+// sync with the source.
+type syncAction struct {
+	// Kind of action, e.g. "upload".
+	op string
+
+	// Path of the local file.
+	local string
+
+	// Full name of the remote file.
+	remote string
+
+	// The local file's info, set when uploading.
+	info fs.FileInfo
+
+	// The remote file, set when downloading.
+	file b2.File
+
+	// All versions of the remote file, set when deleting remote files.
+	versions []b2.File
+}
+
+// describe returns a human readable description of the action.
+func (a syncAction) describe(bucketName string) string {
+	remote := remotePathPrefix + path.Join(bucketName, a.remote)
+	switch a.op {
+	case syncUpload:
+		return fmt.Sprintf("%s: %s -> %s", a.op, a.local, remote)
+	case syncDownload:
+		return fmt.Sprintf("%s: %s -> %s", a.op, remote, a.local)
+	case syncDelete:
+		if a.local != "" {
+			return fmt.Sprintf("%s: %s", a.op, a.local)
+		}
+	}
+	return fmt.Sprintf("%s: %s", a.op, remote)
+}
+
+// result returns the machine readable description of the action.
+func (a syncAction) result(bucketName string, file *b2.File) transferResult {
+	remote := remotePathPrefix + path.Join(bucketName, a.remote)
+	result := transferResult{Action: a.op, File: file}
+	switch {
+	case a.op == syncUpload:
+		result.Source, result.Destination = a.local, remote
+	case a.op == syncDownload:
+		result.Source, result.Destination = remote, a.local
+	case a.op == syncDelete && a.local != "":
+		result.Source = a.local
+	default:
+		result.Source = remote
+	}
+	return result
+}
+
+// syncFunc performs the action and returns the affected remote file, if any.
+type syncFunc func(context.Context, syncAction) (*b2.File, error)
+
+// syncUp uploads files that are missing or differ in the bucket.
+func (c *SyncCommand) syncUp(ctx context.Context, bucket *b2.Bucket, dir, prefix string) int {
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	prefix = syncPrefix(prefix)
+
+	localFiles, err := walkLocalFiles(dir, &c.filter)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	remoteFiles, err := listRemoteFiles(ctx, client, bucket.ID, prefix, &c.filter)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	filterSyncFiles(&c.filter, localFiles, remoteFiles)
+
+	var actions []syncAction
+	for _, name := range localNames(localFiles) {
+		local := localFiles[name]
+
+		if remote, found := remoteFiles[name]; found {
+			differ, err := c.differ(local, remote)
+			if err != nil {
+				c.ui.Error(fmt.Sprintf("Error: %v", err))
+				return 1
+			}
+			if !differ {
+				continue
+			}
+		}
+
+		actions = append(actions, syncAction{
+			op:     syncUpload,
+			local:  local.path,
+			remote: prefix + name,
+			info:   local.info,
+		})
+	}
+
+	// Remote files missing locally
+	if c.deleteMode != deleteModeKeep {
+		var versions map[string][]b2.File
+		if c.deleteMode == deleteModeDelete {
+			versions, err = listRemoteVersions(ctx, client, bucket.ID, prefix)
+			if err != nil {
+				c.ui.Error(fmt.Sprintf("Error: %v", err))
+				return 1
+			}
+		}
+
+		op := syncHide
+		if c.deleteMode == deleteModeDelete {
+			op = syncDelete
+		}
+
+		for _, name := range remoteNames(remoteFiles) {
+			if _, found := localFiles[name]; found {
+				continue
+			}
+			remote := remoteFiles[name]
+			actions = append(actions, syncAction{
+				op:       op,
+				remote:   remote.FileName,
+				file:     remote,
+				versions: versions[remote.FileName],
+			})
+		}
+	}
+
+	ui := &cli.ConcurrentUi{Ui: c.ui}
+	put := &PutCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+		quiet:       true,
+		partSize:    c.partSize,
+	}
+
+	return c.apply(ctx, ui, bucket.Name, actions, len(remoteFiles), func(ctx context.Context, a syncAction) (*b2.File, error) {
+		switch a.op {
+		case syncHide:
+			return client.File.Hide(ctx, &b2.HideFileRequest{BucketID: bucket.ID, FileName: a.remote})
+		case syncDelete:
+			for _, version := range a.versions {
+				req := &b2.DeleteFileVersionRequest{FileName: version.FileName, FileID: version.FileID}
+				if _, err := client.File.DeleteVersion(ctx, req); err != nil {
+					return nil, err
+				}
+			}
+			return &a.file, nil
+		}
+		return put.uploadFile(ctx, bucket.ID, a.info, a.local, a.remote)
+	})
+}
+
+// syncDown downloads files that are missing or differ in the directory.
+func (c *SyncCommand) syncDown(ctx context.Context, bucket *b2.Bucket, prefix, dir string) int {
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	prefix = syncPrefix(prefix)
+
+	// A dry run leaves the file system alone, so a missing directory
+	// counts as empty.
+	if !c.dryRun {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+	}
+
+	// Walk the directory first, so that the ignore files found in it
+	// also apply to the remote files.
+	localFiles, err := walkLocalFiles(dir, &c.filter)
+	if c.dryRun && errors.Is(err, fs.ErrNotExist) {
+		localFiles, err = make(map[string]localFile), nil
+	}
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	remoteFiles, err := listRemoteFiles(ctx, client, bucket.ID, prefix, &c.filter)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	filterSyncFiles(&c.filter, localFiles, remoteFiles)
+
+	var actions []syncAction
+	for _, name := range remoteNames(remoteFiles) {
+		remote := remoteFiles[name]
+
+		filename, err := localPath(dir, name)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error: %v", err))
+			return 1
+		}
+
+		if local, found := localFiles[name]; found {
+			differ, err := c.differ(local, remote)
+			if err != nil {
+				c.ui.Error(fmt.Sprintf("Error: %v", err))
+				return 1
+			}
+			if !differ {
+				continue
+			}
+		}
+
+		actions = append(actions, syncAction{
+			op:     syncDownload,
+			local:  filename,
+			remote: remote.FileName,
+			file:   remote,
+		})
+	}
+
+	// Local files missing in the bucket
+	if c.deleteMode == deleteModeDelete {
+		for _, name := range localNames(localFiles) {
+			if _, found := remoteFiles[name]; found {
+				continue
+			}
+			actions = append(actions, syncAction{
+				op:    syncDelete,
+				local: localFiles[name].path,
+			})
+		}
+	}
+
+	ui := &cli.ConcurrentUi{Ui: c.ui}
+
+	return c.apply(ctx, ui, bucket.Name, actions, len(localFiles), func(ctx context.Context, a syncAction) (*b2.File, error) {
+		if a.op == syncDelete {
+			return nil, os.Remove(a.local)
+		}
+		return &a.file, downloadFile(ctx, client, bucket.Name, a.file, a.local)
+	})
+}
+
+// apply performs the actions, unless it's a dry run or the actions would
+// delete more destination files than allowed.
+func (c *SyncCommand) apply(ctx context.Context, ui cli.Ui, bucketName string, actions []syncAction, numDestFiles int, perform syncFunc) int {
+	numDeletes := 0
+	for _, action := range actions {
+		if action.op == syncHide || action.op == syncDelete {
+			numDeletes++
+		}
+	}
+
+	if numDeletes > 0 && numDeletes*100 > c.maxDelete*numDestFiles {
+		ui.Error(fmt.Sprintf("Error: refusing to %s %d of %d files, which is more than %d%%. Use -max-delete to raise the limit", c.deleteMode, numDeletes, numDestFiles, c.maxDelete))
+		return 1
+	}
+
+	out := c.newPrinter(true)
+
+	if c.dryRun {
+		for _, action := range actions {
+			result := action.result(bucketName, nil)
+			result.DryRun = true
+			out.print("(dry run) "+action.describe(bucketName), result)
+		}
+		return c.flush(out)
+	}
+
+	// Transfer files before deleting anything
+	var transfers, deletes []syncAction
+	for _, action := range actions {
+		if action.op == syncHide || action.op == syncDelete {
+			deletes = append(deletes, action)
+		} else {
+			transfers = append(transfers, action)
+		}
+	}
+
+	code := c.execute(ctx, ui, out, bucketName, transfers, perform)
+	if code == 0 {
+		code = c.execute(ctx, ui, out, bucketName, deletes, perform)
+	}
+
+	// Report the actions that were performed, even if others failed
+	if flushCode := c.flush(out); flushCode != 0 {
+		return flushCode
+	}
+
+	return code
+}
+
+// flush prints the results of the actions.
+func (c *SyncCommand) flush(out *resultPrinter) int {
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	return 0
+}
+
+// execute performs every action using a pool of workers.
+func (c *SyncCommand) execute(ctx context.Context, ui cli.Ui, out *resultPrinter, bucketName string, actions []syncAction, perform syncFunc) int {
+	sem := semaphore.NewWeighted(int64(c.concurrency))
+
+	var mu sync.Mutex
+	failed := 0
+
+	for _, action := range actions {
+		// Blocks until a worker becomes available
+		if err := sem.Acquire(ctx, 1); err != nil {
+			ui.Error(fmt.Sprintf("Error: failed to acquire semaphore: %v", err))
+			return 1
+		}
+
+		go func(action syncAction) {
+			defer sem.Release(1)
+
+			file, err := perform(ctx, action)
+			if err != nil {
+				ui.Error(fmt.Sprintf("Error: %s: %v", action.describe(bucketName), err))
+				mu.Lock()
+				failed++
+				mu.Unlock()
+				return
+			}
+
+			out.print(action.describe(bucketName), action.result(bucketName, file))
+		}(action)
+	}
+
+	// Acquire all of the tokens to wait for any remaining workers to finish.
+	if err := sem.Acquire(ctx, int64(c.concurrency)); err != nil {
+		ui.Error(fmt.Sprintf("Error: failed to acquire semaphore: %v", err))
+		return 1
+	}
+
+	if failed > 0 {
+		ui.Error(fmt.Sprintf("Error: %d of %d actions failed", failed, len(actions)))
+		return 1
+	}
+
+	return 0
+}
+
+// differ reports whether the local file and the remote file have different
+// contents.
+func (c *SyncCommand) differ(local localFile, remote b2.File) (bool, error) {
+	if local.info.Size() != int64(remote.ContentLength) {
+		return true, nil
+	}
+
+	if c.checksum {
+		sha1, err := calculateFileSHA1(local.path)
+		if err != nil {
+			return false, err
+		}
+		return sha1 != fileSHA1(remote), nil
+	}
+
+	// Compare with a precision of one second, because that's what the
+	// client records when uploading files.
+	lastModified, ok := fileLastModified(remote)
+	if !ok {
+		return true, nil
+	}
+	return local.info.ModTime().Unix() != lastModified/1000, nil
+}
+
+// downloadFile downloads the remote file to filename, creating any missing
+// directories and setting the modification time of the original file.
+//
+// The file is downloaded to a temporary file first, so that an interrupted
+// download does not leave a partial file behind.
+func downloadFile(ctx context.Context, client *b2.Client, bucketName string, file b2.File, filename string) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".b2tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// See https://github.com/golang/go/issues/16474
+	_, err = client.File.Download(ctx, downloadURL(client, bucketName, file.FileName), struct{ io.Writer }{tmp})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	modTime := time.Unix(0, file.UploadTimestamp*int64(time.Millisecond))
+	if millis, ok := fileLastModified(file); ok {
+		modTime = time.Unix(0, millis*int64(time.Millisecond))
+	}
+	if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// localPath returns the path of the remote file name inside dir. Names
+// that would end up outside of dir are rejected.
+func localPath(dir, name string) (string, error) {
+	rel := filepath.FromSlash(name)
+	if filepath.IsAbs(rel) || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("refusing to write %q outside of %s", name, dir)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+// localFile is a regular file found in a local directory tree.
+type localFile struct {
+	path string
+	info fs.FileInfo
+}
+
+// walkLocalFiles returns all regular files in the directory tree that pass
+// the name filters keyed by their slash separated path relative to dir.
+// The size and time filters are left to filterSyncFiles.
+func walkLocalFiles(dir string, filter *fileFilter) (map[string]localFile, error) {
+	files := make(map[string]localFile)
+	err := filter.walkNames(dir, func(p, name string, info fs.FileInfo) error {
+		files[name] = localFile{p, info}
+		return nil
+	})
+	return files, err
+}
+
+// listRemoteFiles returns all files under the prefix that pass the name
+// filters keyed by their name relative to the prefix. Folder markers are
+// left out.
+func listRemoteFiles(ctx context.Context, client *b2.Client, bucketID, prefix string, filter *fileFilter) (map[string]b2.File, error) {
+	req := &b2.FileListRequest{
+		BucketID: bucketID,
+		Prefix:   prefix,
+	}
+
+	files, err := client.File.ListAll(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]b2.File, len(files))
+	for _, file := range files {
+		if file.Action != "upload" {
+			continue
+		}
+		name := strings.TrimPrefix(file.FileName, prefix)
+
+		// Folder markers, such as "photos/", are not files
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if !filter.matchName(name, false) {
+			continue
+		}
+		m[name] = file
+	}
+	return m, nil
+}
+
+// filterSyncFiles removes the files the size or time filters skip on either
+// side from both sides. Otherwise a local file that grew past -max-size
+// would count as missing locally, and its remote copy would be deleted.
+func filterSyncFiles(filter *fileFilter, localFiles map[string]localFile, remoteFiles map[string]b2.File) {
+	for name, local := range localFiles {
+		if !filter.matchAttrs(local.info.Size(), local.info.ModTime()) {
+			delete(localFiles, name)
+			delete(remoteFiles, name)
+		}
+	}
+	for name, remote := range remoteFiles {
+		if !filter.matchRemoteAttrs(remote) {
+			delete(localFiles, name)
+			delete(remoteFiles, name)
+		}
+	}
+}
+
+// listRemoteVersions returns all versions of all files under the prefix
+// keyed by their full name.
+func listRemoteVersions(ctx context.Context, client *b2.Client, bucketID, prefix string) (map[string][]b2.File, error) {
+	req := &b2.FileVersionListRequest{
+		BucketID: bucketID,
+		Prefix:   prefix,
+	}
+
+	files, err := client.File.ListAllVersions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string][]b2.File)
+	for _, file := range files {
+		m[file.FileName] = append(m[file.FileName], file)
+	}
+	return m, nil
+}
+
+// parseRemotePath splits a b2://<bucket>/<prefix> path into the bucket name
+// and the file prefix. ok is false if path does not refer to a bucket.
+func parseRemotePath(p string) (bucketName, filePrefix string, ok bool) {
+	if !strings.HasPrefix(p, remotePathPrefix) {
+		return "", "", false
+	}
+	bucketName, filePrefix = splitBucketAndPrefix(strings.TrimPrefix(p, remotePathPrefix))
+	return bucketName, filePrefix, bucketName != ""
+}
+
+// syncPrefix makes sure a non-empty prefix is treated as a folder, so that
+// syncing to "photos" does not pick up files from "photos-old".
+func syncPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// fileSHA1 returns the SHA1 checksum of the file contents. Large files
+// carry the checksum in their file info, if it was set when uploading.
+func fileSHA1(f b2.File) string {
+	if f.ContentSHA1 != "" && f.ContentSHA1 != "none" {
+		return strings.TrimPrefix(f.ContentSHA1, "unverified:")
+	}
+	return f.FileInfo["large_file_sha1"]
+}
+
+// fileLastModified returns the modification time of the original file in
+// milliseconds since the epoch, as recorded by the client that uploaded it.
+func fileLastModified(f b2.File) (int64, bool) {
+	millis, err := strconv.ParseInt(f.FileInfo["src_last_modified_millis"], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return millis, true
+}
+
+// localNames returns the sorted names of the local files.
+func localNames(m map[string]localFile) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// remoteNames returns the sorted names of the remote files.
+func remoteNames(m map[string]b2.File) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
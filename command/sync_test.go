@@ -0,0 +1,475 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+)
+
+func TestSyncCommand_UploadsNewAndChangedFiles(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	modTime := time.Date(2020, 10, 21, 22, 48, 0, 0, time.UTC)
+	for name, content := range map[string]string{
+		"unchanged.txt":     "same",
+		"changed.txt":       "new contents",
+		"docs/new.txt":      "brand new",
+		"docs/deep/old.txt": "same",
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+		require.NoError(t, os.Chtimes(filename, modTime, modTime))
+	}
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "87ba238875c6214145260818", "bucketName": "backups"}]}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{
+			"files": [
+			{
+				"action": "upload",
+				"contentLength": 4,
+				"fileInfo": {"src_last_modified_millis": "%[1]d"},
+				"fileName": "laptop/unchanged.txt"
+			},
+			{
+				"action": "upload",
+				"contentLength": 4,
+				"fileInfo": {"src_last_modified_millis": "%[1]d"},
+				"fileName": "laptop/changed.txt"
+			},
+			{
+				"action": "upload",
+				"contentLength": 4,
+				"fileInfo": {"src_last_modified_millis": "%[1]d"},
+				"fileName": "laptop/docs/deep/old.txt"
+			}
+			],
+			"nextFileName": null
+		}`, modTime.Unix()*1000)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"uploadUrl": "%s/upload", "authorizationToken": "some-secret-token"}`, server.URL)
+	})
+
+	var mu sync.Mutex
+	var uploaded []string
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		name, _ := url.QueryUnescape(r.Header.Get("X-Bz-File-Name"))
+		mu.Lock()
+		uploaded = append(uploaded, name)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"fileName": %q}`, name)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{dir, "b2://backups/laptop"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	sort.Strings(uploaded)
+	assert.Equal(t, []string{"laptop/changed.txt", "laptop/docs/new.txt"}, uploaded)
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "upload: "+filepath.Join(dir, "changed.txt")+" -> b2://backups/laptop/changed.txt")
+	assert.Contains(t, out, "upload: "+filepath.Join(dir, "docs", "new.txt")+" -> b2://backups/laptop/docs/new.txt")
+}
+
+func TestSyncCommand_DownloadsMissingAndChangedFiles(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	modTime := time.Date(2020, 10, 21, 22, 48, 0, 0, time.UTC)
+	unchanged := filepath.Join(dir, "unchanged.txt")
+	require.NoError(t, ioutil.WriteFile(unchanged, []byte("same"), 0644))
+	require.NoError(t, os.Chtimes(unchanged, modTime, modTime))
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "87ba238875c6214145260818", "bucketName": "backups"}]}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{
+			"files": [
+			{
+				"action": "upload",
+				"contentLength": 0,
+				"fileName": "laptop/"
+			},
+			{
+				"action": "upload",
+				"contentLength": 4,
+				"fileInfo": {"src_last_modified_millis": "%[1]d"},
+				"fileName": "laptop/unchanged.txt"
+			},
+			{
+				"action": "upload",
+				"contentLength": 0,
+				"fileName": "laptop/docs/"
+			},
+			{
+				"action": "upload",
+				"contentLength": 9,
+				"fileInfo": {"src_last_modified_millis": "%[1]d"},
+				"fileName": "laptop/docs/my notes.txt"
+			}
+			],
+			"nextFileName": null
+		}`, modTime.Unix()*1000)
+	})
+
+	var mu sync.Mutex
+	var downloaded []string
+	mux.HandleFunc("/file/backups/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		downloaded = append(downloaded, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, "my notes!")
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"b2://backups/laptop/", dir})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	assert.Equal(t, []string{"/file/backups/laptop/docs/my notes.txt"}, downloaded)
+
+	filename := filepath.Join(dir, "docs", "my notes.txt")
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "my notes!", string(content))
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()))
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "download: b2://backups/laptop/docs/my notes.txt -> "+filename)
+}
+
+func TestSyncCommand_DryRunDownloadLeavesDirectoryAlone(t *testing.T) {
+	server, mux := testutil.NewServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "87ba238875c6214145260818", "bucketName": "backups"}]}`)
+	})
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"files": [{"action": "upload", "contentLength": 9, "fileName": "laptop/notes.txt"}]}`)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	missing := filepath.Join(dir, "missing")
+	code := cmd.Run([]string{"-dry-run", "b2://backups/laptop/", missing})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "download: b2://backups/laptop/notes.txt -> "+filepath.Join(missing, "notes.txt"))
+
+	_, err = os.Stat(missing)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSyncCommand_RequiresRemotePath(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui},
+	}
+
+	code := cmd.Run([]string{".", "backups/laptop"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "either source or destination must be a b2://<bucket>/<prefix> path")
+}
+
+func TestSyncCommand_LocalPath(t *testing.T) {
+	_, err := localPath("dir", "../escape.txt")
+	assert.Error(t, err)
+
+	p, err := localPath("dir", "a/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("dir", "a", "b.txt"), p)
+}
+
+// newSyncDeleteServer returns a server with a bucket containing
+// "backups/keep.txt", which exists locally, and "backups/gone.txt",
+// which has two versions and no local counterpart.
+func newSyncDeleteServer(t *testing.T) (*httptest.Server, *http.ServeMux) {
+	server, mux := testutil.NewServer()
+
+	mux.HandleFunc("/b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"buckets": [{"bucketId": "87ba238875c6214145260818", "bucketName": "my-bucket"}]}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_list_file_names", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"files": [
+			{"action": "upload", "contentLength": 4, "fileId": "gone-2", "fileName": "backups/gone.txt"},
+			{"action": "upload", "contentLength": 4, "fileId": "keep-1", "fileName": "backups/keep.txt"}
+			]
+		}`)
+	})
+
+	mux.HandleFunc("/b2api/v2/b2_list_file_versions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"files": [
+			{"action": "upload", "fileId": "gone-2", "fileName": "backups/gone.txt"},
+			{"action": "upload", "fileId": "gone-1", "fileName": "backups/gone.txt"},
+			{"action": "upload", "fileId": "keep-1", "fileName": "backups/keep.txt"}
+			]
+		}`)
+	})
+
+	return server, mux
+}
+
+func newSyncDeleteDir(t *testing.T) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "keep.txt"), []byte("keep"), 0644))
+	return dir
+}
+
+func TestSyncCommand_DeletesAllVersionsOfRemovedFiles(t *testing.T) {
+	server, mux := newSyncDeleteServer(t)
+	defer server.Close()
+
+	dir := newSyncDeleteDir(t)
+	defer os.RemoveAll(dir)
+
+	var deleted []string
+	mux.HandleFunc("/b2api/v2/b2_delete_file_version", func(w http.ResponseWriter, r *http.Request) {
+		req := new(b2.DeleteFileVersionRequest)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		deleted = append(deleted, req.FileID)
+		fmt.Fprintf(w, `{"fileId": %q, "fileName": %q}`, req.FileID, req.FileName)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	// The listing has no checksum for keep.txt, so it's uploaded again.
+	// There's no upload URL handler yet, so the upload fails and nothing
+	// may be deleted.
+	code := cmd.Run([]string{"-delete=delete", "-checksum", dir, "b2://my-bucket/backups"})
+	assert.Equal(t, 1, code)
+
+	assert.Empty(t, deleted)
+
+	mux.HandleFunc("/b2api/v2/b2_get_upload_url", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"uploadUrl": "%s/upload", "authorizationToken": "some-secret-token"}`, server.URL)
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"fileName": "backups/keep.txt"}`)
+	})
+
+	ui = cli.NewMockUi()
+	cmd = &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code = cmd.Run([]string{"-delete=delete", "-checksum", dir, "b2://my-bucket/backups"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, []string{"gone-2", "gone-1"}, deleted)
+	assert.Contains(t, ui.OutputWriter.String(), "delete: b2://my-bucket/backups/gone.txt")
+}
+
+func TestSyncCommand_DryRun(t *testing.T) {
+	server, mux := newSyncDeleteServer(t)
+	defer server.Close()
+
+	dir := newSyncDeleteDir(t)
+	defer os.RemoveAll(dir)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request during dry run: %s", r.URL.Path)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"-dry-run", "-delete=hide", dir, "b2://my-bucket/backups"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "(dry run) upload: "+filepath.Join(dir, "keep.txt")+" -> b2://my-bucket/backups/keep.txt")
+	assert.Contains(t, out, "(dry run) hide: b2://my-bucket/backups/gone.txt")
+}
+
+func TestSyncCommand_SizeFilterAppliesToBothSides(t *testing.T) {
+	server, mux := newSyncDeleteServer(t)
+	defer server.Close()
+
+	dir := newSyncDeleteDir(t)
+	defer os.RemoveAll(dir)
+
+	// keep.txt grew past -max-size, so its remote copy must be left alone
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "keep.txt"), []byte("keep growing"), 0644))
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request during dry run: %s", r.URL.Path)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"-dry-run", "-delete=delete", "-max-delete=100", "-max-size=10", dir, "b2://my-bucket/backups"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "(dry run) delete: b2://my-bucket/backups/gone.txt")
+	assert.NotContains(t, out, "keep.txt")
+}
+
+func TestSyncCommand_SkipsIgnoreFiles(t *testing.T) {
+	server, mux := newSyncDeleteServer(t)
+	defer server.Close()
+
+	dir := newSyncDeleteDir(t)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ignoreFilename), []byte("*.tmp\n"), 0644))
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request during dry run: %s", r.URL.Path)
+	})
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"-dry-run", dir, "b2://my-bucket/backups"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.NotContains(t, ui.OutputWriter.String(), ignoreFilename)
+}
+
+func TestSyncCommand_DryRunAsJSON(t *testing.T) {
+	server, _ := newSyncDeleteServer(t)
+	defer server.Close()
+
+	dir := newSyncDeleteDir(t)
+	defer os.RemoveAll(dir)
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"-dry-run", "-delete=delete", "-format", "json", dir, "b2://my-bucket/backups"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var results []transferResult
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &results), ui.OutputWriter.String())
+	sort.Slice(results, func(i, j int) bool { return results[i].Action > results[j].Action })
+
+	require.Len(t, results, 2)
+	assert.Equal(t, "upload", results[0].Action)
+	assert.Equal(t, filepath.Join(dir, "keep.txt"), results[0].Source)
+	assert.Equal(t, "b2://my-bucket/backups/keep.txt", results[0].Destination)
+	assert.True(t, results[0].DryRun)
+	assert.Equal(t, "delete", results[1].Action)
+	assert.Equal(t, "b2://my-bucket/backups/gone.txt", results[1].Source)
+	assert.True(t, results[1].DryRun)
+}
+
+func TestSyncCommand_MaxDelete(t *testing.T) {
+	server, _ := newSyncDeleteServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "b2-cli-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cache, _ := b2.NewInMemoryCache()
+	client, _ := b2.NewClient("key-id", "key-secret", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui, client: client},
+	}
+
+	code := cmd.Run([]string{"-delete=hide", dir, "b2://my-bucket/backups"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "refusing to hide 2 of 2 files, which is more than 50%")
+}
+
+func TestSyncCommand_DeleteMode(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &SyncCommand{
+		baseCommand: &baseCommand{ui: ui},
+	}
+
+	code := cmd.Run([]string{"-delete=hide", "b2://my-bucket/backups", "."})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "-delete=hide can only be used when syncing to a bucket")
+}
@@ -0,0 +1,253 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+type TreeCommand struct {
+	*baseCommand
+
+	// How many levels of folders below the path are shown. 0 means all.
+	depth int
+
+	// Whether to only show folders.
+	foldersOnly bool
+
+	// Whether to print sizes in K, M, G, etc. rather than bytes.
+	human bool
+}
+
+func (c *TreeCommand) Help() string {
+	helpText := `
+Usage: b2 tree [options] <path>
+
+  Shows the files under a bucket or a folder, e.g. "my-bucket" or
+  "my-bucket/photos", as a tree of folders. Folders are shown with the
+  total size and number of files they contain, including the files in
+  folders deeper than -depth.
+
+General Options:
+
+  ` + c.generalOptions() + `
+
+Tree Options:
+
+  -depth=<n>
+    Number of folder levels below the path that are shown. Defaults
+    to 0, which shows all levels.
+
+  -folders
+    Only show folders.
+
+  -human
+    Print sizes in K, M, G, T or P rather than bytes.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *TreeCommand) Synopsis() string {
+	return "Show files and folders as a tree"
+}
+
+func (c *TreeCommand) Name() string { return "tree" }
+
+func (c *TreeCommand) Run(args []string) int {
+	flags := c.flagSet()
+	flags.Usage = func() { c.ui.Output(c.Help()) }
+	flags.IntVar(&c.depth, "depth", 0, "")
+	flags.BoolVar(&c.foldersOnly, "folders", false, "")
+	flags.BoolVar(&c.human, "human", false, "")
+
+	if err := c.parseFlags(flags, c.Name(), args); err != nil {
+		return 1
+	}
+
+	// Check that we got exactly one argument
+	args = flags.Args()
+	if len(args) != 1 {
+		c.ui.Error("This command takes one argument: <path>")
+		return 1
+	}
+
+	if c.depth < 0 {
+		c.ui.Error("-depth can't be negative")
+		return 1
+	}
+
+	p, err := c.bucketPath(args[0])
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+	bucketName, prefix := splitBucketAndPrefix(p)
+	prefix = syncPrefix(prefix)
+
+	client, err := c.Client()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	ctx := context.TODO()
+
+	bucket, err := client.Bucket.Lookup(ctx, bucketName)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	files, err := client.File.ListAll(ctx, &b2.FileListRequest{
+		BucketID: bucket.ID,
+		Prefix:   prefix,
+	})
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	root := newTreeNode(bucket.Name+"/"+prefix, treeFolder)
+	for _, file := range files {
+		if file.Action != "upload" {
+			continue
+		}
+		root.add(strings.TrimPrefix(file.FileName, prefix), int64(file.ContentLength), c.depth, c.foldersOnly)
+	}
+	root.sort()
+
+	out := c.newPrinter(false)
+	out.print(c.format(root), root)
+	if err := out.flush(); err != nil {
+		c.ui.Error(fmt.Sprintf("Error: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// format returns the tree drawn with lines, followed by the number of
+// folders and files.
+func (c *TreeCommand) format(root *treeNode) string {
+	lines := []string{c.label(root)}
+
+	folders := 0
+	var walk func(node *treeNode, indent string)
+	walk = func(node *treeNode, indent string) {
+		for i, child := range node.Children {
+			branch, next := "├── ", "│   "
+			if i == len(node.Children)-1 {
+				branch, next = "└── ", "    "
+			}
+			lines = append(lines, indent+branch+c.label(child))
+
+			if child.Type == treeFolder {
+				folders++
+				walk(child, indent+next)
+			}
+		}
+	}
+	walk(root, "")
+
+	lines = append(lines, "", fmt.Sprintf("%s, %s", plural(folders, "folder"), plural(root.Files, "file")))
+	return strings.Join(lines, "\n")
+}
+
+// label returns the name of the node along with its size and, for folders,
+// the number of files.
+func (c *TreeCommand) label(node *treeNode) string {
+	if node.Type == treeFolder {
+		return fmt.Sprintf("%s (%s in %s)", node.Name, formatSize(node.Size, c.human), plural(node.Files, "file"))
+	}
+	return fmt.Sprintf("%s (%s)", node.Name, formatSize(node.Size, c.human))
+}
+
+// plural returns the count followed by the noun, e.g. "1 file" or "2 files".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+const (
+	treeFolder = "folder"
+	treeFile   = "file"
+)
+
+// treeNode is a file or a folder in the tree.
+type treeNode struct {
+	// Name of the file or folder. Folder names end with a slash.
+	Name string `json:"name"`
+
+	// Either "folder" or "file".
+	Type string `json:"type"`
+
+	// Total size of the file, or of the files in the folder.
+	Size int64 `json:"size"`
+
+	// Number of files in the folder, including all subfolders.
+	Files int `json:"files,omitempty"`
+
+	// Files and folders in the folder, sorted by name.
+	Children []*treeNode `json:"children,omitempty"`
+
+	folders map[string]*treeNode
+}
+
+func newTreeNode(name, nodeType string) *treeNode {
+	return &treeNode{Name: name, Type: nodeType, folders: make(map[string]*treeNode)}
+}
+
+// add adds the file with the slash separated name relative to the folder,
+// creating folders up to the given depth. Files in deeper folders are only
+// counted in the deepest folder that is shown.
+func (n *treeNode) add(name string, size int64, depth int, foldersOnly bool) {
+	if depth == 0 {
+		depth = math.MaxInt32
+	}
+
+	folders, ok := fileFolders(name, depth)
+	if !ok {
+		return
+	}
+
+	node := n
+	node.Size += size
+	node.Files++
+
+	for _, folder := range folders {
+		child, ok := node.folders[folder]
+		if !ok {
+			child = newTreeNode(path.Base(folder)+"/", treeFolder)
+			node.folders[folder] = child
+			node.Children = append(node.Children, child)
+		}
+
+		node = child
+		node.Size += size
+		node.Files++
+	}
+
+	// Files that are depth or more folders deep are hidden, in which case
+	// their folders were cut off at the depth.
+	if foldersOnly || len(folders) == depth {
+		return
+	}
+	node.Children = append(node.Children, &treeNode{Name: path.Base(name), Type: treeFile, Size: size})
+}
+
+// sort sorts the children of the folder and all subfolders by name.
+func (n *treeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, child := range n.Children {
+		child.sort()
+	}
+}
@@ -0,0 +1,102 @@
+package command
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+)
+
+func TestTreeCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		out  string
+	}{
+		{
+			"all levels",
+			[]string{"my-bucket/photos"},
+			"my-bucket/photos/ (3510 in 3 files)\n" +
+				"├── 2020/ (500 in 1 file)\n" +
+				"│   └── dog.png (500)\n" +
+				"├── cat.jpg (3000)\n" +
+				"└── notes.txt (10)\n" +
+				"\n" +
+				"1 folder, 3 files\n",
+		},
+		{
+			"depth",
+			[]string{"-depth", "1", "-human", "my-bucket"},
+			"my-bucket/ (5.4K in 4 files)\n" +
+				"├── photos-old/ (2.0K in 1 file)\n" +
+				"└── photos/ (3.4K in 3 files)\n" +
+				"\n" +
+				"2 folders, 4 files\n",
+		},
+		{
+			"folders only",
+			[]string{"-folders", "my-bucket"},
+			"my-bucket/ (5510 in 4 files)\n" +
+				"├── photos-old/ (2000 in 1 file)\n" +
+				"└── photos/ (3510 in 3 files)\n" +
+				"    └── 2020/ (500 in 1 file)\n" +
+				"\n" +
+				"3 folders, 4 files\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &TreeCommand{
+				baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, newFindTestBucket())},
+			}
+
+			code := cmd.Run(tt.args)
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			assert.Equal(t, tt.out, ui.OutputWriter.String())
+		})
+	}
+}
+
+func TestTreeCommand_SkipsFolderMarkers(t *testing.T) {
+	bucket := newFindTestBucket()
+	bucket.add(b2.File{FileName: "photos/"})
+	bucket.add(b2.File{FileName: "photos/2020/"})
+
+	ui := cli.NewMockUi()
+	cmd := &TreeCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, bucket)},
+	}
+
+	code := cmd.Run([]string{"my-bucket/photos"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, "my-bucket/photos/ (3510 in 3 files)\n"+
+		"├── 2020/ (500 in 1 file)\n"+
+		"│   └── dog.png (500)\n"+
+		"├── cat.jpg (3000)\n"+
+		"└── notes.txt (10)\n"+
+		"\n"+
+		"1 folder, 3 files\n", ui.OutputWriter.String())
+}
+
+func TestTreeCommand_JSON(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &TreeCommand{
+		baseCommand: &baseCommand{ui: ui, client: newTestBucketServer(t, newFindTestBucket())},
+	}
+
+	code := cmd.Run([]string{"-format", "json", "my-bucket/photos/"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	var root treeNode
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &root))
+	assert.Equal(t, "my-bucket/photos/", root.Name)
+	assert.Equal(t, 3, root.Files)
+	require.Len(t, root.Children, 3)
+	assert.Equal(t, &treeNode{Name: "dog.png", Type: "file", Size: 500}, root.Children[0].Children[0])
+}
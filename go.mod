@@ -11,4 +11,6 @@ require (
 	github.com/stretchr/testify v1.6.1
 	github.com/vbauerster/mpb/v8 v8.6.1
 	golang.org/x/sync v0.4.0
+	golang.org/x/sys v0.11.0
+	golang.org/x/term v0.10.0
 )
@@ -0,0 +1,515 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	emulatorAccountID = "emulator-account"
+
+	// authorizationTTL is how long account authorization tokens are valid.
+	authorizationTTL = 24 * time.Hour
+
+	// maxBuckets is the number of buckets an account can have.
+	maxBuckets = 100
+)
+
+// Emulator is a stateful, in-memory fake of the B2 API. It keeps buckets,
+// all versions of the files in them and unfinished large files along with
+// their parts, checks SHA1 checksums of uploads and answers with the same
+// status and error codes as B2.
+//
+// An Emulator is an http.Handler, so it can be served by NewEmulatorServer
+// in tests, or by an http.Server on its own. The API and download URLs it
+// hands out point back at the host the request was sent to.
+type Emulator struct {
+	// Key accepted by b2_authorize_account.
+	KeyID     string
+	KeySecret string
+
+	// Part sizes returned by b2_authorize_account. All parts of a large
+	// file except for the last one must be at least
+	// AbsoluteMinimumPartSize.
+	RecommendedPartSize     int64
+	AbsoluteMinimumPartSize int64
+
+	// Now returns the time used for upload timestamps and for expiring
+	// tokens.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	nextID int
+
+	buckets map[string]*emulatorBucket
+
+	// All file versions and unfinished large files by ID.
+	files map[string]*emulatorFile
+
+	// Expiry times of account authorization tokens.
+	tokens map[string]time.Time
+
+	// Bucket or large file ID each upload token is valid for.
+	uploadTokens map[string]string
+
+	downloadTokens map[string]*downloadToken
+}
+
+// NewEmulator returns an emulator without any buckets that accepts the key
+// "emulator-key-id" with the secret "emulator-key-secret".
+func NewEmulator() *Emulator {
+	return &Emulator{
+		KeyID:                   "emulator-key-id",
+		KeySecret:               "emulator-key-secret",
+		RecommendedPartSize:     100000000,
+		AbsoluteMinimumPartSize: 5000000,
+		Now:                     time.Now,
+		buckets:                 make(map[string]*emulatorBucket),
+		files:                   make(map[string]*emulatorFile),
+		tokens:                  make(map[string]time.Time),
+		uploadTokens:            make(map[string]string),
+		downloadTokens:          make(map[string]*downloadToken),
+	}
+}
+
+// NewEmulatorServer starts a server backed by a new emulator. Clients are
+// pointed at it by using the URL of the server as their base URL.
+//
+// It is callers responsibility to call Close when finished, to shut it down
+func NewEmulatorServer() (*httptest.Server, *Emulator) {
+	emulator := NewEmulator()
+	return httptest.NewServer(emulator), emulator
+}
+
+// emulatorBucket is a bucket as returned by the API, along with its files.
+type emulatorBucket struct {
+	AccountID      string            `json:"accountId"`
+	ID             string            `json:"bucketId"`
+	Info           map[string]string `json:"bucketInfo"`
+	Name           string            `json:"bucketName"`
+	Type           string            `json:"bucketType"`
+	CorsRules      []interface{}     `json:"corsRules"`
+	LifecycleRules []interface{}     `json:"lifecycleRules"`
+	Revision       int               `json:"revision"`
+
+	// Versions sorted by name, and from the newest to the oldest.
+	versions []*emulatorFile
+}
+
+// emulatorFile is a file version, hide marker or unfinished large file as
+// returned by the API, along with its contents.
+type emulatorFile struct {
+	AccountID       string            `json:"accountId"`
+	Action          string            `json:"action"`
+	BucketID        string            `json:"bucketId"`
+	ContentLength   int64             `json:"contentLength"`
+	ContentSHA1     string            `json:"contentSha1"`
+	ContentType     string            `json:"contentType"`
+	FileID          string            `json:"fileId"`
+	FileInfo        map[string]string `json:"fileInfo"`
+	FileName        string            `json:"fileName"`
+	UploadTimestamp int64             `json:"uploadTimestamp"`
+
+	data []byte
+
+	// Parts uploaded so far, if this is an unfinished large file.
+	parts map[int64]*emulatorPart
+}
+
+// emulatorPart is a part of a large file.
+type emulatorPart struct {
+	FileID          string `json:"fileId"`
+	PartNumber      int64  `json:"partNumber"`
+	ContentLength   int64  `json:"contentLength"`
+	ContentSHA1     string `json:"contentSha1"`
+	UploadTimestamp int64  `json:"uploadTimestamp"`
+
+	data []byte
+}
+
+// downloadToken allows downloading the files in a bucket whose names start
+// with the prefix until it expires.
+type downloadToken struct {
+	bucketID  string
+	prefix    string
+	expiresAt time.Time
+}
+
+// apiError is an error response of the API.
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func newAPIError(status int, code, format string, args ...interface{}) *apiError {
+	return &apiError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func badRequest(format string, args ...interface{}) *apiError {
+	return newAPIError(http.StatusBadRequest, "bad_request", format, args...)
+}
+
+// writeJSON writes the value as a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error as a JSON error response. Errors other than
+// API errors are reported as internal errors.
+func writeError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		apiErr = newAPIError(http.StatusInternalServerError, "internal_error", "%v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(apiErr)
+}
+
+// apiCall handles a JSON API call and returns the response.
+type apiCall func(r *http.Request) (interface{}, error)
+
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const apiPrefix = "/b2api/v2/"
+
+	switch p := r.URL.Path; {
+	case p == apiPrefix+"b2_authorize_account":
+		e.authorizeAccount(w, r)
+		return
+	case strings.HasPrefix(p, apiPrefix+"b2_upload_file/"):
+		e.uploadFile(w, r, strings.TrimPrefix(p, apiPrefix+"b2_upload_file/"))
+		return
+	case strings.HasPrefix(p, apiPrefix+"b2_upload_part/"):
+		e.uploadPart(w, r, strings.TrimPrefix(p, apiPrefix+"b2_upload_part/"))
+		return
+	case p == apiPrefix+"b2_download_file_by_id":
+		e.downloadFileByID(w, r)
+		return
+	case strings.HasPrefix(p, "/file/"):
+		e.downloadFileByName(w, r, strings.TrimPrefix(p, "/file/"))
+		return
+	}
+
+	calls := map[string]apiCall{
+		"b2_cancel_large_file":           e.cancelLargeFile,
+		"b2_copy_file":                   e.copyFile,
+		"b2_copy_part":                   e.copyPart,
+		"b2_create_bucket":               e.createBucket,
+		"b2_delete_bucket":               e.deleteBucket,
+		"b2_delete_file_version":         e.deleteFileVersion,
+		"b2_finish_large_file":           e.finishLargeFile,
+		"b2_get_download_authorization":  e.getDownloadAuthorization,
+		"b2_get_upload_part_url":         e.getUploadPartURL,
+		"b2_get_upload_url":              e.getUploadURL,
+		"b2_hide_file":                   e.hideFile,
+		"b2_list_buckets":                e.listBuckets,
+		"b2_list_file_names":             e.listFileNames,
+		"b2_list_file_versions":          e.listFileVersions,
+		"b2_list_parts":                  e.listParts,
+		"b2_list_unfinished_large_files": e.listUnfinishedLargeFiles,
+		"b2_start_large_file":            e.startLargeFile,
+	}
+
+	call, ok := calls[strings.TrimPrefix(r.URL.Path, apiPrefix)]
+	if !ok || !strings.HasPrefix(r.URL.Path, apiPrefix) {
+		writeError(w, newAPIError(http.StatusNotFound, "not_found", "unknown API call: %s", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, newAPIError(http.StatusMethodNotAllowed, "method_not_allowed", "only POST is supported, got %s", r.Method))
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkToken(r.Header.Get("Authorization")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp, err := call(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// decodeRequest decodes the JSON body of an API call.
+func decodeRequest(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("invalid JSON: %v", err)
+	}
+	return nil
+}
+
+// baseURL returns the URL the request was sent to, without a path.
+func baseURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// newID returns a new ID with the given prefix. IDs sort in the order they
+// were created in.
+func (e *Emulator) newID(prefix string) string {
+	e.nextID++
+	return fmt.Sprintf("%s_%012d", prefix, e.nextID)
+}
+
+// timestamp returns the current time in milliseconds since the epoch.
+func (e *Emulator) timestamp() int64 {
+	return e.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (e *Emulator) authorizeAccount(w http.ResponseWriter, r *http.Request) {
+	keyID, keySecret, ok := r.BasicAuth()
+	if !ok || keyID != e.KeyID || keySecret != e.KeySecret {
+		writeError(w, newAPIError(http.StatusUnauthorized, "unauthorized", "invalid application key"))
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	token := e.newID("emulator-token")
+	e.tokens[token] = e.Now().Add(authorizationTTL)
+
+	writeJSON(w, map[string]interface{}{
+		"absoluteMinimumPartSize": e.AbsoluteMinimumPartSize,
+		"accountId":               emulatorAccountID,
+		"allowed": map[string]interface{}{
+			"capabilities": []string{"listBuckets", "writeBuckets", "deleteBuckets", "listFiles", "readFiles", "shareFiles", "writeFiles", "deleteFiles"},
+			"bucketId":     nil,
+			"bucketName":   nil,
+			"namePrefix":   nil,
+		},
+		"apiUrl":              baseURL(r),
+		"authorizationToken":  token,
+		"downloadUrl":         baseURL(r),
+		"recommendedPartSize": e.RecommendedPartSize,
+	})
+}
+
+// checkToken checks that the account authorization token is valid.
+func (e *Emulator) checkToken(token string) error {
+	expiresAt, ok := e.tokens[token]
+	if !ok {
+		return newAPIError(http.StatusUnauthorized, "bad_auth_token", "invalid authorization token")
+	}
+	if !e.Now().Before(expiresAt) {
+		return newAPIError(http.StatusUnauthorized, "expired_auth_token", "authorization token has expired")
+	}
+	return nil
+}
+
+// CreateBucket creates a bucket of the given type, either "allPrivate" or
+// "allPublic", and returns its ID.
+func (e *Emulator) CreateBucket(name, bucketType string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	bucket, err := e.addBucket(name, bucketType)
+	if err != nil {
+		return "", err
+	}
+	return bucket.ID, nil
+}
+
+func (e *Emulator) addBucket(name, bucketType string) (*emulatorBucket, error) {
+	if err := validateBucketName(name); err != nil {
+		return nil, err
+	}
+	if bucketType != "allPrivate" && bucketType != "allPublic" {
+		return nil, badRequest("invalid bucket type: %q", bucketType)
+	}
+	if len(e.buckets) >= maxBuckets {
+		return nil, badRequest("at most %d buckets are allowed", maxBuckets)
+	}
+	for _, bucket := range e.buckets {
+		if bucket.Name == name {
+			return nil, newAPIError(http.StatusBadRequest, "duplicate_bucket_name", "bucket name is already in use")
+		}
+	}
+
+	bucket := &emulatorBucket{
+		AccountID:      emulatorAccountID,
+		ID:             e.newID("emulator-bucket"),
+		Info:           map[string]string{},
+		Name:           name,
+		Type:           bucketType,
+		CorsRules:      []interface{}{},
+		LifecycleRules: []interface{}{},
+		Revision:       1,
+	}
+	e.buckets[bucket.ID] = bucket
+	return bucket, nil
+}
+
+// validateBucketName checks the name against the rules of B2: 6 to 50
+// letters, digits and dashes, not starting with "b2-".
+func validateBucketName(name string) error {
+	if len(name) < 6 || len(name) > 50 {
+		return badRequest("bucket name must be 6 to 50 characters long: %q", name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return badRequest("bucket name may only contain letters, digits and \"-\": %q", name)
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(name), "b2-") {
+		return badRequest("bucket name may not start with \"b2-\": %q", name)
+	}
+	return nil
+}
+
+// bucket returns the bucket with the ID.
+func (e *Emulator) bucket(id string) (*emulatorBucket, error) {
+	bucket, ok := e.buckets[id]
+	if !ok {
+		return nil, newAPIError(http.StatusBadRequest, "bad_bucket_id", "invalid bucket id: %s", id)
+	}
+	return bucket, nil
+}
+
+// bucketByName returns the bucket with the name, or nil.
+func (e *Emulator) bucketByName(name string) *emulatorBucket {
+	for _, bucket := range e.buckets {
+		if bucket.Name == name {
+			return bucket
+		}
+	}
+	return nil
+}
+
+func (e *Emulator) checkAccountID(accountID string) error {
+	if accountID != emulatorAccountID {
+		return newAPIError(http.StatusUnauthorized, "unauthorized", "account ID does not match: %q", accountID)
+	}
+	return nil
+}
+
+func (e *Emulator) createBucket(r *http.Request) (interface{}, error) {
+	var req struct {
+		AccountID      string            `json:"accountId"`
+		BucketName     string            `json:"bucketName"`
+		BucketType     string            `json:"bucketType"`
+		BucketInfo     map[string]string `json:"bucketInfo"`
+		CorsRules      []interface{}     `json:"corsRules"`
+		LifecycleRules []interface{}     `json:"lifecycleRules"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if err := e.checkAccountID(req.AccountID); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.addBucket(req.BucketName, req.BucketType)
+	if err != nil {
+		return nil, err
+	}
+	if req.BucketInfo != nil {
+		bucket.Info = req.BucketInfo
+	}
+	if req.CorsRules != nil {
+		bucket.CorsRules = req.CorsRules
+	}
+	if req.LifecycleRules != nil {
+		bucket.LifecycleRules = req.LifecycleRules
+	}
+	return bucket, nil
+}
+
+func (e *Emulator) deleteBucket(r *http.Request) (interface{}, error) {
+	var req struct {
+		AccountID string `json:"accountId"`
+		BucketID  string `json:"bucketId"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if err := e.checkAccountID(req.AccountID); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+	if len(bucket.versions) > 0 {
+		return nil, newAPIError(http.StatusBadRequest, "cannot_delete_non_empty_bucket", "bucket %s is not empty", bucket.Name)
+	}
+
+	delete(e.buckets, bucket.ID)
+	return bucket, nil
+}
+
+func (e *Emulator) listBuckets(r *http.Request) (interface{}, error) {
+	var req struct {
+		AccountID   string          `json:"accountId"`
+		BucketID    string          `json:"bucketId"`
+		BucketName  string          `json:"bucketName"`
+		BucketTypes json.RawMessage `json:"bucketTypes"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if err := e.checkAccountID(req.AccountID); err != nil {
+		return nil, err
+	}
+
+	// Types are either a list or a single type
+	var types []string
+	if len(req.BucketTypes) > 0 {
+		if err := json.Unmarshal(req.BucketTypes, &types); err != nil {
+			var bucketType string
+			if err := json.Unmarshal(req.BucketTypes, &bucketType); err != nil {
+				return nil, badRequest("invalid bucketTypes: %s", req.BucketTypes)
+			}
+			types = []string{bucketType}
+		}
+	}
+
+	buckets := []*emulatorBucket{}
+	for _, bucket := range e.buckets {
+		if req.BucketID != "" && bucket.ID != req.BucketID {
+			continue
+		}
+		if req.BucketName != "" && bucket.Name != req.BucketName {
+			continue
+		}
+		if len(types) > 0 && !containsString(types, "all") && !containsString(types, bucket.Type) {
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+
+	return map[string]interface{}{"buckets": buckets}, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,634 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxFileNameLength is the maximum length of a file name in bytes.
+	maxFileNameLength = 1024
+
+	// maxFileInfoItems is the maximum number of file info items.
+	maxFileInfoItems = 10
+
+	// maxCopySize is the largest file b2_copy_file copies.
+	maxCopySize = 5 * 1000 * 1000 * 1000
+
+	// maxDownloadAuthorization is the longest time a download
+	// authorization is valid for.
+	maxDownloadAuthorization = 7 * 24 * time.Hour
+)
+
+// responseHeaders are the file info keys that B2 returns as HTTP headers
+// when a file is downloaded.
+var responseHeaders = map[string]string{
+	"b2-cache-control":       "Cache-Control",
+	"b2-content-disposition": "Content-Disposition",
+	"b2-content-encoding":    "Content-Encoding",
+	"b2-content-language":    "Content-Language",
+	"b2-expires":             "Expires",
+}
+
+// PutFile stores a new version of a file with the contents and returns its
+// ID. The content type is picked from the file name extension.
+func (e *Emulator) PutFile(bucketName, fileName string, data []byte) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	bucket := e.bucketByName(bucketName)
+	if bucket == nil {
+		return "", newAPIError(http.StatusBadRequest, "bad_bucket_id", "bucket %s does not exist", bucketName)
+	}
+	if err := validateFileName(fileName); err != nil {
+		return "", err
+	}
+
+	file := e.addVersion(bucket, &emulatorFile{
+		Action:      "upload",
+		ContentSHA1: sha1Hex(data),
+		ContentType: contentType("b2/x-auto", fileName),
+		FileInfo:    map[string]string{},
+		FileName:    fileName,
+		data:        data,
+	})
+	return file.FileID, nil
+}
+
+// FileData returns the contents of the latest version of a file, and
+// whether the file exists and isn't hidden.
+func (e *Emulator) FileData(bucketName, fileName string) ([]byte, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	bucket := e.bucketByName(bucketName)
+	if bucket == nil {
+		return nil, false
+	}
+	file := bucket.latest(fileName)
+	if file == nil {
+		return nil, false
+	}
+	return file.data, true
+}
+
+// addVersion adds the file as the newest version of its name.
+func (e *Emulator) addVersion(bucket *emulatorBucket, file *emulatorFile) *emulatorFile {
+	file.AccountID = emulatorAccountID
+	file.BucketID = bucket.ID
+	file.FileID = e.newID("emulator-file")
+	file.UploadTimestamp = e.timestamp()
+	if file.Action != "start" {
+		file.ContentLength = int64(len(file.data))
+	}
+
+	i := sort.Search(len(bucket.versions), func(i int) bool {
+		return bucket.versions[i].FileName >= file.FileName
+	})
+	bucket.versions = append(bucket.versions, nil)
+	copy(bucket.versions[i+1:], bucket.versions[i:])
+	bucket.versions[i] = file
+
+	e.files[file.FileID] = file
+	return file
+}
+
+// removeVersion removes a file version or unfinished large file.
+func (e *Emulator) removeVersion(file *emulatorFile) {
+	delete(e.files, file.FileID)
+
+	bucket, ok := e.buckets[file.BucketID]
+	if !ok {
+		return
+	}
+	for i, version := range bucket.versions {
+		if version == file {
+			bucket.versions = append(bucket.versions[:i], bucket.versions[i+1:]...)
+			return
+		}
+	}
+}
+
+// latest returns the latest version of the file if it is visible, or nil.
+func (b *emulatorBucket) latest(fileName string) *emulatorFile {
+	i := sort.Search(len(b.versions), func(i int) bool {
+		return b.versions[i].FileName >= fileName
+	})
+	for ; i < len(b.versions) && b.versions[i].FileName == fileName; i++ {
+		switch b.versions[i].Action {
+		case "start":
+			continue
+		case "upload":
+			return b.versions[i]
+		}
+		return nil
+	}
+	return nil
+}
+
+// validateFileName checks the name against the rules of B2.
+func validateFileName(name string) error {
+	switch {
+	case name == "":
+		return badRequest("file name is empty")
+	case len(name) > maxFileNameLength:
+		return badRequest("file name is longer than %d bytes", maxFileNameLength)
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.Contains(name, "//"):
+		return badRequest("file names may not start or end with \"/\" or contain \"//\": %q", name)
+	}
+	for _, r := range name {
+		if r < ' ' || r == 0x7f {
+			return badRequest("file name contains control characters: %q", name)
+		}
+	}
+	return nil
+}
+
+// validateFileInfo checks the number of file info items.
+func validateFileInfo(info map[string]string) error {
+	if len(info) > maxFileInfoItems {
+		return badRequest("too many file info items: %d, at most %d are allowed", len(info), maxFileInfoItems)
+	}
+	return nil
+}
+
+// contentType returns the content type to store. "b2/x-auto" picks it from
+// the file name extension.
+func contentType(requested, fileName string) string {
+	if requested != "b2/x-auto" && requested != "" {
+		return requested
+	}
+	if t, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(fileName))); err == nil {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func sha1Hex(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// maxCount returns the requested number of results, or the default if none
+// was requested.
+func maxCount(name string, requested, defaultCount, max int) (int, error) {
+	if requested == 0 {
+		return defaultCount, nil
+	}
+	if requested < 0 || requested > max {
+		return 0, badRequest("%s out of range: %d, must be between 1 and %d", name, requested, max)
+	}
+	return requested, nil
+}
+
+// foldFolders replaces the versions in folders below the prefix with a
+// single "folder" entry per folder.
+func foldFolders(files []*emulatorFile, prefix, delimiter string) []*emulatorFile {
+	if delimiter == "" {
+		return files
+	}
+
+	folded := []*emulatorFile{}
+	for _, file := range files {
+		i := strings.Index(strings.TrimPrefix(file.FileName, prefix), delimiter)
+		if i < 0 {
+			folded = append(folded, file)
+			continue
+		}
+		name := file.FileName[:len(prefix)+i+len(delimiter)]
+		if n := len(folded); n > 0 && folded[n-1].FileName == name {
+			continue
+		}
+		folded = append(folded, &emulatorFile{Action: "folder", FileName: name, FileInfo: map[string]string{}})
+	}
+	return folded
+}
+
+// fileListResponse is the response of listing files. The next file name
+// and ID are null on the last page.
+type fileListResponse struct {
+	Files        []*emulatorFile `json:"files"`
+	NextFileName *string         `json:"nextFileName"`
+	NextFileID   *string         `json:"nextFileId"`
+}
+
+func (e *Emulator) listFileNames(r *http.Request) (interface{}, error) {
+	var req struct {
+		BucketID      string `json:"bucketId"`
+		StartFileName string `json:"startFileName"`
+		MaxFileCount  int    `json:"maxFileCount"`
+		Prefix        string `json:"prefix"`
+		Delimiter     string `json:"delimiter"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxCount("maxFileCount", req.MaxFileCount, 100, 10000)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*emulatorFile
+	for i, file := range bucket.versions {
+		if !strings.HasPrefix(file.FileName, req.Prefix) {
+			continue
+		}
+		if i > 0 && bucket.versions[i-1].FileName == file.FileName {
+			continue
+		}
+		if latest := bucket.latest(file.FileName); latest != nil {
+			files = append(files, latest)
+		}
+	}
+	files = foldFolders(files, req.Prefix, req.Delimiter)
+
+	start := sort.Search(len(files), func(i int) bool {
+		return files[i].FileName >= req.StartFileName
+	})
+
+	resp := &fileListResponse{Files: files[start:]}
+	if len(resp.Files) > max {
+		resp.NextFileName = &resp.Files[max].FileName
+		resp.Files = resp.Files[:max]
+	}
+	return resp, nil
+}
+
+func (e *Emulator) listFileVersions(r *http.Request) (interface{}, error) {
+	var req struct {
+		BucketID      string `json:"bucketId"`
+		StartFileName string `json:"startFileName"`
+		StartFileID   string `json:"startFileId"`
+		MaxFileCount  int    `json:"maxFileCount"`
+		Prefix        string `json:"prefix"`
+		Delimiter     string `json:"delimiter"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxCount("maxFileCount", req.MaxFileCount, 100, 10000)
+	if err != nil {
+		return nil, err
+	}
+	if req.StartFileID != "" && req.StartFileName == "" {
+		return nil, badRequest("startFileId requires startFileName")
+	}
+
+	var files []*emulatorFile
+	for _, file := range bucket.versions {
+		if strings.HasPrefix(file.FileName, req.Prefix) {
+			files = append(files, file)
+		}
+	}
+	files = foldFolders(files, req.Prefix, req.Delimiter)
+
+	start := sort.Search(len(files), func(i int) bool {
+		return files[i].FileName >= req.StartFileName
+	})
+	if req.StartFileID != "" {
+		for i := start; i < len(files) && files[i].FileName == req.StartFileName; i++ {
+			if files[i].FileID == req.StartFileID {
+				start = i
+				break
+			}
+		}
+	}
+
+	resp := &fileListResponse{Files: files[start:]}
+	if len(resp.Files) > max {
+		next := resp.Files[max]
+		resp.NextFileName = &next.FileName
+		if next.FileID != "" {
+			resp.NextFileID = &next.FileID
+		}
+		resp.Files = resp.Files[:max]
+	}
+	return resp, nil
+}
+
+func (e *Emulator) hideFile(r *http.Request) (interface{}, error) {
+	var req struct {
+		BucketID string `json:"bucketId"`
+		FileName string `json:"fileName"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+	if bucket.latest(req.FileName) == nil {
+		return nil, newAPIError(http.StatusBadRequest, "file_not_present", "file not present: %s", req.FileName)
+	}
+
+	return e.addVersion(bucket, &emulatorFile{
+		Action:      "hide",
+		ContentSHA1: "none",
+		ContentType: "application/x-bz-hide-marker",
+		FileInfo:    map[string]string{},
+		FileName:    req.FileName,
+	}), nil
+}
+
+func (e *Emulator) deleteFileVersion(r *http.Request) (interface{}, error) {
+	var req struct {
+		FileName string `json:"fileName"`
+		FileID   string `json:"fileId"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	file, ok := e.files[req.FileID]
+	if !ok || file.FileName != req.FileName {
+		return nil, newAPIError(http.StatusBadRequest, "file_not_present", "file not present: %s %s", req.FileName, req.FileID)
+	}
+
+	e.removeVersion(file)
+	return map[string]string{"fileId": file.FileID, "fileName": file.FileName}, nil
+}
+
+// parseRange parses a byte range like "bytes=100-199" of a file of the
+// given size and returns the start and end offsets, the end exclusive.
+func parseRange(byteRange string, size int64) (int64, int64, error) {
+	if byteRange == "" {
+		return 0, size, nil
+	}
+
+	spec := strings.TrimPrefix(byteRange, "bytes=")
+	dash := strings.Index(spec, "-")
+	if spec == byteRange || dash < 0 {
+		return 0, 0, badRequest("invalid range: %q", byteRange)
+	}
+
+	start, err := strconv.ParseInt(spec[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, badRequest("invalid range: %q", byteRange)
+	}
+	end, err := strconv.ParseInt(spec[dash+1:], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, badRequest("invalid range: %q", byteRange)
+	}
+	if end >= size {
+		return 0, 0, newAPIError(http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable", "range %q is outside of the file of %d bytes", byteRange, size)
+	}
+	return start, end + 1, nil
+}
+
+// copySource returns the file version to copy from.
+func (e *Emulator) copySource(id string) (*emulatorFile, error) {
+	file, ok := e.files[id]
+	if !ok || file.Action != "upload" {
+		return nil, newAPIError(http.StatusBadRequest, "file_not_present", "file not present: %s", id)
+	}
+	return file, nil
+}
+
+func (e *Emulator) copyFile(r *http.Request) (interface{}, error) {
+	var req struct {
+		SourceFileID        string            `json:"sourceFileId"`
+		DestinationBucketID string            `json:"destinationBucketId"`
+		FileName            string            `json:"fileName"`
+		Range               string            `json:"range"`
+		MetadataDirective   string            `json:"metadataDirective"`
+		ContentType         string            `json:"contentType"`
+		FileInfo            map[string]string `json:"fileInfo"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	source, err := e.copySource(req.SourceFileID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFileName(req.FileName); err != nil {
+		return nil, err
+	}
+
+	destinationID := req.DestinationBucketID
+	if destinationID == "" {
+		destinationID = source.BucketID
+	}
+	bucket, err := e.bucket(destinationID)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := parseRange(req.Range, source.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	if end-start > maxCopySize {
+		return nil, badRequest("copy source too big: %d bytes, at most %d can be copied", end-start, maxCopySize)
+	}
+
+	copied := &emulatorFile{
+		Action:      "upload",
+		ContentType: source.ContentType,
+		FileInfo:    source.FileInfo,
+		FileName:    req.FileName,
+		data:        source.data[start:end],
+	}
+
+	switch req.MetadataDirective {
+	case "", "COPY":
+		if req.ContentType != "" || req.FileInfo != nil {
+			return nil, badRequest("contentType and fileInfo can only be set with metadataDirective REPLACE")
+		}
+	case "REPLACE":
+		if req.ContentType == "" {
+			return nil, badRequest("contentType is required with metadataDirective REPLACE")
+		}
+		if err := validateFileInfo(req.FileInfo); err != nil {
+			return nil, err
+		}
+		copied.ContentType = contentType(req.ContentType, req.FileName)
+		copied.FileInfo = req.FileInfo
+		if copied.FileInfo == nil {
+			copied.FileInfo = map[string]string{}
+		}
+	default:
+		return nil, badRequest("invalid metadataDirective: %q", req.MetadataDirective)
+	}
+
+	// Copies of whole large files keep the checksum in the file info
+	copied.ContentSHA1 = sha1Hex(copied.data)
+	if source.ContentSHA1 == "none" && start == 0 && end == source.ContentLength {
+		copied.ContentSHA1 = "none"
+	}
+
+	return e.addVersion(bucket, copied), nil
+}
+
+func (e *Emulator) getDownloadAuthorization(r *http.Request) (interface{}, error) {
+	var req struct {
+		BucketID               string `json:"bucketId"`
+		FileNamePrefix         string `json:"fileNamePrefix"`
+		ValidDurationInSeconds int64  `json:"validDurationInSeconds"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := time.Duration(req.ValidDurationInSeconds) * time.Second
+	if valid < time.Second || valid > maxDownloadAuthorization {
+		return nil, badRequest("validDurationInSeconds must be between 1 and %d", int64(maxDownloadAuthorization/time.Second))
+	}
+
+	token := e.newID("emulator-download-token")
+	e.downloadTokens[token] = &downloadToken{
+		bucketID:  bucket.ID,
+		prefix:    req.FileNamePrefix,
+		expiresAt: e.Now().Add(valid),
+	}
+
+	return map[string]string{
+		"bucketId":           bucket.ID,
+		"fileNamePrefix":     req.FileNamePrefix,
+		"authorizationToken": token,
+	}, nil
+}
+
+// checkDownload checks that the file may be downloaded with the token from
+// the Authorization header or query parameter. Files in public buckets can
+// be downloaded without a token.
+func (e *Emulator) checkDownload(r *http.Request, bucket *emulatorBucket, fileName string, byName bool) error {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.URL.Query().Get("Authorization")
+	}
+
+	if token == "" && bucket.Type == "allPublic" {
+		return nil
+	}
+
+	if _, ok := e.tokens[token]; ok {
+		return e.checkToken(token)
+	}
+
+	download, ok := e.downloadTokens[token]
+	if !ok || !byName {
+		if token == "" {
+			return newAPIError(http.StatusUnauthorized, "unauthorized", "an authorization token is required to download from private buckets")
+		}
+		return newAPIError(http.StatusUnauthorized, "bad_auth_token", "invalid authorization token")
+	}
+	if !e.Now().Before(download.expiresAt) {
+		return newAPIError(http.StatusUnauthorized, "expired_auth_token", "authorization token has expired")
+	}
+	if download.bucketID != bucket.ID || !strings.HasPrefix(fileName, download.prefix) {
+		return newAPIError(http.StatusUnauthorized, "unauthorized", "authorization token does not allow downloading %s", fileName)
+	}
+	return nil
+}
+
+func (e *Emulator) downloadFileByName(w http.ResponseWriter, r *http.Request, p string) {
+	file, err := func() (*emulatorFile, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		parts := strings.SplitN(p, "/", 2)
+		bucket := e.bucketByName(parts[0])
+		if bucket == nil || len(parts) < 2 {
+			return nil, newAPIError(http.StatusNotFound, "not_found", "bucket %s does not exist", parts[0])
+		}
+		if err := e.checkDownload(r, bucket, parts[1], true); err != nil {
+			return nil, err
+		}
+
+		file := bucket.latest(parts[1])
+		if file == nil {
+			return nil, newAPIError(http.StatusNotFound, "not_found", "file with such name does not exist: %s", parts[1])
+		}
+		return file, nil
+	}()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	serveFile(w, r, file)
+}
+
+func (e *Emulator) downloadFileByID(w http.ResponseWriter, r *http.Request) {
+	file, err := func() (*emulatorFile, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		id := r.URL.Query().Get("fileId")
+		file, ok := e.files[id]
+		if !ok || file.Action != "upload" {
+			return nil, newAPIError(http.StatusNotFound, "not_found", "file not present: %s", id)
+		}
+		if err := e.checkDownload(r, e.buckets[file.BucketID], file.FileName, false); err != nil {
+			return nil, err
+		}
+		return file, nil
+	}()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	serveFile(w, r, file)
+}
+
+// serveFile writes the contents of the file along with the headers B2 sends
+// with downloads. Range requests are supported.
+func serveFile(w http.ResponseWriter, r *http.Request, file *emulatorFile) {
+	h := w.Header()
+	h.Set("Content-Type", file.ContentType)
+	h.Set("X-Bz-File-Id", file.FileID)
+	h.Set("X-Bz-File-Name", url.QueryEscape(file.FileName))
+	h.Set("X-Bz-Content-Sha1", file.ContentSHA1)
+	h.Set("X-Bz-Upload-Timestamp", fmt.Sprint(file.UploadTimestamp))
+	for k, v := range file.FileInfo {
+		if header, ok := responseHeaders[k]; ok {
+			h.Set(header, v)
+			continue
+		}
+		h.Set("X-Bz-Info-"+k, url.QueryEscape(v))
+	}
+
+	// B2 reports ranges beyond the end of a file as errors in JSON
+	if byteRange := r.Header.Get("Range"); byteRange != "" && file.ContentLength == 0 {
+		writeError(w, newAPIError(http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable", "range %q is outside of the empty file", byteRange))
+		return
+	}
+
+	// B2 doesn't send ETag or Last-Modified, so conditions on them don't
+	// apply either
+	for _, k := range []string{"If-Match", "If-None-Match", "If-Range", "If-Modified-Since", "If-Unmodified-Since"} {
+		r.Header.Del(k)
+	}
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(file.data))
+}
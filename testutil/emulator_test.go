@@ -0,0 +1,283 @@
+package testutil_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+)
+
+func newEmulatorClient(t *testing.T) (*b2.Client, *testutil.Emulator) {
+	server, emulator := testutil.NewEmulatorServer()
+	t.Cleanup(server.Close)
+
+	cache, err := b2.NewInMemoryCache()
+	require.NoError(t, err)
+
+	client, err := b2.NewClient(emulator.KeyID, emulator.KeySecret, b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	return client, emulator
+}
+
+func sha1Hex(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func upload(t *testing.T, client *b2.Client, bucketID, name string, data []byte) *b2.File {
+	ctx := context.Background()
+
+	auth, _, err := client.File.UploadAuthorization(ctx, &b2.UploadAuthorizationRequest{BucketID: bucketID})
+	require.NoError(t, err)
+
+	file, _, err := client.File.Upload(ctx, &b2.UploadRequest{
+		Authorization: auth,
+		Body:          bytes.NewReader(data),
+		Key:           name,
+		ChecksumSHA1:  sha1Hex(data),
+		ContentLength: int64(len(data)),
+	})
+	require.NoError(t, err)
+	return file
+}
+
+func TestEmulator_Buckets(t *testing.T) {
+	client, _ := newEmulatorClient(t)
+	ctx := context.Background()
+
+	bucket, _, err := client.Bucket.Create(ctx, &b2.BucketCreateRequest{AccountID: client.AccountID, Name: "my-bucket", Type: "allPrivate"})
+	require.NoError(t, err)
+	assert.Equal(t, "my-bucket", bucket.Name)
+
+	_, _, err = client.Bucket.Create(ctx, &b2.BucketCreateRequest{AccountID: client.AccountID, Name: "my-bucket", Type: "allPrivate"})
+	assert.Contains(t, fmt.Sprint(err), "duplicate_bucket_name")
+
+	_, _, err = client.Bucket.Create(ctx, &b2.BucketCreateRequest{AccountID: client.AccountID, Name: "b2-bucket", Type: "allPrivate"})
+	assert.Contains(t, fmt.Sprint(err), "bad_request")
+
+	found, err := client.Bucket.Lookup(ctx, "my-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, bucket.ID, found.ID)
+
+	_, err = client.File.ListAll(ctx, &b2.FileListRequest{BucketID: "missing"})
+	assert.True(t, errors.Is(err, b2.ErrBadBucketID), "%v", err)
+}
+
+func TestEmulator_UploadAndDownload(t *testing.T) {
+	client, emulator := newEmulatorClient(t)
+	ctx := context.Background()
+
+	bucketID, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+
+	data := []byte("hello, world")
+	file := upload(t, client, bucketID, "docs/hello world.txt", data)
+	assert.Equal(t, "upload", file.Action)
+	assert.Equal(t, "text/plain", file.ContentType)
+	assert.Equal(t, len(data), file.ContentLength)
+	assert.Equal(t, sha1Hex(data), file.ContentSHA1)
+	assert.Contains(t, file.FileInfo, "src_last_modified_millis")
+
+	// The checksum has to match the data
+	auth, _, err := client.File.UploadAuthorization(ctx, &b2.UploadAuthorizationRequest{BucketID: bucketID})
+	require.NoError(t, err)
+	_, _, err = client.File.Upload(ctx, &b2.UploadRequest{
+		Authorization: auth,
+		Body:          bytes.NewReader(data),
+		Key:           "corrupt.txt",
+		ChecksumSHA1:  sha1Hex([]byte("something else")),
+		ContentLength: int64(len(data)),
+	})
+	assert.Contains(t, fmt.Sprint(err), "sha1 did not match")
+
+	url := client.DownloadURL + "/file/my-bucket/docs/hello%20world.txt"
+
+	var buf bytes.Buffer
+	resp, err := client.File.Download(ctx, url, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", buf.String())
+	assert.Equal(t, file.FileID, b2.FileFromHeader(resp.Header).FileID)
+	assert.Equal(t, "docs/hello world.txt", b2.FileFromHeader(resp.Header).FileName)
+
+	buf.Reset()
+	_, err = client.File.DownloadRange(ctx, url, "bytes=7-", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "world", buf.String())
+
+	_, err = client.File.DownloadRange(ctx, url, "bytes=100-", &buf)
+	assert.True(t, errors.Is(err, b2.ErrRangeNotSatisfiable), "%v", err)
+
+	// Private buckets need a token
+	resp, err = http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	share, err := client.File.DownloadAuthorization(ctx, &b2.DownloadAuthorizationRequest{BucketID: bucketID, FileNamePrefix: "docs/", ValidDurationInSeconds: 60})
+	require.NoError(t, err)
+
+	resp, err = http.Get(url + "?Authorization=" + share.Token)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello, world", string(body))
+}
+
+func TestEmulator_LargeFile(t *testing.T) {
+	client, emulator := newEmulatorClient(t)
+	emulator.AbsoluteMinimumPartSize = 5
+	ctx := context.Background()
+
+	bucketID, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+
+	file, err := client.File.StartLargeFile(ctx, &b2.StartLargeFileRequest{BucketID: bucketID, Filename: "large.bin"})
+	require.NoError(t, err)
+	assert.Equal(t, "start", file.Action)
+
+	unfinished, err := client.File.ListAllUnfinished(ctx, &b2.UnfinishedLargeFileListRequest{BucketID: bucketID})
+	require.NoError(t, err)
+	require.Len(t, unfinished, 1)
+	assert.Equal(t, file.FileID, unfinished[0].FileID)
+
+	auth, err := client.File.UploadPartAuthorization(ctx, &b2.UploadPartAuthorizationRequest{FileID: file.FileID})
+	require.NoError(t, err)
+
+	parts := [][]byte{[]byte("first"), []byte("second"), []byte("3")}
+	var checksums []string
+	for i, data := range parts {
+		_, err := client.File.UploadPart(ctx, &b2.UploadPartRequest{
+			Authorization: auth,
+			PartNumber:    int64(i + 1),
+			Body:          bytes.NewReader(data),
+			ChecksumSHA1:  sha1Hex(data),
+			ContentLength: int64(len(data)),
+		})
+		require.NoError(t, err)
+		checksums = append(checksums, sha1Hex(data))
+	}
+
+	uploaded, err := client.File.ListAllParts(ctx, &b2.PartListRequest{FileID: file.FileID, MaxPartCount: 2})
+	require.NoError(t, err)
+	require.Len(t, uploaded, 3)
+	assert.Equal(t, int64(6), uploaded[1].ContentLength)
+
+	_, err = client.File.FinishLargeFile(ctx, &b2.FinishLargeFileRequest{FileID: file.FileID, PartSHA1: checksums[:2]})
+	assert.Contains(t, fmt.Sprint(err), "3 parts were uploaded")
+
+	finished, err := client.File.FinishLargeFile(ctx, &b2.FinishLargeFileRequest{FileID: file.FileID, PartSHA1: checksums})
+	require.NoError(t, err)
+	assert.Equal(t, "upload", finished.Action)
+	assert.Equal(t, 12, finished.ContentLength)
+
+	data, ok := emulator.FileData("my-bucket", "large.bin")
+	require.True(t, ok)
+	assert.Equal(t, "firstsecond3", string(data))
+
+	// Parts other than the last one have to be large enough
+	emulator.AbsoluteMinimumPartSize = 6
+	file, err = client.File.StartLargeFile(ctx, &b2.StartLargeFileRequest{BucketID: bucketID, Filename: "small-parts.bin"})
+	require.NoError(t, err)
+	source, err := emulator.PutFile("my-bucket", "source.bin", []byte("0123456789"))
+	require.NoError(t, err)
+	for i, r := range []string{"bytes=0-4", "bytes=5-9"} {
+		_, err := client.File.CopyPart(ctx, &b2.CopyPartRequest{SourceFileID: source, LargeFileID: file.FileID, PartNumber: int64(i + 1), Range: r})
+		require.NoError(t, err)
+	}
+	_, err = client.File.FinishLargeFile(ctx, &b2.FinishLargeFileRequest{FileID: file.FileID, PartSHA1: []string{sha1Hex([]byte("01234")), sha1Hex([]byte("56789"))}})
+	assert.Contains(t, fmt.Sprint(err), "smaller than the minimum part size")
+
+	_, err = client.File.CancelLargeFile(ctx, &b2.CancelLargeFileRequest{FileID: file.FileID})
+	require.NoError(t, err)
+
+	unfinished, err = client.File.ListAllUnfinished(ctx, &b2.UnfinishedLargeFileListRequest{BucketID: bucketID})
+	require.NoError(t, err)
+	assert.Empty(t, unfinished)
+}
+
+func TestEmulator_Listings(t *testing.T) {
+	client, emulator := newEmulatorClient(t)
+	ctx := context.Background()
+
+	bucketID, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+
+	for _, name := range []string{"a.txt", "b.txt", "photos/cat.jpg", "photos/dog.jpg", "z.txt", "b.txt"} {
+		_, err := emulator.PutFile("my-bucket", name, []byte(name))
+		require.NoError(t, err)
+	}
+	_, err = client.File.Hide(ctx, &b2.HideFileRequest{BucketID: bucketID, FileName: "z.txt"})
+	require.NoError(t, err)
+
+	names := func(files []b2.File) []string {
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Action+" "+file.FileName)
+		}
+		return names
+	}
+
+	files, err := client.File.ListAll(ctx, &b2.FileListRequest{BucketID: bucketID, MaxFileCount: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upload a.txt", "upload b.txt", "upload photos/cat.jpg", "upload photos/dog.jpg"}, names(files))
+
+	files, err = client.File.ListAll(ctx, &b2.FileListRequest{BucketID: bucketID, Delimiter: "/", MaxFileCount: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upload a.txt", "upload b.txt", "folder photos/"}, names(files))
+
+	versions, err := client.File.ListAllVersions(ctx, &b2.FileVersionListRequest{BucketID: bucketID, MaxFileCount: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upload a.txt", "upload b.txt", "upload b.txt", "upload photos/cat.jpg", "upload photos/dog.jpg", "hide z.txt", "upload z.txt"}, names(versions))
+	assert.True(t, versions[1].UploadTimestamp >= versions[2].UploadTimestamp)
+
+	// Deleting the newest version makes the older one current again
+	_, err = client.File.DeleteVersion(ctx, &b2.DeleteFileVersionRequest{FileName: "z.txt", FileID: versions[5].FileID})
+	require.NoError(t, err)
+	_, err = client.File.DeleteVersion(ctx, &b2.DeleteFileVersionRequest{FileName: "z.txt", FileID: versions[5].FileID})
+	assert.Contains(t, fmt.Sprint(err), "file_not_present")
+
+	copied, err := client.File.Copy(ctx, &b2.CopyFileRequest{SourceFileID: versions[6].FileID, FileName: "photos/z.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, versions[6].ContentSHA1, copied.ContentSHA1)
+
+	files, err = client.File.ListAll(ctx, &b2.FileListRequest{BucketID: bucketID, Prefix: "photos/"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upload photos/cat.jpg", "upload photos/dog.jpg", "upload photos/z.txt"}, names(files))
+
+	_, _, err = client.File.List(ctx, &b2.FileListRequest{BucketID: bucketID, MaxFileCount: 10001})
+	assert.Contains(t, fmt.Sprint(err), "maxFileCount out of range")
+}
+
+func TestEmulator_Authorization(t *testing.T) {
+	server, emulator := testutil.NewEmulatorServer()
+	defer server.Close()
+
+	cache, err := b2.NewInMemoryCache()
+	require.NoError(t, err)
+
+	_, err = b2.NewClient(emulator.KeyID, "wrong", b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	assert.Contains(t, fmt.Sprint(err), b2.ErrUnauthorized.Error())
+
+	client, err := b2.NewClient(emulator.KeyID, emulator.KeySecret, b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	// Tokens expire after a day
+	emulator.Now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+
+	_, _, err = client.Bucket.List(context.Background(), &b2.BucketListRequest{AccountID: client.AccountID})
+	assert.True(t, errors.Is(err, b2.ErrExpiredToken), "%v", err)
+}
@@ -0,0 +1,449 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxUploadSize is the largest file or part that can be uploaded at
+	// once.
+	maxUploadSize = 5 * 1000 * 1000 * 1000
+
+	// maxParts is the maximum number of parts of a large file.
+	maxParts = 10000
+)
+
+// uploadAuthorization is the response of b2_get_upload_url and
+// b2_get_upload_part_url.
+type uploadAuthorization struct {
+	BucketID           string `json:"bucketId,omitempty"`
+	FileID             string `json:"fileId,omitempty"`
+	UploadURL          string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+func (e *Emulator) getUploadURL(r *http.Request) (interface{}, error) {
+	var req struct {
+		BucketID string `json:"bucketId"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	token := e.newID("emulator-upload-token")
+	e.uploadTokens[token] = bucket.ID
+
+	return &uploadAuthorization{
+		BucketID:           bucket.ID,
+		UploadURL:          baseURL(r) + "/b2api/v2/b2_upload_file/" + bucket.ID,
+		AuthorizationToken: token,
+	}, nil
+}
+
+func (e *Emulator) getUploadPartURL(r *http.Request) (interface{}, error) {
+	var req struct {
+		FileID string `json:"fileId"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	file, err := e.largeFile(req.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	token := e.newID("emulator-upload-token")
+	e.uploadTokens[token] = file.FileID
+
+	return &uploadAuthorization{
+		FileID:             file.FileID,
+		UploadURL:          baseURL(r) + "/b2api/v2/b2_upload_part/" + file.FileID,
+		AuthorizationToken: token,
+	}, nil
+}
+
+// readUpload reads the body of an upload and checks its length and SHA1
+// checksum, which may be "do_not_verify" to skip the check.
+func readUpload(r *http.Request) ([]byte, string, error) {
+	if r.ContentLength < 0 {
+		return nil, "", newAPIError(http.StatusLengthRequired, "bad_request", "Content-Length is required")
+	}
+	if r.ContentLength > maxUploadSize {
+		return nil, "", badRequest("content is too large: %d bytes, at most %d can be uploaded at once", r.ContentLength, maxUploadSize)
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", badRequest("reading content: %v", err)
+	}
+
+	checksum := r.Header.Get("X-Bz-Content-Sha1")
+	switch checksum {
+	case "":
+		return nil, "", badRequest("X-Bz-Content-Sha1 is required")
+	case "do_not_verify":
+		return data, "none", nil
+	}
+	if !strings.EqualFold(checksum, sha1Hex(data)) {
+		return nil, "", badRequest("sha1 did not match data received")
+	}
+	return data, sha1Hex(data), nil
+}
+
+// checkUploadToken checks that the upload token is valid for the bucket or
+// large file.
+func (e *Emulator) checkUploadToken(r *http.Request, id string) error {
+	if e.uploadTokens[r.Header.Get("Authorization")] != id {
+		return newAPIError(http.StatusUnauthorized, "bad_auth_token", "invalid upload authorization token")
+	}
+	return nil
+}
+
+func (e *Emulator) uploadFile(w http.ResponseWriter, r *http.Request, bucketID string) {
+	data, checksum, err := readUpload(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	file, err := func() (*emulatorFile, error) {
+		if err := e.checkUploadToken(r, bucketID); err != nil {
+			return nil, err
+		}
+		bucket, err := e.bucket(bucketID)
+		if err != nil {
+			return nil, err
+		}
+
+		fileName, err := url.QueryUnescape(r.Header.Get("X-Bz-File-Name"))
+		if err != nil {
+			return nil, badRequest("invalid X-Bz-File-Name: %v", err)
+		}
+		if err := validateFileName(fileName); err != nil {
+			return nil, err
+		}
+
+		info := make(map[string]string)
+		for k := range r.Header {
+			if !strings.HasPrefix(k, "X-Bz-Info-") {
+				continue
+			}
+			v, err := url.QueryUnescape(r.Header.Get(k))
+			if err != nil {
+				return nil, badRequest("invalid %s: %v", k, err)
+			}
+			info[strings.ToLower(strings.TrimPrefix(k, "X-Bz-Info-"))] = v
+		}
+		if err := validateFileInfo(info); err != nil {
+			return nil, err
+		}
+
+		return e.addVersion(bucket, &emulatorFile{
+			Action:      "upload",
+			ContentSHA1: checksum,
+			ContentType: contentType(r.Header.Get("Content-Type"), fileName),
+			FileInfo:    info,
+			FileName:    fileName,
+			data:        data,
+		}), nil
+	}()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, file)
+}
+
+func (e *Emulator) startLargeFile(r *http.Request) (interface{}, error) {
+	var req struct {
+		BucketID    string            `json:"bucketId"`
+		FileName    string            `json:"fileName"`
+		ContentType string            `json:"contentType"`
+		FileInfo    map[string]string `json:"fileInfo"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFileName(req.FileName); err != nil {
+		return nil, err
+	}
+	if req.ContentType == "" {
+		return nil, badRequest("contentType is required")
+	}
+	if err := validateFileInfo(req.FileInfo); err != nil {
+		return nil, err
+	}
+	if req.FileInfo == nil {
+		req.FileInfo = map[string]string{}
+	}
+
+	return e.addVersion(bucket, &emulatorFile{
+		Action:      "start",
+		ContentSHA1: "none",
+		ContentType: contentType(req.ContentType, req.FileName),
+		FileInfo:    req.FileInfo,
+		FileName:    req.FileName,
+		parts:       make(map[int64]*emulatorPart),
+	}), nil
+}
+
+// largeFile returns the unfinished large file with the ID.
+func (e *Emulator) largeFile(id string) (*emulatorFile, error) {
+	file, ok := e.files[id]
+	if !ok || file.Action != "start" {
+		return nil, badRequest("no active upload for: %s", id)
+	}
+	return file, nil
+}
+
+// addPart stores the part of the large file, replacing an earlier upload of
+// the same part.
+func (e *Emulator) addPart(file *emulatorFile, number int64, data []byte, checksum string) (*emulatorPart, error) {
+	if number < 1 || number > maxParts {
+		return nil, badRequest("part number must be between 1 and %d: %d", maxParts, number)
+	}
+
+	part := &emulatorPart{
+		FileID:          file.FileID,
+		PartNumber:      number,
+		ContentLength:   int64(len(data)),
+		ContentSHA1:     checksum,
+		UploadTimestamp: e.timestamp(),
+		data:            data,
+	}
+	file.parts[number] = part
+	return part, nil
+}
+
+func (e *Emulator) uploadPart(w http.ResponseWriter, r *http.Request, fileID string) {
+	data, checksum, err := readUpload(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if checksum == "none" {
+		checksum = sha1Hex(data)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	part, err := func() (*emulatorPart, error) {
+		if err := e.checkUploadToken(r, fileID); err != nil {
+			return nil, err
+		}
+		file, err := e.largeFile(fileID)
+		if err != nil {
+			return nil, err
+		}
+
+		number, err := strconv.ParseInt(r.Header.Get("X-Bz-Part-Number"), 10, 64)
+		if err != nil {
+			return nil, badRequest("invalid X-Bz-Part-Number: %q", r.Header.Get("X-Bz-Part-Number"))
+		}
+		return e.addPart(file, number, data, checksum)
+	}()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, part)
+}
+
+func (e *Emulator) copyPart(r *http.Request) (interface{}, error) {
+	var req struct {
+		SourceFileID string `json:"sourceFileId"`
+		LargeFileID  string `json:"largeFileId"`
+		PartNumber   int64  `json:"partNumber"`
+		Range        string `json:"range"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	source, err := e.copySource(req.SourceFileID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := e.largeFile(req.LargeFileID)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := parseRange(req.Range, source.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	if end-start > maxUploadSize {
+		return nil, badRequest("part is too large: %d bytes, at most %d are allowed", end-start, maxUploadSize)
+	}
+
+	data := source.data[start:end]
+	return e.addPart(file, req.PartNumber, data, sha1Hex(data))
+}
+
+func (e *Emulator) finishLargeFile(r *http.Request) (interface{}, error) {
+	var req struct {
+		FileID   string   `json:"fileId"`
+		PartSHA1 []string `json:"partSha1Array"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	file, err := e.largeFile(req.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.PartSHA1) < 2 {
+		return nil, badRequest("large files must have at least 2 parts")
+	}
+	if len(req.PartSHA1) != len(file.parts) {
+		return nil, badRequest("%d parts were uploaded, but partSha1Array has %d", len(file.parts), len(req.PartSHA1))
+	}
+
+	var data []byte
+	for i, checksum := range req.PartSHA1 {
+		number := int64(i + 1)
+		part, ok := file.parts[number]
+		if !ok {
+			return nil, badRequest("part number %d has not been uploaded", number)
+		}
+		if !strings.EqualFold(part.ContentSHA1, checksum) {
+			return nil, badRequest("sha1 of part number %d does not match: %s", number, checksum)
+		}
+		if number < int64(len(req.PartSHA1)) && part.ContentLength < e.AbsoluteMinimumPartSize {
+			return nil, badRequest("part number %d is smaller than the minimum part size of %d bytes", number, e.AbsoluteMinimumPartSize)
+		}
+		data = append(data, part.data...)
+	}
+
+	file.Action = "upload"
+	file.ContentLength = int64(len(data))
+	file.data = data
+	file.parts = nil
+	return file, nil
+}
+
+func (e *Emulator) cancelLargeFile(r *http.Request) (interface{}, error) {
+	var req struct {
+		FileID string `json:"fileId"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	file, err := e.largeFile(req.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	e.removeVersion(file)
+	return map[string]string{
+		"accountId": file.AccountID,
+		"bucketId":  file.BucketID,
+		"fileId":    file.FileID,
+		"fileName":  file.FileName,
+	}, nil
+}
+
+func (e *Emulator) listUnfinishedLargeFiles(r *http.Request) (interface{}, error) {
+	var req struct {
+		BucketID     string `json:"bucketId"`
+		NamePrefix   string `json:"namePrefix"`
+		StartFileID  string `json:"startFileId"`
+		MaxFileCount int    `json:"maxFileCount"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	bucket, err := e.bucket(req.BucketID)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxCount("maxFileCount", req.MaxFileCount, 100, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unfinished large files are listed in the order they were started
+	files := []*emulatorFile{}
+	for _, file := range bucket.versions {
+		if file.Action == "start" && strings.HasPrefix(file.FileName, req.NamePrefix) && file.FileID >= req.StartFileID {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FileID < files[j].FileID
+	})
+
+	resp := &fileListResponse{Files: files}
+	if len(files) > max {
+		resp.NextFileID = &files[max].FileID
+		resp.Files = files[:max]
+	}
+	return resp, nil
+}
+
+func (e *Emulator) listParts(r *http.Request) (interface{}, error) {
+	var req struct {
+		FileID          string `json:"fileId"`
+		StartPartNumber int64  `json:"startPartNumber"`
+		MaxPartCount    int    `json:"maxPartCount"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		return nil, err
+	}
+
+	file, err := e.largeFile(req.FileID)
+	if err != nil {
+		return nil, err
+	}
+	max, err := maxCount("maxPartCount", req.MaxPartCount, 100, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []*emulatorPart{}
+	for number, part := range file.parts {
+		if number >= req.StartPartNumber {
+			parts = append(parts, part)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+
+	resp := struct {
+		Parts          []*emulatorPart `json:"parts"`
+		NextPartNumber *int64          `json:"nextPartNumber"`
+	}{Parts: parts}
+	if len(parts) > max {
+		resp.NextPartNumber = &parts[max].PartNumber
+		resp.Parts = parts[:max]
+	}
+	return resp, nil
+}
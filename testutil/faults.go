@@ -0,0 +1,313 @@
+package testutil
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slowBodyChunkSize is how many bytes of a slow body are written at once.
+const slowBodyChunkSize = 1024
+
+// defaultFaultCodes are the error codes B2 uses for the status codes.
+var defaultFaultCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "access_denied",
+	http.StatusNotFound:            "not_found",
+	http.StatusRequestTimeout:      "request_timeout",
+	http.StatusTooManyRequests:     "too_many_requests",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusServiceUnavailable:  "service_unavailable",
+}
+
+// Fault describes how requests to an endpoint misbehave. Endpoints are
+// named after the API call, e.g. "b2_list_file_names", with uploads named
+// "b2_upload_file" and "b2_upload_part", and downloads by name "download".
+//
+// A fault that answers the second listing with a 500:
+//
+//	Fault{Endpoint: "b2_list_file_names", Nth: 2, Status: 500}
+//
+// A fault that drops the connection after receiving 1000 bytes of every
+// upload:
+//
+//	Fault{Endpoint: "b2_upload_*", Drop: true, DropAfter: 1000}
+type Fault struct {
+	// Endpoint is a glob matched against the endpoint name. Empty matches
+	// all endpoints.
+	Endpoint string
+
+	// Nth is the first matching request that fails, counting from 1. Zero
+	// means all matching requests fail.
+	Nth int
+
+	// Times is the number of requests that fail, starting with the Nth.
+	// Defaults to 1.
+	Times int
+
+	// Delay is how long to wait before handling the request.
+	Delay time.Duration
+
+	// Status answers the request with an error response of this status
+	// code instead of handling it. Code and Message default to the error
+	// code B2 uses for the status and the status text.
+	Status  int
+	Code    string
+	Message string
+
+	// Drop closes the connection without a response after reading
+	// DropAfter bytes of the request body.
+	Drop      bool
+	DropAfter int64
+
+	// Stall stops writing the response body after StallAfter bytes for
+	// StallFor, or until the client gives up if StallFor is zero.
+	Stall      bool
+	StallAfter int64
+	StallFor   time.Duration
+
+	// SlowBody is the pause between every kilobyte of the response body.
+	SlowBody time.Duration
+}
+
+// faultRule is a fault along with the number of requests it matched.
+type faultRule struct {
+	Fault
+
+	matched int
+}
+
+// applies reports whether the latest matching request fails.
+func (r *faultRule) applies() bool {
+	if r.Nth == 0 {
+		return true
+	}
+	times := r.Times
+	if times < 1 {
+		times = 1
+	}
+	return r.matched >= r.Nth && r.matched < r.Nth+times
+}
+
+// Faults wraps a handler, such as the mux of NewServer or an Emulator, and
+// makes requests misbehave on purpose, e.g. to test retries and resuming.
+// Requests that no fault applies to are passed to the handler.
+type Faults struct {
+	handler http.Handler
+
+	mu    sync.Mutex
+	rules []*faultRule
+
+	// Number of requests to each endpoint.
+	requests map[string]int
+}
+
+// NewFaults returns a handler that passes requests to the handler unless a
+// fault applies to them.
+func NewFaults(handler http.Handler) *Faults {
+	return &Faults{
+		handler:  handler,
+		requests: make(map[string]int),
+	}
+}
+
+// NewFaultyServer is like NewServer, but requests go through the returned
+// faults first.
+//
+// It is callers responsibility to call Close when finished, to shut it down
+func NewFaultyServer() (*httptest.Server, *http.ServeMux, *Faults) {
+	mux := http.NewServeMux()
+	faults := NewFaults(mux)
+	server := httptest.NewServer(faults)
+	handleAuthorization(mux, server)
+	return server, mux, faults
+}
+
+// NewFaultyEmulatorServer is like NewEmulatorServer, but requests go through
+// the returned faults first.
+//
+// It is callers responsibility to call Close when finished, to shut it down
+func NewFaultyEmulatorServer() (*httptest.Server, *Emulator, *Faults) {
+	emulator := NewEmulator()
+	faults := NewFaults(emulator)
+	return httptest.NewServer(faults), emulator, faults
+}
+
+// Add adds faults. When several faults apply to a request, the one added
+// first is used, but all of them count the request.
+func (f *Faults) Add(faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, fault := range faults {
+		f.rules = append(f.rules, &faultRule{Fault: fault})
+	}
+}
+
+// Reset removes all faults and forgets the requests.
+func (f *Faults) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = nil
+	f.requests = make(map[string]int)
+}
+
+// Requests returns the number of requests to the endpoint so far, including
+// the ones that failed.
+func (f *Faults) Requests(endpoint string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests[endpoint]
+}
+
+func (f *Faults) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := endpointName(r.URL.Path)
+
+	f.mu.Lock()
+	f.requests[endpoint]++
+	var fault *Fault
+	for _, rule := range f.rules {
+		if ok, _ := path.Match(rule.Endpoint, endpoint); !ok && rule.Endpoint != "" {
+			continue
+		}
+		rule.matched++
+		if fault == nil && rule.applies() {
+			fault = &rule.Fault
+		}
+	}
+	f.mu.Unlock()
+
+	if fault == nil {
+		f.handler.ServeHTTP(w, r)
+		return
+	}
+	fault.serve(w, r, f.handler)
+}
+
+// endpointName returns the name of the endpoint the path belongs to.
+func endpointName(p string) string {
+	if strings.HasPrefix(p, "/file/") {
+		return "download"
+	}
+
+	p = strings.TrimPrefix(p, "/b2api/v2/")
+	if i := strings.Index(p, "/"); i >= 0 {
+		// Upload URLs end with the bucket or large file ID
+		p = p[:i]
+	}
+	return p
+}
+
+// serve answers the request the way the fault describes.
+func (f *Fault) serve(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	if !sleep(r, f.Delay) {
+		return
+	}
+
+	if f.Drop {
+		io.CopyN(ioutil.Discard, r.Body, f.DropAfter)
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if f.Status != 0 {
+		// Read the whole request, so that the client gets to see the
+		// response rather than a broken connection
+		io.Copy(ioutil.Discard, r.Body)
+
+		code, message := f.Code, f.Message
+		if code == "" {
+			code = defaultFaultCodes[f.Status]
+		}
+		if message == "" {
+			message = http.StatusText(f.Status)
+		}
+		writeError(w, &apiError{Status: f.Status, Code: code, Message: message})
+		return
+	}
+
+	if !f.Stall && f.SlowBody == 0 {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	// The response is recorded first, so that a slow client doesn't keep
+	// the handler, and any locks it holds, busy
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+
+	body := rec.Body.Bytes()
+	for written := int64(0); len(body) > 0; {
+		n := int64(len(body))
+		if f.SlowBody > 0 && n > slowBodyChunkSize {
+			n = slowBodyChunkSize
+		}
+		if f.Stall && written < f.StallAfter && written+n > f.StallAfter {
+			n = f.StallAfter - written
+		}
+
+		if f.Stall && written == f.StallAfter {
+			flush(w)
+			if f.StallFor == 0 {
+				<-r.Context().Done()
+				return
+			}
+			if !sleep(r, f.StallFor) {
+				return
+			}
+		} else if f.SlowBody > 0 && written > 0 {
+			flush(w)
+			if !sleep(r, f.SlowBody) {
+				return
+			}
+		}
+
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		body = body[n:]
+		written += n
+	}
+}
+
+// sleep waits for the duration and reports whether the client is still
+// waiting for the response.
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,149 @@
+package testutil_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/romantomjak/b2/b2"
+	"github.com/romantomjak/b2/testutil"
+)
+
+func newFaultyEmulatorClient(t *testing.T) (*b2.Client, *testutil.Emulator, *testutil.Faults) {
+	server, emulator, faults := testutil.NewFaultyEmulatorServer()
+	t.Cleanup(server.Close)
+
+	cache, err := b2.NewInMemoryCache()
+	require.NoError(t, err)
+
+	client, err := b2.NewClient(emulator.KeyID, emulator.KeySecret, b2.SetBaseURL(server.URL), b2.SetCache(cache))
+	require.NoError(t, err)
+
+	return client, emulator, faults
+}
+
+func TestFaults_StatusOnNthRequest(t *testing.T) {
+	client, _, faults := newFaultyEmulatorClient(t)
+	faults.Add(testutil.Fault{Endpoint: "b2_list_buckets", Nth: 2, Times: 2, Status: http.StatusInternalServerError})
+
+	var errs []error
+	for i := 0; i < 4; i++ {
+		_, _, err := client.Bucket.List(context.Background(), &b2.BucketListRequest{AccountID: client.AccountID})
+		errs = append(errs, err)
+	}
+
+	assert.NoError(t, errs[0])
+	assert.Contains(t, fmt.Sprint(errs[1]), "500 POST")
+	assert.Contains(t, fmt.Sprint(errs[2]), "internal_error")
+	assert.NoError(t, errs[3])
+	assert.Equal(t, 4, faults.Requests("b2_list_buckets"))
+}
+
+func TestFaults_ExpiredToken(t *testing.T) {
+	client, emulator, faults := newFaultyEmulatorClient(t)
+	faults.Add(testutil.Fault{Endpoint: "b2_list_file_*", Status: http.StatusUnauthorized, Code: "expired_auth_token"})
+
+	bucketID, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+
+	_, err = client.File.ListAll(context.Background(), &b2.FileListRequest{BucketID: bucketID})
+	assert.True(t, errors.Is(err, b2.ErrExpiredToken), "%v", err)
+}
+
+func TestFaults_UploadUnavailable(t *testing.T) {
+	client, emulator, faults := newFaultyEmulatorClient(t)
+	faults.Add(testutil.Fault{Endpoint: "b2_upload_*", Nth: 1, Status: http.StatusServiceUnavailable})
+
+	bucketID, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+
+	auth, _, err := client.File.UploadAuthorization(context.Background(), &b2.UploadAuthorizationRequest{BucketID: bucketID})
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("a"), 100000)
+	_, _, err = client.File.Upload(context.Background(), &b2.UploadRequest{
+		Authorization: auth,
+		Body:          bytes.NewReader(data),
+		Key:           "a.txt",
+		ChecksumSHA1:  sha1Hex(data),
+		ContentLength: int64(len(data)),
+	})
+	assert.Contains(t, fmt.Sprint(err), "service_unavailable")
+
+	_, ok := emulator.FileData("my-bucket", "a.txt")
+	assert.False(t, ok)
+
+	// Only the first upload fails
+	upload(t, client, bucketID, "a.txt", data)
+	_, ok = emulator.FileData("my-bucket", "a.txt")
+	assert.True(t, ok)
+}
+
+func TestFaults_DropConnectionDuringUpload(t *testing.T) {
+	client, emulator, faults := newFaultyEmulatorClient(t)
+	faults.Add(testutil.Fault{Endpoint: "b2_upload_file", Drop: true, DropAfter: 1000})
+
+	bucketID, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+
+	auth, _, err := client.File.UploadAuthorization(context.Background(), &b2.UploadAuthorizationRequest{BucketID: bucketID})
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("a"), 100000)
+	_, _, err = client.File.Upload(context.Background(), &b2.UploadRequest{
+		Authorization: auth,
+		Body:          bytes.NewReader(data),
+		Key:           "a.txt",
+		ChecksumSHA1:  sha1Hex(data),
+		ContentLength: int64(len(data)),
+	})
+	assert.Error(t, err)
+
+	_, ok := emulator.FileData("my-bucket", "a.txt")
+	assert.False(t, ok)
+}
+
+func TestFaults_StalledBody(t *testing.T) {
+	client, emulator, faults := newFaultyEmulatorClient(t)
+	faults.Add(testutil.Fault{Endpoint: "download", Stall: true, StallAfter: 5})
+
+	_, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+	_, err = emulator.PutFile("my-bucket", "hello.txt", []byte("hello, world"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var buf bytes.Buffer
+	_, err = client.File.Download(ctx, client.DownloadURL+"/file/my-bucket/hello.txt", &buf)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.Equal(t, "hello", buf.String())
+}
+
+func TestFaults_SlowBody(t *testing.T) {
+	client, emulator, faults := newFaultyEmulatorClient(t)
+	faults.Add(testutil.Fault{Endpoint: "download", SlowBody: 20 * time.Millisecond})
+
+	_, err := emulator.CreateBucket("my-bucket", "allPrivate")
+	require.NoError(t, err)
+	data := strings.Repeat("a", 3000)
+	_, err = emulator.PutFile("my-bucket", "a.txt", []byte(data))
+	require.NoError(t, err)
+
+	start := time.Now()
+
+	var buf bytes.Buffer
+	_, err = client.File.Download(context.Background(), client.DownloadURL+"/file/my-bucket/a.txt", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, data, buf.String())
+	assert.True(t, time.Since(start) >= 40*time.Millisecond, "took %v", time.Since(start))
+}
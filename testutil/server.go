@@ -16,6 +16,13 @@ import (
 func NewServer() (*httptest.Server, *http.ServeMux) {
 	mux := http.NewServeMux()
 	server := httptest.NewServer(mux)
+	handleAuthorization(mux, server)
+	return server, mux
+}
+
+// handleAuthorization makes the mux return a B2 API authorization response
+// pointing at the server.
+func handleAuthorization(mux *http.ServeMux, server *httptest.Server) {
 	authJSON := `{
 		"absoluteMinimumPartSize": 5000000,
 		"accountId": "abc123",
@@ -33,5 +40,4 @@ func NewServer() (*httptest.Server, *http.ServeMux) {
 	mux.HandleFunc("/b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, authJSON, server.URL, server.URL)
 	})
-	return server, mux
 }